@@ -0,0 +1,41 @@
+// Command fakepush is a local stand-in for a browser push service. It prints
+// a subscription to register with POST /api/push/subscribe, then logs every
+// push it receives after checking its VAPID header and decrypting it. The
+// backend only pushes to it when started with WEBPUSH_ALLOW_LOCAL=true, as it
+// is served over http on a local address.
+//
+//	go run ./cmd/fakepush -addr :8099
+//	go run ./cmd/fakepush -addr :8099 -gone   # answer 410, like an expired subscription
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"social-network/backend/pkg/webpush"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8099", "listen address")
+	gone := flag.Bool("gone", false, "reject every push with 410 Gone")
+	flag.Parse()
+
+	fake, err := webpush.NewFakeEndpoint("http://" + *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fake.Gone = *gone
+	fake.OnPush = func(payload []byte) { log.Printf("push: %s", payload) }
+
+	sub, _ := json.Marshal(fake.Subscription())
+	log.Printf("subscription: %s", sub)
+	if f := os.Getenv("FAKEPUSH_SUBSCRIPTION_FILE"); f != "" {
+		_ = os.WriteFile(f, sub, 0644)
+	}
+
+	http.Handle("/push/fake", fake)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,3 @@
+-- pkg/db/migrations/sqlite/000013_media.down.sql
+DROP INDEX IF EXISTS idx_media_owner;
+DROP TABLE IF EXISTS media;
@@ -0,0 +1,11 @@
+-- Every file written to UPLOAD_DIR, with the user who uploaded it.
+-- Used by the /uploads/ handler to decide who may read a file that is
+-- not (yet) attached to a post, message or avatar.
+CREATE TABLE IF NOT EXISTS media (
+  name       TEXT PRIMARY KEY,            -- file name under UPLOAD_DIR
+  owner_id   TEXT,                        -- uploader (null = anonymous upload)
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_owner ON media (owner_id);
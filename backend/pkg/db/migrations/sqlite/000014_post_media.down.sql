@@ -0,0 +1,3 @@
+-- pkg/db/migrations/sqlite/000014_post_media.down.sql
+DROP INDEX IF EXISTS idx_post_media_url;
+DROP TABLE IF EXISTS post_media;
@@ -0,0 +1,19 @@
+-- Ordered media items (images for now) attached to a post.
+-- posts.image_url is kept as the first item's url for older clients.
+CREATE TABLE IF NOT EXISTS post_media (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  post_id    INTEGER NOT NULL,
+  position   INTEGER NOT NULL,            -- 0-based order within the post
+  url        TEXT NOT NULL,               -- /uploads/<name>
+  caption    TEXT,
+  alt_text   TEXT,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  UNIQUE (post_id, position),
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_media_url ON post_media (url);
+
+-- Existing single-image posts become one-item galleries
+INSERT INTO post_media (post_id, position, url)
+SELECT id, 0, image_url FROM posts WHERE image_url IS NOT NULL AND image_url <> '';
@@ -0,0 +1,3 @@
+-- pkg/db/migrations/sqlite/000015_media_types.down.sql
+DROP INDEX IF EXISTS idx_post_media_poster;
+-- SQLite can't drop columns easily; leaving media_type/content_type/duration_ms/poster_url.
@@ -0,0 +1,15 @@
+-- Media kinds beyond still images: 'image' | 'gif' | 'video'.
+-- GIFs get a PNG poster frame; GIFs and videos record their duration.
+ALTER TABLE media ADD COLUMN media_type TEXT NOT NULL DEFAULT 'image';
+ALTER TABLE media ADD COLUMN content_type TEXT;
+ALTER TABLE media ADD COLUMN duration_ms INTEGER;
+ALTER TABLE media ADD COLUMN poster_url TEXT;
+
+ALTER TABLE post_media ADD COLUMN media_type TEXT NOT NULL DEFAULT 'image';
+ALTER TABLE post_media ADD COLUMN duration_ms INTEGER;
+ALTER TABLE post_media ADD COLUMN poster_url TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_post_media_poster ON post_media (poster_url);
+
+UPDATE media SET media_type='gif' WHERE lower(name) LIKE '%.gif';
+UPDATE post_media SET media_type='gif' WHERE lower(url) LIKE '%.gif';
@@ -0,0 +1,3 @@
+-- pkg/db/migrations/sqlite/000016_hashtags_mentions.down.sql
+DROP TABLE IF EXISTS mentions;
+DROP TABLE IF EXISTS hashtags;
@@ -0,0 +1,28 @@
+-- #hashtags and @mentions parsed out of post and comment bodies.
+-- comment_id is null when the tag/mention is in the post body itself.
+CREATE TABLE IF NOT EXISTS hashtags (
+  tag        TEXT NOT NULL,               -- lowercased, without '#'
+  post_id    INTEGER NOT NULL,
+  comment_id INTEGER,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_hashtags_tag ON hashtags (tag, post_id);
+CREATE INDEX IF NOT EXISTS idx_hashtags_source ON hashtags (post_id, comment_id);
+
+CREATE TABLE IF NOT EXISTS mentions (
+  user_id    TEXT NOT NULL,               -- who was mentioned
+  actor_id   TEXT NOT NULL,               -- who wrote the post/comment
+  handle     TEXT NOT NULL,               -- text after '@' as written
+  post_id    INTEGER NOT NULL,
+  comment_id INTEGER,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_mentions_source ON mentions (post_id, comment_id);
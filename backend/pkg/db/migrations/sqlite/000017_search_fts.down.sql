@@ -0,0 +1,17 @@
+-- pkg/db/migrations/sqlite/000017_search_fts.down.sql
+DROP TRIGGER IF EXISTS users_fts_au;
+DROP TRIGGER IF EXISTS users_fts_ad;
+DROP TRIGGER IF EXISTS users_fts_ai;
+DROP TRIGGER IF EXISTS groups_fts_au;
+DROP TRIGGER IF EXISTS groups_fts_ad;
+DROP TRIGGER IF EXISTS groups_fts_ai;
+DROP TRIGGER IF EXISTS comments_fts_au;
+DROP TRIGGER IF EXISTS comments_fts_ad;
+DROP TRIGGER IF EXISTS comments_fts_ai;
+DROP TRIGGER IF EXISTS posts_fts_au;
+DROP TRIGGER IF EXISTS posts_fts_ad;
+DROP TRIGGER IF EXISTS posts_fts_ai;
+DROP TABLE IF EXISTS users_fts;
+DROP TABLE IF EXISTS groups_fts;
+DROP TABLE IF EXISTS comments_fts;
+DROP TABLE IF EXISTS posts_fts;
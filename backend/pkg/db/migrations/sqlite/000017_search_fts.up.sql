@@ -0,0 +1,76 @@
+-- Full-text indexes for /api/search (needs the fts5 module: build with -tags sqlite_fts5).
+-- posts, comments and groups are external-content tables keyed by the row id;
+-- users have a TEXT id, so their index stores it in an unindexed column.
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+  body,
+  content='posts', content_rowid='id',
+  tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5(
+  body,
+  content='comments', content_rowid='id',
+  tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS groups_fts USING fts5(
+  title, description,
+  content='groups', content_rowid='id',
+  tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+  user_id UNINDEXED, name, nickname,
+  tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+-- keep the indexes in sync
+CREATE TRIGGER IF NOT EXISTS posts_fts_ai AFTER INSERT ON posts BEGIN
+  INSERT INTO posts_fts (rowid, body) VALUES (new.id, new.body);
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_ad AFTER DELETE ON posts BEGIN
+  INSERT INTO posts_fts (posts_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_au AFTER UPDATE OF body ON posts BEGIN
+  INSERT INTO posts_fts (posts_fts, rowid, body) VALUES ('delete', old.id, old.body);
+  INSERT INTO posts_fts (rowid, body) VALUES (new.id, new.body);
+END;
+
+CREATE TRIGGER IF NOT EXISTS comments_fts_ai AFTER INSERT ON comments BEGIN
+  INSERT INTO comments_fts (rowid, body) VALUES (new.id, new.body);
+END;
+CREATE TRIGGER IF NOT EXISTS comments_fts_ad AFTER DELETE ON comments BEGIN
+  INSERT INTO comments_fts (comments_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+CREATE TRIGGER IF NOT EXISTS comments_fts_au AFTER UPDATE OF body ON comments BEGIN
+  INSERT INTO comments_fts (comments_fts, rowid, body) VALUES ('delete', old.id, old.body);
+  INSERT INTO comments_fts (rowid, body) VALUES (new.id, new.body);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_ai AFTER INSERT ON groups BEGIN
+  INSERT INTO groups_fts (rowid, title, description) VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+CREATE TRIGGER IF NOT EXISTS groups_fts_ad AFTER DELETE ON groups BEGIN
+  INSERT INTO groups_fts (groups_fts, rowid, title, description) VALUES ('delete', old.id, old.title, COALESCE(old.description, ''));
+END;
+CREATE TRIGGER IF NOT EXISTS groups_fts_au AFTER UPDATE OF title, description ON groups BEGIN
+  INSERT INTO groups_fts (groups_fts, rowid, title, description) VALUES ('delete', old.id, old.title, COALESCE(old.description, ''));
+  INSERT INTO groups_fts (rowid, title, description) VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_ai AFTER INSERT ON users BEGIN
+  INSERT INTO users_fts (user_id, name, nickname) VALUES (new.id, new.first_name || ' ' || new.last_name, COALESCE(new.nickname, ''));
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_ad AFTER DELETE ON users BEGIN
+  DELETE FROM users_fts WHERE user_id = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_au AFTER UPDATE OF first_name, last_name, nickname ON users BEGIN
+  DELETE FROM users_fts WHERE user_id = old.id;
+  INSERT INTO users_fts (user_id, name, nickname) VALUES (new.id, new.first_name || ' ' || new.last_name, COALESCE(new.nickname, ''));
+END;
+
+-- index what is already there
+INSERT INTO posts_fts (posts_fts) VALUES ('rebuild');
+INSERT INTO comments_fts (comments_fts) VALUES ('rebuild');
+INSERT INTO groups_fts (rowid, title, description) SELECT id, title, COALESCE(description, '') FROM groups;
+INSERT INTO users_fts (user_id, name, nickname) SELECT id, first_name || ' ' || last_name, COALESCE(nickname, '') FROM users;
@@ -0,0 +1,10 @@
+-- pkg/db/migrations/sqlite/000018_chat_search.down.sql
+DROP INDEX IF EXISTS idx_group_messages_gid_id;
+DROP TRIGGER IF EXISTS group_messages_fts_au;
+DROP TRIGGER IF EXISTS group_messages_fts_ad;
+DROP TRIGGER IF EXISTS group_messages_fts_ai;
+DROP TRIGGER IF EXISTS dm_messages_fts_au;
+DROP TRIGGER IF EXISTS dm_messages_fts_ad;
+DROP TRIGGER IF EXISTS dm_messages_fts_ai;
+DROP TABLE IF EXISTS group_messages_fts;
+DROP TABLE IF EXISTS dm_messages_fts;
@@ -0,0 +1,40 @@
+-- Full-text indexes over chat history for /api/chat/search (fts5, like 000017).
+CREATE VIRTUAL TABLE IF NOT EXISTS dm_messages_fts USING fts5(
+  body,
+  content='dm_messages', content_rowid='id',
+  tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS group_messages_fts USING fts5(
+  body,
+  content='group_messages', content_rowid='id',
+  tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE TRIGGER IF NOT EXISTS dm_messages_fts_ai AFTER INSERT ON dm_messages BEGIN
+  INSERT INTO dm_messages_fts (rowid, body) VALUES (new.id, new.body);
+END;
+CREATE TRIGGER IF NOT EXISTS dm_messages_fts_ad AFTER DELETE ON dm_messages BEGIN
+  INSERT INTO dm_messages_fts (dm_messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+CREATE TRIGGER IF NOT EXISTS dm_messages_fts_au AFTER UPDATE OF body ON dm_messages BEGIN
+  INSERT INTO dm_messages_fts (dm_messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+  INSERT INTO dm_messages_fts (rowid, body) VALUES (new.id, new.body);
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_ai AFTER INSERT ON group_messages BEGIN
+  INSERT INTO group_messages_fts (rowid, body) VALUES (new.id, new.body);
+END;
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_ad AFTER DELETE ON group_messages BEGIN
+  INSERT INTO group_messages_fts (group_messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_au AFTER UPDATE OF body ON group_messages BEGIN
+  INSERT INTO group_messages_fts (group_messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+  INSERT INTO group_messages_fts (rowid, body) VALUES (new.id, new.body);
+END;
+
+INSERT INTO dm_messages_fts (dm_messages_fts) VALUES ('rebuild');
+INSERT INTO group_messages_fts (group_messages_fts) VALUES ('rebuild');
+
+-- context lookups walk a conversation by id
+CREATE INDEX IF NOT EXISTS idx_group_messages_gid_id ON group_messages (group_id, id);
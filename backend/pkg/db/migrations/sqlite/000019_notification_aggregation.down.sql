@@ -0,0 +1,5 @@
+-- pkg/db/migrations/sqlite/000019_notification_aggregation.down.sql
+DROP INDEX IF EXISTS idx_notifications_agg;
+DROP TABLE IF EXISTS notification_actors;
+ALTER TABLE notifications DROP COLUMN actor_count;
+ALTER TABLE notifications DROP COLUMN agg_key;
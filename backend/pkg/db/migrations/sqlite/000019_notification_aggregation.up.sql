@@ -0,0 +1,19 @@
+-- Dedup/aggregation for notifications (see handlers.Notifier).
+-- agg_key identifies "the same thing": unread notifications with the same
+-- key for the same user are merged instead of piling up.
+ALTER TABLE notifications ADD COLUMN agg_key TEXT;
+ALTER TABLE notifications ADD COLUMN actor_count INTEGER NOT NULL DEFAULT 1;
+
+-- every distinct actor folded into a notification ("Ali and 3 others")
+CREATE TABLE IF NOT EXISTS notification_actors (
+  notification_id INTEGER NOT NULL,
+  actor_id        TEXT NOT NULL,
+  created_at      TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (notification_id, actor_id),
+  FOREIGN KEY (notification_id) REFERENCES notifications(id) ON DELETE CASCADE
+);
+
+INSERT OR IGNORE INTO notification_actors (notification_id, actor_id, created_at)
+SELECT id, actor_id, created_at FROM notifications WHERE actor_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_agg ON notifications (user_id, agg_key) WHERE read_at IS NULL;
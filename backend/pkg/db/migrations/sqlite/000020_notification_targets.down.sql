@@ -0,0 +1,5 @@
+-- pkg/db/migrations/sqlite/000020_notification_targets.down.sql
+DROP INDEX IF EXISTS idx_notifications_target;
+ALTER TABLE notifications DROP COLUMN metadata;
+ALTER TABLE notifications DROP COLUMN target_id;
+ALTER TABLE notifications DROP COLUMN target_type;
@@ -0,0 +1,23 @@
+-- What a notification points at, so clients can link it without extra lookups.
+-- target_type: post | comment | user | group | event
+-- metadata: JSON object with related ids and titles (groupTitle, title, postExcerpt, ...)
+ALTER TABLE notifications ADD COLUMN target_type TEXT;
+ALTER TABLE notifications ADD COLUMN target_id TEXT;
+ALTER TABLE notifications ADD COLUMN metadata TEXT;
+
+UPDATE notifications SET target_type = 'comment', target_id = CAST(comment_id AS TEXT)
+WHERE type = 'mention' AND comment_id IS NOT NULL;
+
+UPDATE notifications SET target_type = 'post', target_id = CAST(post_id AS TEXT)
+WHERE target_type IS NULL AND post_id IS NOT NULL;
+
+UPDATE notifications SET target_type = 'user', target_id = actor_id
+WHERE target_type IS NULL AND type IN ('follow_request', 'follow_accepted', 'new_follower');
+
+UPDATE notifications SET metadata = json_object('postId', post_id)
+WHERE post_id IS NOT NULL;
+
+UPDATE notifications SET metadata = json_set(metadata, '$.commentId', comment_id)
+WHERE post_id IS NOT NULL AND comment_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_target ON notifications (target_type, target_id);
@@ -0,0 +1,5 @@
+-- pkg/db/migrations/sqlite/000021_notification_preferences.down.sql
+ALTER TABLE notifications DROP COLUMN in_app;
+DROP TABLE IF EXISTS notification_settings;
+DROP TABLE IF EXISTS notification_mutes;
+DROP TABLE IF EXISTS notification_preferences;
@@ -0,0 +1,34 @@
+-- Per-user notification settings (see handlers.Notifier.delivery).
+-- A missing row means the default: every channel on.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  user_id TEXT NOT NULL,
+  type    TEXT NOT NULL,                  -- notification type, e.g. like | mention | dm
+  in_app  INTEGER NOT NULL DEFAULT 1,     -- listed in GET /api/notifications
+  push    INTEGER NOT NULL DEFAULT 1,     -- pushed live over the WebSocket
+  email   INTEGER NOT NULL DEFAULT 1,     -- included in email digests
+  PRIMARY KEY (user_id, type),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- nothing about a muted post, group or DM conversation is delivered
+CREATE TABLE IF NOT EXISTS notification_mutes (
+  user_id     TEXT NOT NULL,
+  target_type TEXT NOT NULL CHECK (target_type IN ('post', 'group', 'conversation')),
+  target_id   TEXT NOT NULL,              -- post/group id, or the other user for a conversation
+  until       TEXT,                       -- null = until unmuted
+  created_at  TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (user_id, target_type, target_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- quiet hours hold back pushes; quiet_start/quiet_end are "HH:MM" in quiet_tz
+CREATE TABLE IF NOT EXISTS notification_settings (
+  user_id     TEXT PRIMARY KEY,
+  quiet_start TEXT,
+  quiet_end   TEXT,
+  quiet_tz    TEXT NOT NULL DEFAULT 'UTC',
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 0 = kept only for other channels (email digests), hidden from the list
+ALTER TABLE notifications ADD COLUMN in_app INTEGER NOT NULL DEFAULT 1;
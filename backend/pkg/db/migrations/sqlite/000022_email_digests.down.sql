@@ -0,0 +1,5 @@
+-- pkg/db/migrations/sqlite/000022_email_digests.down.sql
+DROP INDEX IF EXISTS idx_notifications_email_pending;
+ALTER TABLE notifications DROP COLUMN emailed_at;
+ALTER TABLE notification_settings DROP COLUMN last_digest_at;
+ALTER TABLE notification_settings DROP COLUMN digest;
@@ -0,0 +1,12 @@
+-- Email: digests of unread notifications, and immediate mail for a few types.
+-- digest: off | daily | weekly, off until the user opts in; last_digest_at
+-- paces the next one.
+ALTER TABLE notification_settings ADD COLUMN digest TEXT NOT NULL DEFAULT 'off'
+  CHECK (digest IN ('off', 'daily', 'weekly'));
+ALTER TABLE notification_settings ADD COLUMN last_digest_at TEXT;
+
+-- set once a notification went out by email, so it isn't mailed twice
+ALTER TABLE notifications ADD COLUMN emailed_at TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_email_pending ON notifications (user_id)
+  WHERE read_at IS NULL AND emailed_at IS NULL;
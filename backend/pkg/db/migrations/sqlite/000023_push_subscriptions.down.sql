@@ -0,0 +1,4 @@
+-- pkg/db/migrations/sqlite/000023_push_subscriptions.down.sql
+DROP TABLE IF EXISTS app_keys;
+DROP INDEX IF EXISTS idx_push_subscriptions_user;
+DROP TABLE IF EXISTS push_subscriptions;
@@ -0,0 +1,22 @@
+-- Web Push: one row per browser/device a user enabled push on.
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id      TEXT NOT NULL,
+  endpoint     TEXT NOT NULL UNIQUE,     -- push service URL for this device
+  p256dh       TEXT NOT NULL,            -- device public key (base64url)
+  auth         TEXT NOT NULL,            -- device auth secret (base64url)
+  user_agent   TEXT,
+  failures     INTEGER NOT NULL DEFAULT 0, -- consecutive failed sends
+  created_at   TEXT NOT NULL DEFAULT (datetime('now')),
+  last_used_at TEXT,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user ON push_subscriptions (user_id);
+
+-- server-generated secrets that must survive restarts (e.g. the VAPID key)
+CREATE TABLE IF NOT EXISTS app_keys (
+  name       TEXT PRIMARY KEY,
+  value      TEXT NOT NULL,
+  created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
@@ -0,0 +1,23 @@
+-- pkg/db/migrations/sqlite/000024_event_rsvp_waitlist.down.sql
+CREATE TABLE IF NOT EXISTS event_responses_old (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  event_id INTEGER NOT NULL,
+  user_id TEXT NOT NULL,
+  response TEXT NOT NULL CHECK (response IN ('going', 'not_going')),
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  UNIQUE(event_id, user_id),
+  FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO event_responses_old (id, event_id, user_id, response, created_at)
+SELECT id, event_id, user_id, response, created_at FROM event_responses
+WHERE response IN ('going', 'not_going');
+
+DROP TABLE IF EXISTS event_responses;
+ALTER TABLE event_responses_old RENAME TO event_responses;
+
+CREATE INDEX IF NOT EXISTS idx_event_responses_event_id ON event_responses(event_id);
+CREATE INDEX IF NOT EXISTS idx_event_responses_user_id ON event_responses(user_id);
+
+ALTER TABLE events DROP COLUMN capacity;
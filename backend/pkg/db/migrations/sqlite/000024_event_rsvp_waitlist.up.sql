@@ -0,0 +1,27 @@
+-- RSVP "maybe", optional capacity and a waitlist.
+-- SQLite can't change a CHECK constraint, so event_responses is recreated.
+-- 'waitlisted' = wants to go but the event is full; the waitlist is served
+-- in updated_at order.
+ALTER TABLE events ADD COLUMN capacity INTEGER CHECK (capacity IS NULL OR capacity > 0);
+
+CREATE TABLE IF NOT EXISTS event_responses_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  event_id INTEGER NOT NULL,
+  user_id TEXT NOT NULL,
+  response TEXT NOT NULL CHECK (response IN ('going', 'maybe', 'not_going', 'waitlisted')),
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+  UNIQUE(event_id, user_id),
+  FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO event_responses_new (id, event_id, user_id, response, created_at, updated_at)
+SELECT id, event_id, user_id, response, created_at, created_at FROM event_responses;
+
+DROP TABLE IF EXISTS event_responses;
+ALTER TABLE event_responses_new RENAME TO event_responses;
+
+CREATE INDEX IF NOT EXISTS idx_event_responses_event_id ON event_responses(event_id);
+CREATE INDEX IF NOT EXISTS idx_event_responses_user_id ON event_responses(user_id);
+CREATE INDEX IF NOT EXISTS idx_event_responses_waitlist ON event_responses(event_id, updated_at) WHERE response = 'waitlisted';
@@ -0,0 +1,5 @@
+-- pkg/db/migrations/sqlite/000025_event_status_reminders.down.sql
+DROP TABLE IF EXISTS event_reminders;
+ALTER TABLE events DROP COLUMN updated_at;
+ALTER TABLE events DROP COLUMN cancel_reason;
+ALTER TABLE events DROP COLUMN status;
@@ -0,0 +1,16 @@
+-- Events can be edited and cancelled (kept, unlike deleted ones), and
+-- members going get reminders before they start.
+ALTER TABLE events ADD COLUMN status TEXT NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled'));
+ALTER TABLE events ADD COLUMN cancel_reason TEXT;
+ALTER TABLE events ADD COLUMN updated_at TEXT;
+
+-- one row per reminder sent, so none goes out twice
+CREATE TABLE IF NOT EXISTS event_reminders (
+  event_id INTEGER NOT NULL,
+  user_id  TEXT NOT NULL,
+  kind     TEXT NOT NULL,                -- 24h | 1h
+  sent_at  TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (event_id, user_id, kind),
+  FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,37 @@
+-- pkg/db/migrations/sqlite/000026_recurring_events.down.sql
+-- Responses and reminders for occurrences of recurring events are dropped.
+CREATE TABLE IF NOT EXISTS event_reminders_old (
+  event_id INTEGER NOT NULL,
+  user_id  TEXT NOT NULL,
+  kind     TEXT NOT NULL,
+  sent_at  TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (event_id, user_id, kind),
+  FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO event_reminders_old (event_id, user_id, kind, sent_at)
+SELECT event_id, user_id, kind, sent_at FROM event_reminders WHERE occurrence = '';
+DROP TABLE IF EXISTS event_reminders;
+ALTER TABLE event_reminders_old RENAME TO event_reminders;
+
+CREATE TABLE IF NOT EXISTS event_responses_old (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  event_id INTEGER NOT NULL,
+  user_id TEXT NOT NULL,
+  response TEXT NOT NULL CHECK (response IN ('going', 'maybe', 'not_going', 'waitlisted')),
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+  UNIQUE(event_id, user_id),
+  FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO event_responses_old (id, event_id, user_id, response, created_at, updated_at)
+SELECT id, event_id, user_id, response, created_at, updated_at FROM event_responses WHERE occurrence = '';
+DROP TABLE IF EXISTS event_responses;
+ALTER TABLE event_responses_old RENAME TO event_responses;
+CREATE INDEX IF NOT EXISTS idx_event_responses_event_id ON event_responses(event_id);
+CREATE INDEX IF NOT EXISTS idx_event_responses_user_id ON event_responses(user_id);
+CREATE INDEX IF NOT EXISTS idx_event_responses_waitlist ON event_responses(event_id, updated_at) WHERE response = 'waitlisted';
+
+DROP TABLE IF EXISTS event_exceptions;
+ALTER TABLE events DROP COLUMN recurrence;
@@ -0,0 +1,53 @@
+-- Recurring events: events.recurrence is an RRULE (see pkg/rrule) and
+-- event_date its first occurrence. Occurrences are named by their start
+-- ("2006-01-02T15:04"); responses and reminders are per occurrence, '' for
+-- one-off events. event_exceptions are occurrences taken out of a series.
+ALTER TABLE events ADD COLUMN recurrence TEXT;
+
+CREATE TABLE IF NOT EXISTS event_exceptions (
+  event_id   INTEGER NOT NULL,
+  occurrence TEXT NOT NULL,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (event_id, occurrence),
+  FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS event_responses_new (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  event_id INTEGER NOT NULL,
+  occurrence TEXT NOT NULL DEFAULT '',
+  user_id TEXT NOT NULL,
+  response TEXT NOT NULL CHECK (response IN ('going', 'maybe', 'not_going', 'waitlisted')),
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  updated_at TEXT NOT NULL DEFAULT (datetime('now')),
+  UNIQUE(event_id, occurrence, user_id),
+  FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO event_responses_new (id, event_id, user_id, response, created_at, updated_at)
+SELECT id, event_id, user_id, response, created_at, updated_at FROM event_responses;
+
+DROP TABLE IF EXISTS event_responses;
+ALTER TABLE event_responses_new RENAME TO event_responses;
+
+CREATE INDEX IF NOT EXISTS idx_event_responses_event_id ON event_responses(event_id, occurrence);
+CREATE INDEX IF NOT EXISTS idx_event_responses_user_id ON event_responses(user_id);
+CREATE INDEX IF NOT EXISTS idx_event_responses_waitlist ON event_responses(event_id, occurrence, updated_at) WHERE response = 'waitlisted';
+
+CREATE TABLE IF NOT EXISTS event_reminders_new (
+  event_id   INTEGER NOT NULL,
+  occurrence TEXT NOT NULL DEFAULT '',
+  user_id    TEXT NOT NULL,
+  kind       TEXT NOT NULL,                -- 24h | 1h
+  sent_at    TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (event_id, occurrence, user_id, kind),
+  FOREIGN KEY (event_id) REFERENCES events(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO event_reminders_new (event_id, user_id, kind, sent_at)
+SELECT event_id, user_id, kind, sent_at FROM event_reminders;
+
+DROP TABLE IF EXISTS event_reminders;
+ALTER TABLE event_reminders_new RENAME TO event_reminders;
@@ -0,0 +1,2 @@
+-- pkg/db/migrations/sqlite/000027_calendar_tokens.down.sql
+DROP TABLE IF EXISTS calendar_tokens;
@@ -0,0 +1,10 @@
+-- Secret tokens for per-user iCalendar feed URLs. Only a SHA-256 of the
+-- token is kept: the URL ends up in third-party calendar apps, and a leaked
+-- database shouldn't give out everyone's feed.
+CREATE TABLE IF NOT EXISTS calendar_tokens (
+  user_id      TEXT PRIMARY KEY,
+  token_hash   TEXT NOT NULL UNIQUE,
+  created_at   TEXT NOT NULL DEFAULT (datetime('now')),
+  last_used_at TEXT,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- pkg/db/migrations/sqlite/000028_event_timezones.down.sql
+ALTER TABLE users DROP COLUMN timezone;
+ALTER TABLE events DROP COLUMN timezone;
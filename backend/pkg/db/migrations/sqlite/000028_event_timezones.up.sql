@@ -0,0 +1,7 @@
+-- events.event_date is the UTC start from now on, and events.timezone the
+-- IANA zone it was scheduled in (recurring events follow its DST changes).
+-- Older events were stored without a zone and are taken as UTC.
+ALTER TABLE events ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- the zone a user sees times in; NULL = UTC
+ALTER TABLE users ADD COLUMN timezone TEXT;
@@ -0,0 +1,2 @@
+-- pkg/db/migrations/sqlite/000029_group_visibility.down.sql
+ALTER TABLE groups DROP COLUMN visibility;
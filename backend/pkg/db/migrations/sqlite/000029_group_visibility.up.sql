@@ -0,0 +1,5 @@
+-- Who can find and read a group:
+--   public:  anyone can read its messages, members and events, and join
+--   private: listed in discovery and search, joined by request (as before)
+--   secret:  invite only, hidden from anyone not in or invited to it
+ALTER TABLE groups ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private' CHECK (visibility IN ('public', 'private', 'secret'));
@@ -0,0 +1,3 @@
+-- pkg/db/migrations/sqlite/000030_group_permissions.down.sql
+UPDATE group_members SET role='member' WHERE role='moderator';
+DROP TABLE IF EXISTS group_role_permissions;
@@ -0,0 +1,11 @@
+-- What each role may do in a group, as set by its owner. A role and
+-- permission without a row here have the default (groupPermissionDefaults);
+-- owners may do everything. group_members.role can now also be 'moderator'.
+CREATE TABLE IF NOT EXISTS group_role_permissions (
+  group_id   INTEGER NOT NULL,
+  role       TEXT NOT NULL,            -- admin | moderator | member
+  permission TEXT NOT NULL,            -- post | create_events | invite | approve_joins | kick | moderate
+  allowed    INTEGER NOT NULL,
+  PRIMARY KEY (group_id, role, permission),
+  FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+-- pkg/db/migrations/sqlite/000031_group_settings.down.sql
+DROP TABLE IF EXISTS group_audit_log;
+ALTER TABLE groups DROP COLUMN updated_at;
+ALTER TABLE groups DROP COLUMN rules;
+ALTER TABLE groups DROP COLUMN cover_url;
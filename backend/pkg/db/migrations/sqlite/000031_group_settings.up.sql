@@ -0,0 +1,18 @@
+-- Groups get a cover image and rules, and can be edited after creation
+-- (by owners and whoever has the edit_group permission).
+ALTER TABLE groups ADD COLUMN cover_url TEXT;
+ALTER TABLE groups ADD COLUMN rules TEXT;
+ALTER TABLE groups ADD COLUMN updated_at TEXT;
+
+-- who changed what in a group, for its owner and admins
+CREATE TABLE IF NOT EXISTS group_audit_log (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  group_id   INTEGER NOT NULL,
+  actor_id   TEXT NOT NULL,
+  action     TEXT NOT NULL,            -- e.g. group_updated
+  details    TEXT,                     -- JSON
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_audit_log_group ON group_audit_log (group_id, id DESC);
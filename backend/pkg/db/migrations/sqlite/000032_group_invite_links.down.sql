@@ -0,0 +1,3 @@
+-- pkg/db/migrations/sqlite/000032_group_invite_links.down.sql
+DROP TABLE IF EXISTS group_invite_link_uses;
+DROP TABLE IF EXISTS group_invite_links;
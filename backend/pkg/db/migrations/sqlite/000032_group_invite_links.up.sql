@@ -0,0 +1,27 @@
+-- Shareable links that let anyone holding them join a group without waiting
+-- for approval. Only a hash of the token is kept, as for calendar feeds.
+CREATE TABLE IF NOT EXISTS group_invite_links (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  group_id   INTEGER NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_by TEXT NOT NULL,
+  expires_at TEXT,                     -- NULL: never
+  max_uses   INTEGER,                  -- NULL: unlimited
+  uses       INTEGER NOT NULL DEFAULT 0,
+  revoked_at TEXT,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_invite_links_group ON group_invite_links (group_id);
+
+-- who joined through which link, and when
+CREATE TABLE IF NOT EXISTS group_invite_link_uses (
+  id      INTEGER PRIMARY KEY AUTOINCREMENT,
+  link_id INTEGER NOT NULL,
+  user_id TEXT NOT NULL,
+  used_at TEXT NOT NULL DEFAULT (datetime('now')),
+  FOREIGN KEY (link_id) REFERENCES group_invite_links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_invite_link_uses_link ON group_invite_link_uses (link_id);
@@ -0,0 +1,2 @@
+-- pkg/db/migrations/sqlite/000033_group_bans.down.sql
+DROP TABLE IF EXISTS group_bans;
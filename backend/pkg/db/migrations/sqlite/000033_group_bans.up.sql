@@ -0,0 +1,12 @@
+-- Users kept out of a group: unlike a kick, a ban stops them asking to join
+-- again, being invited or using an invite link until it expires or is lifted.
+CREATE TABLE IF NOT EXISTS group_bans (
+  group_id   INTEGER NOT NULL,
+  user_id    TEXT NOT NULL,
+  banned_by  TEXT NOT NULL,
+  reason     TEXT,
+  expires_at TEXT,                     -- NULL: until lifted
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (group_id, user_id),
+  FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
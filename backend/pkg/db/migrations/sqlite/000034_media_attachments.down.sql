@@ -0,0 +1,2 @@
+-- pkg/db/migrations/sqlite/000034_media_attachments.down.sql
+DROP TABLE IF EXISTS media_attachments;
@@ -0,0 +1,32 @@
+-- Which uploads are used as an avatar or in a chat message. Only the
+-- uploader can attach a file, and only these rows (not the text of a
+-- message or profile) let anyone else see it.
+CREATE TABLE IF NOT EXISTS media_attachments (
+  id               INTEGER PRIMARY KEY AUTOINCREMENT,
+  name             TEXT NOT NULL,      -- media.name
+  user_id          TEXT,               -- as this user's avatar
+  dm_message_id    INTEGER,
+  group_message_id INTEGER,
+  created_at       TEXT NOT NULL DEFAULT (datetime('now')),
+  CHECK ((user_id IS NOT NULL) + (dm_message_id IS NOT NULL) + (group_message_id IS NOT NULL) = 1),
+  FOREIGN KEY (name) REFERENCES media(name) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (dm_message_id) REFERENCES dm_messages(id) ON DELETE CASCADE,
+  FOREIGN KEY (group_message_id) REFERENCES group_messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_attachments_name ON media_attachments (name);
+CREATE INDEX IF NOT EXISTS idx_media_attachments_dm ON media_attachments (dm_message_id);
+CREATE INDEX IF NOT EXISTS idx_media_attachments_group_message ON media_attachments (group_message_id);
+
+-- Existing avatars, and files linked in messages by their own uploader
+INSERT INTO media_attachments (name, user_id)
+SELECT m.name, u.id FROM users u JOIN media m ON u.avatar_url = '/uploads/' || m.name;
+
+INSERT INTO media_attachments (name, dm_message_id)
+SELECT m.name, dm.id FROM dm_messages dm
+JOIN media m ON m.owner_id = dm.sender_id AND instr(dm.body, '/uploads/' || m.name) > 0;
+
+INSERT INTO media_attachments (name, group_message_id)
+SELECT m.name, gm.id FROM group_messages gm
+JOIN media m ON m.owner_id = gm.sender_id AND instr(gm.body, '/uploads/' || m.name) > 0;
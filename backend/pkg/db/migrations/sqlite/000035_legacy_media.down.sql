@@ -0,0 +1,3 @@
+-- pkg/db/migrations/sqlite/000035_legacy_media.down.sql
+-- The backfilled media and media_attachments rows can't be told apart from
+-- later ones; 000034's down drops the attachments with the table.
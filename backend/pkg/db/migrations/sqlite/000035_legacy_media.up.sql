@@ -0,0 +1,52 @@
+-- Files uploaded before 000013 have no media row, so 000034 found nothing to
+-- attach for them and canViewMedia fell through to an owner check no one
+-- passes. Give them one, owned by the user whose avatar, post or message
+-- uses them (avatars and posts win over chat links), then attach them as
+-- 000034 does.
+
+-- Every /uploads/<name> link in chat messages. A name runs for as long as
+-- the characters stay ones upload names use (ltrim strips exactly those).
+CREATE TEMP TABLE legacy_chat_refs AS
+WITH RECURSIVE refs(kind, id, sender_id, rest, name) AS (
+  SELECT 'dm', id, sender_id, body, NULL FROM dm_messages WHERE instr(body, '/uploads/') > 0
+  UNION ALL
+  SELECT 'group', id, sender_id, body, NULL FROM group_messages WHERE instr(body, '/uploads/') > 0
+  UNION ALL
+  SELECT kind, id, sender_id,
+    substr(rest, instr(rest, '/uploads/') + 9),
+    rtrim(substr(substr(rest, instr(rest, '/uploads/') + 9), 1,
+      length(substr(rest, instr(rest, '/uploads/') + 9))
+      - length(ltrim(substr(rest, instr(rest, '/uploads/') + 9),
+        'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-.'))), '.')
+  FROM refs WHERE instr(rest, '/uploads/') > 0
+)
+SELECT DISTINCT kind, id, sender_id, name FROM refs WHERE name IS NOT NULL AND name <> '';
+
+INSERT OR IGNORE INTO media (name, owner_id)
+SELECT substr(avatar_url, 10), id FROM users WHERE avatar_url LIKE '/uploads/_%';
+
+INSERT OR IGNORE INTO media (name, owner_id)
+SELECT substr(image_url, 10), user_id FROM posts WHERE image_url LIKE '/uploads/_%';
+
+INSERT OR IGNORE INTO media (name, owner_id)
+SELECT name, sender_id FROM legacy_chat_refs;
+
+UPDATE media SET media_type='gif' WHERE content_type IS NULL AND lower(name) LIKE '%.gif';
+UPDATE media SET media_type='video'
+WHERE content_type IS NULL AND (lower(name) LIKE '%.mp4' OR lower(name) LIKE '%.webm');
+
+INSERT INTO media_attachments (name, user_id)
+SELECT m.name, u.id FROM users u JOIN media m ON u.avatar_url = '/uploads/' || m.name
+WHERE NOT EXISTS (SELECT 1 FROM media_attachments a WHERE a.name = m.name AND a.user_id = u.id);
+
+INSERT INTO media_attachments (name, dm_message_id)
+SELECT m.name, r.id FROM legacy_chat_refs r JOIN media m ON m.name = r.name AND m.owner_id = r.sender_id
+WHERE r.kind = 'dm'
+  AND NOT EXISTS (SELECT 1 FROM media_attachments a WHERE a.name = m.name AND a.dm_message_id = r.id);
+
+INSERT INTO media_attachments (name, group_message_id)
+SELECT m.name, r.id FROM legacy_chat_refs r JOIN media m ON m.name = r.name AND m.owner_id = r.sender_id
+WHERE r.kind = 'group'
+  AND NOT EXISTS (SELECT 1 FROM media_attachments a WHERE a.name = m.name AND a.group_message_id = r.id);
+
+DROP TABLE legacy_chat_refs;
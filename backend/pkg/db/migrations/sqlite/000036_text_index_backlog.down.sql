@@ -0,0 +1,2 @@
+-- pkg/db/migrations/sqlite/000036_text_index_backlog.down.sql
+DROP TABLE IF EXISTS text_index_backlog;
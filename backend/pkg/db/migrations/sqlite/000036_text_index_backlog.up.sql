@@ -0,0 +1,12 @@
+-- Posts and comments written before 000016 have no hashtag or mention rows.
+-- Queue every one for the server to index at startup (handlers.IndexBacklog
+-- needs the same parser as new posts, so it can't be done in SQL here).
+CREATE TABLE IF NOT EXISTS text_index_backlog (
+  post_id    INTEGER NOT NULL,
+  comment_id INTEGER                      -- null: the post body
+);
+
+INSERT INTO text_index_backlog (post_id, comment_id)
+SELECT id, NULL FROM posts
+UNION ALL
+SELECT post_id, id FROM comments;
@@ -0,0 +1,2 @@
+-- pkg/db/migrations/sqlite/000037_web_push_preference.down.sql
+-- SQLite can't drop columns easily; leaving notification_preferences.web_push.
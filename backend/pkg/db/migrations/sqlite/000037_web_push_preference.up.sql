@@ -0,0 +1,3 @@
+-- Web Push (browsers and phones, while offline) gets its own switch, apart
+-- from the live WebSocket push.
+ALTER TABLE notification_preferences ADD COLUMN web_push INTEGER NOT NULL DEFAULT 1;
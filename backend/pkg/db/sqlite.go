@@ -31,6 +31,10 @@ func Open(dbPath string) (*sql.DB, error) {
 	if _, err := db.Exec(`PRAGMA foreign_keys = ON;`); err != nil {
 		return nil, err
 	}
+	if err := checkFTS5(db); err != nil {
+		db.Close()
+		return nil, err
+	}
 	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations(version TEXT PRIMARY KEY, applied_at TEXT NOT NULL)`); err != nil {
 		return nil, err
 	}
@@ -40,6 +44,20 @@ func Open(dbPath string) (*sql.DB, error) {
 	return db, nil
 }
 
+// checkFTS5 fails early when go-sqlite3 was built without the fts5 module
+// (the sqlite_fts5 build tag), which search needs: an already migrated
+// database would otherwise open fine and only break on the first search.
+func checkFTS5(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS temp.fts5_check USING fts5(x)`); err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return fmt.Errorf("sqlite has no fts5 module: build with -tags sqlite_fts5")
+		}
+		return err
+	}
+	_, err := db.Exec(`DROP TABLE temp.fts5_check`)
+	return err
+}
+
 type migFile struct {
 	name    string // e.g. 000001_create_users.up.sql
 	version string // e.g. 000001
@@ -114,6 +132,9 @@ func applyMigrations(db *sql.DB) error {
 			}
 			if _, err := tx.Exec(stmt); err != nil {
 				_ = tx.Rollback()
+				if strings.Contains(err.Error(), "no such module: fts5") {
+					return fmt.Errorf("migration %s failed: %w (build with -tags sqlite_fts5)", f.name, err)
+				}
 				return fmt.Errorf("migration %s failed: %w", f.name, err)
 			}
 		}
@@ -132,18 +153,35 @@ func applyMigrations(db *sql.DB) error {
 	return nil
 }
 
+// splitSQL cuts a migration into statements at lines ending in ';'.
+// A CREATE TRIGGER body has its own ';'s, so it runs until a line "END;".
 func splitSQL(s string) []string {
 	var out []string
 	sc := bufio.NewScanner(strings.NewReader(s))
 	sc.Split(bufio.ScanLines)
 	var b strings.Builder
+	started, inTrigger := false, false
 	for sc.Scan() {
 		line := sc.Text()
+		trimmed := strings.ToUpper(strings.TrimSpace(line))
+		if !started && trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			started = true
+			inTrigger = strings.HasPrefix(trimmed, "CREATE TRIGGER")
+		}
 		b.WriteString(line)
 		b.WriteString("\n")
+		if inTrigger {
+			if trimmed == "END;" {
+				out = append(out, b.String())
+				b.Reset()
+				started, inTrigger = false, false
+			}
+			continue
+		}
 		if strings.HasSuffix(strings.TrimSpace(line), ";") {
 			out = append(out, b.String())
 			b.Reset()
+			started = false
 		}
 	}
 	if strings.TrimSpace(b.String()) != "" {
@@ -39,8 +39,17 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	hash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if req.AvatarURL != nil && *req.AvatarURL == "" {
+		req.AvatarURL = nil
+	}
 	id := uuid.New().String()
-	_, err := h.DB.Exec(
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, http.StatusInternalServerError, "db")
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(
 		`INSERT INTO users(id,email,password_hash,first_name,last_name,dob,avatar_url,nickname,about,is_private,created_at)
          VALUES(?,?,?,?,?,?,?,?,?,0,datetime('now'))`,
 		id, req.Email, string(hash), req.FirstName, req.LastName, req.DOB, req.AvatarURL, req.Nickname, req.About,
@@ -49,6 +58,21 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Err(w, http.StatusBadRequest, "email exists?")
 		return
 	}
+	if req.AvatarURL != nil {
+		ok, err := claimAvatar(tx, id, *req.AvatarURL)
+		if err != nil {
+			Err(w, http.StatusInternalServerError, "db")
+			return
+		}
+		if !ok {
+			Err(w, http.StatusBadRequest, "avatarUrl must be an image you uploaded")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, http.StatusInternalServerError, "db")
+		return
+	}
 	_ = auth.CreateSession(h.DB, id, w)
 	JSON(w, 200, map[string]string{"id": id})
 }
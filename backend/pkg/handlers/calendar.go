@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/ical"
+)
+
+// CalendarHandler exports group events as iCalendar: one event as a .ics
+// download, or everything from a user's groups as a feed calendar apps
+// subscribe to. The feed URL carries a secret token instead of a session.
+type CalendarHandler struct {
+	DB     *sql.DB
+	AppURL string // frontend base URL, linked from events
+	APIURL string // public base URL of this server for feed links; "" = from the request
+}
+
+// feedPast is how far back the feed lists one-off events.
+const feedPast = 180 * 24 * time.Hour
+
+const calendarProdID = "-//Social Network//Group Events//EN"
+
+var partStats = map[string]string{
+	"going":      "ACCEPTED",
+	"maybe":      "TENTATIVE",
+	"not_going":  "DECLINED",
+	"waitlisted": "NEEDS-ACTION",
+}
+
+// GET /api/events/ics?eventId=123 -> event-123.ics
+func (h *CalendarHandler) Event(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	eventID, err := strconv.ParseInt(r.URL.Query().Get("eventId"), 10, 64)
+	if err != nil {
+		Err(w, 400, "eventId required")
+		return
+	}
+	var groupID int64
+	if err := h.DB.QueryRow(`SELECT group_id FROM events WHERE id=?`, eventID).Scan(&groupID); err != nil {
+		Err(w, 404, "event not found")
+		return
+	}
+	if code, msg := groupReadDenied(h.DB, groupID, u.ID); code != 0 {
+		Err(w, code, msg)
+		return
+	}
+
+	events, err := h.calendarEvents(u.ID, `e.id = ?`, eventID)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="event-%d.ics"`, eventID))
+	cal := ical.Calendar{ProdID: calendarProdID, Events: events}
+	_, _ = cal.WriteTo(w)
+}
+
+// GET    /api/calendar/token -> {active, createdAt?, lastUsedAt?}
+// POST   /api/calendar/token -> {url, webcalUrl}: a new feed URL; the old one stops working
+// DELETE /api/calendar/token: revoke the feed URL
+// The URL is only shown when it is created.
+func (h *CalendarHandler) Token(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var createdAt string
+		var lastUsedAt *string
+		err := h.DB.QueryRow(`SELECT created_at, last_used_at FROM calendar_tokens WHERE user_id=?`, u.ID).Scan(&createdAt, &lastUsedAt)
+		if err == sql.ErrNoRows {
+			JSON(w, 200, map[string]any{"active": false})
+			return
+		}
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		JSON(w, 200, map[string]any{"active": true, "createdAt": createdAt, "lastUsedAt": lastUsedAt})
+
+	case http.MethodPost:
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			Err(w, 500, "token")
+			return
+		}
+		token := base64.RawURLEncoding.EncodeToString(b)
+		if _, err := h.DB.Exec(`
+INSERT INTO calendar_tokens (user_id, token_hash) VALUES (?, ?)
+ON CONFLICT (user_id) DO UPDATE SET token_hash=excluded.token_hash, created_at=datetime('now'), last_used_at=NULL`,
+			u.ID, tokenHash(token)); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		feed := h.baseURL(r) + "/api/calendar/feed/" + token + ".ics"
+		JSON(w, 200, map[string]any{
+			"url":       feed,
+			"webcalUrl": "webcal://" + strings.SplitN(feed, "://", 2)[1],
+		})
+
+	case http.MethodDelete:
+		if _, err := h.DB.Exec(`DELETE FROM calendar_tokens WHERE user_id=?`, u.ID); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		JSON(w, 200, map[string]any{"ok": true})
+
+	default:
+		Err(w, 405, "method")
+	}
+}
+
+// GET /api/calendar/feed/<token>.ics
+// Events of every group the token's owner belongs to: one-off events from
+// the last 180 days on, and all recurring series. Their own responses are
+// included as ATTENDEE status.
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		Err(w, 405, "method")
+		return
+	}
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/calendar/feed/"), ".ics")
+	var userID string
+	if token == "" || h.DB.QueryRow(`SELECT user_id FROM calendar_tokens WHERE token_hash=?`, tokenHash(token)).Scan(&userID) != nil {
+		Err(w, 404, "not found")
+		return
+	}
+	_, _ = h.DB.Exec(`UPDATE calendar_tokens SET last_used_at=datetime('now') WHERE user_id=?`, userID)
+
+	events, err := h.calendarEvents(userID, `
+e.group_id IN (SELECT group_id FROM group_members WHERE user_id = ? AND status = 'accepted')
+AND (e.recurrence IS NOT NULL OR e.event_date >= ?)`,
+		userID, time.Now().UTC().Add(-feedPast).Format(eventDateLayout))
+	if err != nil {
+		log.Println("calendar feed:", err)
+		Err(w, 500, "db")
+		return
+	}
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	cal := ical.Calendar{ProdID: calendarProdID, Name: "Social Network events", Events: events}
+	_, _ = cal.WriteTo(w)
+}
+
+// calendarEvents builds the VEVENTs for events e matching where, with
+// userID's responses: on the event itself for one-off events, and as
+// overrides of the occurrences they answered for recurring ones.
+func (h *CalendarHandler) calendarEvents(userID, where string, args ...any) ([]ical.Event, error) {
+	var name, email string
+	if err := h.DB.QueryRow(`SELECT `+displayNameSQL+`, u.email FROM users u WHERE u.id=?`, userID).Scan(&name, &email); err != nil {
+		return nil, err
+	}
+
+	rows, err := h.DB.Query(`
+SELECT e.id, e.title, e.description, e.event_date, e.timezone, e.recurrence, e.status, e.cancel_reason,
+       e.created_at, COALESCE(e.updated_at, e.created_at), g.title
+FROM events e JOIN groups g ON g.id = e.group_id
+WHERE `+where+`
+ORDER BY e.event_date`, args...)
+	if err != nil {
+		return nil, err
+	}
+	type row struct {
+		id                           int64
+		title, date, zone, status    string
+		group                        string
+		description, recurrence, why *string
+		created, updated             string
+	}
+	var list []row
+	for rows.Next() {
+		var e row
+		if err := rows.Scan(&e.id, &e.title, &e.description, &e.date, &e.zone, &e.recurrence, &e.status, &e.why,
+			&e.created, &e.updated, &e.group); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	host := "social-network"
+	if u, err := url.Parse(h.AppURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	out := []ical.Event{}
+	for _, e := range list {
+		start, err := time.Parse(eventDateLayout, e.date)
+		if err != nil {
+			continue
+		}
+		// a series is written in its own zone so calendars follow its DST
+		// changes; occurrences are named by their UTC start
+		loc := time.UTC
+		if e.recurrence != nil {
+			loc = eventLocation(e.zone)
+			start = start.In(loc)
+		}
+		ev := ical.Event{
+			UID:          fmt.Sprintf("event-%d@%s", e.id, host),
+			Start:        start,
+			Summary:      e.title,
+			Description:  "Group: " + e.group,
+			URL:          h.AppURL + "/groups",
+			Status:       "CONFIRMED",
+			Created:      sqliteTime(e.created),
+			LastModified: sqliteTime(e.updated),
+		}
+		if e.description != nil && *e.description != "" {
+			ev.Description = *e.description + "\n\n" + ev.Description
+		}
+		if e.status == "cancelled" {
+			ev.Status = "CANCELLED"
+			if e.why != nil {
+				ev.Description = "Cancelled: " + *e.why + "\n\n" + ev.Description
+			}
+		}
+		if e.recurrence != nil {
+			ev.RRule = *e.recurrence
+		}
+
+		skipped := map[string]bool{}
+		if e.recurrence != nil {
+			exceptions, err := h.DB.Query(`SELECT occurrence FROM event_exceptions WHERE event_id=? ORDER BY occurrence`, e.id)
+			if err != nil {
+				return nil, err
+			}
+			for exceptions.Next() {
+				var occ string
+				if exceptions.Scan(&occ) != nil {
+					continue
+				}
+				if t, err := time.Parse(eventDateLayout, occ); err == nil {
+					ev.ExDates = append(ev.ExDates, t.In(loc))
+					skipped[occ] = true
+				}
+			}
+			exceptions.Close()
+		}
+
+		responses, err := h.DB.Query(`SELECT occurrence, response FROM event_responses WHERE event_id=? AND user_id=? ORDER BY occurrence`,
+			e.id, userID)
+		if err != nil {
+			return nil, err
+		}
+		var overrides []ical.Event
+		for responses.Next() {
+			var occ, response string
+			if err := responses.Scan(&occ, &response); err != nil {
+				responses.Close()
+				return nil, err
+			}
+			me := []ical.Attendee{{Name: name, Email: email, PartStat: partStats[response]}}
+			if occ == "" {
+				ev.Attendees = me
+				continue
+			}
+			t, err := time.Parse(eventDateLayout, occ)
+			if err != nil || skipped[occ] {
+				continue
+			}
+			o := ev
+			o.RRule, o.ExDates = "", nil
+			o.Start, o.RecurrenceID = t.In(loc), t.In(loc)
+			o.Attendees = me
+			overrides = append(overrides, o)
+		}
+		responses.Close()
+
+		out = append(out, ev)
+		out = append(out, overrides...)
+	}
+	return out, nil
+}
+
+// baseURL is where this server is reached from outside: APIURL, or else
+// what the request came in on (behind a proxy, X-Forwarded-*).
+func (h *CalendarHandler) baseURL(r *http.Request) string {
+	if h.APIURL != "" {
+		return strings.TrimSuffix(h.APIURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	host := r.Host
+	if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+		host = fwd
+	}
+	return scheme + "://" + host
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sqliteTime parses a datetime('now') value; zero if it can't.
+func sqliteTime(s string) time.Time {
+	t, _ := time.Parse("2006-01-02 15:04:05", s)
+	return t
+}
@@ -13,8 +13,9 @@ import (
 )
 
 type DMHandler struct {
-	DB  *sql.DB
-	Hub *ws.Hub
+	DB       *sql.DB
+	Hub      *ws.Hub
+	Notifier *Notifier
 }
 
 type DMMessage struct {
@@ -93,13 +94,27 @@ func (h *DMHandler) Send(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := h.DB.Exec(`INSERT INTO dm_messages (sender_id, recipient_id, body, created_at)
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO dm_messages (sender_id, recipient_id, body, created_at)
 		VALUES (?,?,?, datetime('now'))`, u.ID, body.To, body.Body)
 	if err != nil {
 		Err(w, 500, "db")
 		return
 	}
 	id, _ := res.LastInsertId()
+	if err := attachChatMedia(tx, "dm_message_id", id, u.ID, body.Body); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
 
 	msg := DMMessage{
 		ID: id, SenderID: u.ID, RecipientID: body.To, Body: body.Body,
@@ -118,12 +133,7 @@ func (h *DMHandler) Send(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 	// Optional: also nudge recipient on their user channel
-	if h.Hub != nil {
-		h.Hub.Broadcast("user:"+body.To, ws.Message{
-			Type:    "notification",
-			Payload: map[string]any{"type": "dm", "from": u.ID},
-		})
-	}
+	h.Notifier.NotifyDM(body.To, u.ID)
 }
 
 // GET /api/dm/partners - returns users I've chatted with recently
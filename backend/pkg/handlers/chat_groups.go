@@ -8,12 +8,15 @@ import (
 	"time"
 
 	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/storage"
 	"social-network/backend/pkg/ws"
 )
 
 type GroupHandler struct {
-	DB  *sql.DB
-	Hub *ws.Hub
+	DB       *sql.DB
+	Hub      *ws.Hub
+	Notifier *Notifier
+	Store    storage.MediaStore // used to clean up media of deleted groups
 }
 
 type Group struct {
@@ -21,6 +24,8 @@ type Group struct {
 	Title       string  `json:"title"`
 	Description *string `json:"description,omitempty"`
 	OwnerID     string  `json:"ownerId"`
+	Visibility  string  `json:"visibility"` // public | private | secret
+	CoverURL    *string `json:"coverUrl,omitempty"`
 	CreatedAt   string  `json:"createdAt"`
 }
 
@@ -32,7 +37,8 @@ type GroupMessage struct {
 	CreatedAt string `json:"createdAt"`
 }
 
-// POST /api/groups/create {title, description}
+// POST /api/groups/create {title, description, visibility?: public|private|secret}
+// Groups are private unless asked otherwise.
 func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -46,13 +52,21 @@ func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var b struct {
 		Title       string
 		Description *string
+		Visibility  string
 	}
 	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.Title == "" {
 		Err(w, 400, "bad json")
 		return
 	}
-	res, err := h.DB.Exec(`INSERT INTO groups (owner_id, title, description) VALUES (?,?,?)`,
-		u.ID, b.Title, b.Description)
+	if b.Visibility == "" {
+		b.Visibility = groupPrivate
+	}
+	if !validGroupVisibility(b.Visibility) {
+		Err(w, 400, "visibility must be public, private or secret")
+		return
+	}
+	res, err := h.DB.Exec(`INSERT INTO groups (owner_id, title, description, visibility) VALUES (?,?,?,?)`,
+		u.ID, b.Title, b.Description, b.Visibility)
 	if err != nil {
 		Err(w, 500, "db")
 		return
@@ -71,7 +85,7 @@ func (h *GroupHandler) MyGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rows, err := h.DB.Query(`
-SELECT g.id, g.title, g.description, g.owner_id, g.created_at
+SELECT g.id, g.title, g.description, g.owner_id, g.visibility, g.cover_url, g.created_at
 FROM groups g
 JOIN group_members m ON m.group_id = g.id AND m.user_id=? AND m.status='accepted'
 ORDER BY datetime(g.created_at) DESC`, u.ID)
@@ -83,14 +97,14 @@ ORDER BY datetime(g.created_at) DESC`, u.ID)
 	out := []Group{}
 	for rows.Next() {
 		var g Group
-		if err := rows.Scan(&g.ID, &g.Title, &g.Description, &g.OwnerID, &g.CreatedAt); err == nil {
+		if err := rows.Scan(&g.ID, &g.Title, &g.Description, &g.OwnerID, &g.Visibility, &g.CoverURL, &g.CreatedAt); err == nil {
 			out = append(out, g)
 		}
 	}
 	JSON(w, 200, out)
 }
 
-// GET /api/groups/messages?groupId=123&limit=10
+// GET /api/groups/messages?groupId=123&limit=10 (members, or anyone for a public group)
 func (h *GroupHandler) History(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -104,11 +118,8 @@ func (h *GroupHandler) History(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// (Optional) ensure user is a member:
-	var n int
-	_ = h.DB.QueryRow(`SELECT COUNT(*) FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, gid, u.ID).Scan(&n)
-	if n == 0 {
-		Err(w, 403, "not a member")
+	if code, msg := groupReadDenied(h.DB, gid, u.ID); code != 0 {
+		Err(w, code, msg)
 		return
 	}
 
@@ -145,7 +156,7 @@ ORDER BY datetime(created_at) DESC LIMIT ? OFFSET ?`, gid, limit, offset)
 	JSON(w, 200, out)
 }
 
-// POST /api/groups/send {groupId, body}
+// POST /api/groups/send {groupId, body} (post)
 func (h *GroupHandler) Send(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -164,21 +175,32 @@ func (h *GroupHandler) Send(w http.ResponseWriter, r *http.Request) {
 		Err(w, 400, "bad json")
 		return
 	}
-	// (Optional) check membership
-	var n int
-	_ = h.DB.QueryRow(`SELECT COUNT(*) FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, b.GroupId, u.ID).Scan(&n)
-	if n == 0 {
-		Err(w, 403, "not a member")
+	if _, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permPost); !ok {
+		Err(w, 403, "not allowed to post")
 		return
 	}
 
-	res, err := h.DB.Exec(`INSERT INTO group_messages(group_id, sender_id, body, created_at)
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO group_messages(group_id, sender_id, body, created_at)
 		VALUES (?,?,?, datetime('now'))`, b.GroupId, u.ID, b.Body)
 	if err != nil {
 		Err(w, 500, "db")
 		return
 	}
 	id, _ := res.LastInsertId()
+	if err := attachChatMedia(tx, "group_message_id", id, u.ID, b.Body); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
 
 	msg := GroupMessage{
 		ID: id, GroupID: b.GroupId, SenderID: u.ID, Body: b.Body,
@@ -192,7 +214,7 @@ func (h *GroupHandler) Send(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GET /api/groups/members?groupId=123
+// GET /api/groups/members?groupId=123 (members, or anyone for a public group)
 func (h *GroupHandler) Members(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -206,11 +228,8 @@ func (h *GroupHandler) Members(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is a member
-	var n int
-	_ = h.DB.QueryRow(`SELECT COUNT(*) FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, gid, u.ID).Scan(&n)
-	if n == 0 {
-		Err(w, 403, "not a member")
+	if code, msg := groupReadDenied(h.DB, gid, u.ID); code != 0 {
+		Err(w, code, msg)
 		return
 	}
 
@@ -222,7 +241,8 @@ ORDER BY
   CASE m.role 
     WHEN 'owner' THEN 1 
     WHEN 'admin' THEN 2 
-    ELSE 3 
+    WHEN 'moderator' THEN 3 
+    ELSE 4 
   END, 
   datetime(m.created_at) ASC`, gid)
 	if err != nil {
@@ -248,7 +268,7 @@ ORDER BY
 	JSON(w, 200, out)
 }
 
-// POST /api/groups/invite {groupId, userId}
+// POST /api/groups/invite {groupId, userId} (invite)
 func (h *GroupHandler) Invite(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -269,11 +289,8 @@ func (h *GroupHandler) Invite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if requester is admin/owner
-	var role string
-	err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, b.GroupId, u.ID).Scan(&role)
-	if err != nil || (role != "owner" && role != "admin") {
-		Err(w, 403, "not admin")
+	if _, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permInvite); !ok {
+		Err(w, 403, "not allowed to invite")
 		return
 	}
 
@@ -284,6 +301,10 @@ func (h *GroupHandler) Invite(w http.ResponseWriter, r *http.Request) {
 		Err(w, 409, "already member or invited")
 		return
 	}
+	if groupBanned(h.DB, b.GroupId, b.UserId) {
+		Err(w, 403, "user is banned from this group")
+		return
+	}
 
 	// Add user as invited
 	_, err = h.DB.Exec(`INSERT INTO group_members (group_id, user_id, role, status) VALUES (?, ?, 'member', 'invited')`, b.GroupId, b.UserId)
@@ -301,6 +322,7 @@ func (h *GroupHandler) Invite(w http.ResponseWriter, r *http.Request) {
 			Payload: map[string]any{"groupId": b.GroupId, "invitedBy": u.ID},
 		})
 	}
+	h.Notifier.Notify(Note{Type: "group_invite", UserID: b.UserId, ActorID: u.ID, GroupID: b.GroupId})
 }
 
 // POST /api/groups/join {groupId} - accept invitation
@@ -360,9 +382,8 @@ func (h *GroupHandler) Leave(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user is owner (owners can't leave, must transfer ownership first)
-	var role string
-	err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, b.GroupId, u.ID).Scan(&role)
-	if err != nil {
+	role, ok := groupRole(h.DB, b.GroupId, u.ID)
+	if !ok {
 		Err(w, 404, "not a member")
 		return
 	}
@@ -379,6 +400,7 @@ func (h *GroupHandler) Leave(w http.ResponseWriter, r *http.Request) {
 	}
 
 	JSON(w, 200, map[string]any{"ok": true})
+	recheckRoom(h.DB, h.Hub, "group:"+strconv.FormatInt(b.GroupId, 10))
 }
 
 // GET /api/groups/invitations - get pending invitations for current user
@@ -390,7 +412,7 @@ func (h *GroupHandler) PendingInvitations(w http.ResponseWriter, r *http.Request
 	}
 
 	rows, err := h.DB.Query(`
-SELECT g.id, g.title, g.description, g.owner_id, g.created_at
+SELECT g.id, g.title, g.description, g.owner_id, g.visibility, g.cover_url, g.created_at
 FROM groups g
 JOIN group_members m ON m.group_id = g.id AND m.user_id=? AND m.status='invited'
 ORDER BY datetime(g.created_at) DESC`, u.ID)
@@ -402,14 +424,15 @@ ORDER BY datetime(g.created_at) DESC`, u.ID)
 	out := []Group{}
 	for rows.Next() {
 		var g Group
-		if err := rows.Scan(&g.ID, &g.Title, &g.Description, &g.OwnerID, &g.CreatedAt); err == nil {
+		if err := rows.Scan(&g.ID, &g.Title, &g.Description, &g.OwnerID, &g.Visibility, &g.CoverURL, &g.CreatedAt); err == nil {
 			out = append(out, g)
 		}
 	}
 	JSON(w, 200, out)
 }
 
-// GET /api/groups/discover - browse all groups with member counts and ability to join
+// GET /api/groups/discover - browse groups with member counts and ability to join;
+// secret groups only show up for their members and invitees
 func (h *GroupHandler) Discover(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -421,7 +444,7 @@ func (h *GroupHandler) Discover(w http.ResponseWriter, r *http.Request) {
 	limit := 20
 
 	baseSQL := `
-SELECT g.id, g.title, g.description, g.owner_id, g.created_at,
+SELECT g.id, g.title, g.description, g.owner_id, g.visibility, g.cover_url, g.created_at,
        COUNT(m.user_id) as member_count,
        CASE WHEN my_membership.user_id IS NOT NULL THEN my_membership.status ELSE 'none' END as my_status
 FROM groups g
@@ -429,18 +452,21 @@ LEFT JOIN group_members m ON m.group_id = g.id AND m.status = 'accepted'
 LEFT JOIN group_members my_membership ON my_membership.group_id = g.id AND my_membership.user_id = ?
 `
 
-	params := []any{u.ID}
-	whereClause := " WHERE 1=1 "
+	params := []any{u.ID, u.ID}
+	whereClause := " WHERE " + visibleGroupSQL
+	orderBy := "member_count DESC, g.created_at DESC"
 
-	if query != "" {
-		whereClause += " AND (g.title LIKE ? OR g.description LIKE ?) "
-		likeQuery := "%" + query + "%"
-		params = append(params, likeQuery, likeQuery)
+	// bm25() can't run inside the aggregate, so rank the matches first
+	if match := ftsQuery(query); match != "" {
+		baseSQL = "WITH s AS MATERIALIZED (SELECT rowid AS id, bm25(groups_fts, 3.0, 1.0) AS rank FROM groups_fts WHERE groups_fts MATCH ?)" +
+			baseSQL + "JOIN s ON s.id = g.id\n"
+		params = append([]any{match}, params...)
+		orderBy = "s.rank, " + orderBy
 	}
 
 	groupByOrderLimit := `
-GROUP BY g.id, g.title, g.description, g.owner_id, g.created_at, my_membership.status
-ORDER BY member_count DESC, g.created_at DESC
+GROUP BY g.id, g.title, g.description, g.owner_id, g.visibility, g.cover_url, g.created_at, my_membership.status
+ORDER BY ` + orderBy + `
 LIMIT ?`
 	params = append(params, limit)
 
@@ -462,7 +488,7 @@ LIMIT ?`
 	out := []GroupWithMeta{}
 	for rows.Next() {
 		var g GroupWithMeta
-		if err := rows.Scan(&g.ID, &g.Title, &g.Description, &g.OwnerID, &g.CreatedAt, &g.MemberCount, &g.MyStatus); err == nil {
+		if err := rows.Scan(&g.ID, &g.Title, &g.Description, &g.OwnerID, &g.Visibility, &g.CoverURL, &g.CreatedAt, &g.MemberCount, &g.MyStatus); err == nil {
 			out = append(out, g)
 		}
 	}
@@ -470,6 +496,8 @@ LIMIT ?`
 }
 
 // POST /api/groups/request-join {groupId} - request to join a group
+// A public group is joined right away ("status": "accepted"); a private one
+// waits for an admin ("status": "requested"). Secret groups are invite only.
 func (h *GroupHandler) RequestJoin(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -489,6 +517,12 @@ func (h *GroupHandler) RequestJoin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var visibility string
+	if err := h.DB.QueryRow(`SELECT visibility FROM groups WHERE id=?`, b.GroupId).Scan(&visibility); err != nil {
+		Err(w, 404, "group not found")
+		return
+	}
+
 	// Check if user already has a relationship with this group
 	var existing int
 	_ = h.DB.QueryRow(`SELECT COUNT(*) FROM group_members WHERE group_id=? AND user_id=?`, b.GroupId, u.ID).Scan(&existing)
@@ -496,51 +530,35 @@ func (h *GroupHandler) RequestJoin(w http.ResponseWriter, r *http.Request) {
 		Err(w, 409, "already member or has pending request")
 		return
 	}
+	if visibility == groupSecret {
+		Err(w, 404, "group not found")
+		return
+	}
+	if groupBanned(h.DB, b.GroupId, u.ID) {
+		Err(w, 403, "banned from this group")
+		return
+	}
 
-	// Add user as requesting to join
-	_, err = h.DB.Exec(`INSERT INTO group_members (group_id, user_id, role, status) VALUES (?, ?, 'member', 'requested')`, b.GroupId, u.ID)
+	status := "requested"
+	if visibility == groupPublic {
+		status = "accepted"
+	}
+	_, err = h.DB.Exec(`INSERT INTO group_members (group_id, user_id, role, status) VALUES (?, ?, 'member', ?)`, b.GroupId, u.ID, status)
 	if err != nil {
 		Err(w, 500, "db")
 		return
 	}
 
-	JSON(w, 200, map[string]any{"ok": true})
-
-	// Notify group owner and admins about the join request
-	// Get owner and admins
-	rows, err := h.DB.Query(`SELECT user_id FROM group_members WHERE group_id = ? AND role IN ('owner', 'admin') AND status = 'accepted'`, b.GroupId)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var adminId string
-			if rows.Scan(&adminId) == nil {
-				// Store notification in database
-				res, _ := h.DB.Exec(
-					`INSERT INTO notifications (user_id, type, actor_id, created_at)
-					VALUES (?, 'group_join_request', ?, datetime('now'))`,
-					adminId, u.ID,
-				)
-
-				// Send real-time notification
-				if h.Hub != nil && res != nil {
-					id, _ := res.LastInsertId()
-					h.Hub.Broadcast("user:"+adminId, ws.Message{
-						Type: "notification",
-						Payload: map[string]any{
-							"id":        id,
-							"type":      "group_join_request",
-							"actorId":   u.ID,
-							"groupId":   b.GroupId,
-							"createdAt": time.Now().UTC().Format("2006-01-02 15:04:05"),
-						},
-					})
-				}
-			}
-		}
+	JSON(w, 200, map[string]any{"ok": true, "status": status})
+	if status == "accepted" {
+		return
 	}
+
+	// Notify whoever can approve it
+	h.Notifier.NotifyAll(groupUsersWith(h.DB, b.GroupId, permApproveJoins), Note{Type: "group_join_request", ActorID: u.ID, GroupID: b.GroupId})
 }
 
-// POST /api/groups/approve-join {groupId, userId} - approve join request (admin/owner only)
+// POST /api/groups/approve-join {groupId, userId} - approve join request (approve_joins)
 func (h *GroupHandler) ApproveJoin(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -561,11 +579,8 @@ func (h *GroupHandler) ApproveJoin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if requester is admin/owner
-	var role string
-	err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, b.GroupId, u.ID).Scan(&role)
-	if err != nil || (role != "owner" && role != "admin") {
-		Err(w, 403, "not admin")
+	if _, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permApproveJoins); !ok {
+		Err(w, 403, "not allowed to approve joins")
 		return
 	}
 
@@ -585,30 +600,11 @@ func (h *GroupHandler) ApproveJoin(w http.ResponseWriter, r *http.Request) {
 	JSON(w, 200, map[string]any{"ok": true})
 
 	// Notify approved user
-	// Store notification in database
-	res, _ = h.DB.Exec(
-		`INSERT INTO notifications (user_id, type, actor_id, created_at)
-		VALUES (?, 'group_join_approved', ?, datetime('now'))`,
-		b.UserId, u.ID,
-	)
-
-	// Send real-time notification
-	if h.Hub != nil && res != nil {
-		id, _ := res.LastInsertId()
-		h.Hub.Broadcast("user:"+b.UserId, ws.Message{
-			Type: "notification",
-			Payload: map[string]any{
-				"id":        id,
-				"type":      "group_join_approved",
-				"actorId":   u.ID,
-				"groupId":   b.GroupId,
-				"createdAt": time.Now().UTC().Format("2006-01-02 15:04:05"),
-			},
-		})
-	}
+	h.Notifier.Notify(Note{Type: "group_join_approved", UserID: b.UserId, ActorID: u.ID, GroupID: b.GroupId})
 }
 
-// POST /api/groups/promote {groupId, userId} - promote member to admin (owner only)
+// POST /api/groups/promote {groupId, userId, role?: admin|moderator} - promote a
+// member (or a moderator, to admin); admin unless said otherwise (owner only)
 func (h *GroupHandler) Promote(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -623,37 +619,41 @@ func (h *GroupHandler) Promote(w http.ResponseWriter, r *http.Request) {
 	var b struct {
 		GroupId int64  `json:"groupId"`
 		UserId  string `json:"userId"`
+		Role    string `json:"role"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 || b.UserId == "" {
 		Err(w, 400, "bad json")
 		return
 	}
+	if b.Role == "" {
+		b.Role = "admin"
+	}
+	if b.Role != "admin" && b.Role != "moderator" {
+		Err(w, 400, "role must be admin or moderator")
+		return
+	}
 
-	// Check if requester is owner
-	var role string
-	err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, b.GroupId, u.ID).Scan(&role)
-	if err != nil || role != "owner" {
+	if _, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permManageGroup); !ok {
 		Err(w, 403, "only owner can promote")
 		return
 	}
 
-	// Promote user to admin
-	res, err := h.DB.Exec(`UPDATE group_members SET role='admin' WHERE group_id=? AND user_id=? AND status='accepted' AND role='member'`, b.GroupId, b.UserId)
-	if err != nil {
-		Err(w, 500, "db")
+	// Promote user; only ever upwards
+	current, ok := groupRole(h.DB, b.GroupId, b.UserId)
+	if !ok || roleRank[current] >= roleRank[b.Role] {
+		Err(w, 404, "user not found or already "+b.Role)
 		return
 	}
-
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
-		Err(w, 404, "user not found or already admin")
+	_, err = h.DB.Exec(`UPDATE group_members SET role=? WHERE group_id=? AND user_id=? AND status='accepted'`, b.Role, b.GroupId, b.UserId)
+	if err != nil {
+		Err(w, 500, "db")
 		return
 	}
 
 	JSON(w, 200, map[string]any{"ok": true})
 }
 
-// GET /api/groups/join-requests?groupId=123 - get pending join requests (admin/owner only)
+// GET /api/groups/join-requests?groupId=123 - get pending join requests (approve_joins)
 func (h *GroupHandler) PendingJoinRequests(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -667,11 +667,8 @@ func (h *GroupHandler) PendingJoinRequests(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Check if requester is admin/owner
-	var role string
-	err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, groupId, u.ID).Scan(&role)
-	if err != nil || (role != "owner" && role != "admin") {
-		Err(w, 403, "not admin")
+	if _, ok := groupAuthorize(h.DB, groupId, u.ID, permApproveJoins); !ok {
+		Err(w, 403, "not allowed to approve joins")
 		return
 	}
 
@@ -705,7 +702,7 @@ ORDER BY datetime(gm.created_at) ASC`, groupId)
 	JSON(w, 200, out)
 }
 
-// POST /api/groups/reject-join {groupId, userId} - reject join request (admin/owner only)
+// POST /api/groups/reject-join {groupId, userId} - reject join request (approve_joins)
 func (h *GroupHandler) RejectJoin(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -726,11 +723,8 @@ func (h *GroupHandler) RejectJoin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is admin/owner
-	var role string
-	err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, body.GroupId, u.ID).Scan(&role)
-	if err != nil || (role != "owner" && role != "admin") {
-		Err(w, 403, "not admin")
+	if _, ok := groupAuthorize(h.DB, body.GroupId, u.ID, permApproveJoins); !ok {
+		Err(w, 403, "not allowed to approve joins")
 		return
 	}
 
@@ -744,7 +738,7 @@ func (h *GroupHandler) RejectJoin(w http.ResponseWriter, r *http.Request) {
 	JSON(w, 200, map[string]any{"ok": true})
 }
 
-// POST /api/groups/kick {groupId, userId} - kick member (owner only)
+// POST /api/groups/kick {groupId, userId} - kick a member of a lower role (kick)
 func (h *GroupHandler) Kick(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -765,11 +759,9 @@ func (h *GroupHandler) Kick(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is owner
-	var role string
-	err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, body.GroupId, u.ID).Scan(&role)
-	if err != nil || role != "owner" {
-		Err(w, 403, "not owner")
+	role, ok := groupAuthorize(h.DB, body.GroupId, u.ID, permKick)
+	if !ok {
+		Err(w, 403, "not allowed to kick")
 		return
 	}
 
@@ -779,6 +771,16 @@ func (h *GroupHandler) Kick(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var targetRole string
+	if err := h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=?`, body.GroupId, body.UserId).Scan(&targetRole); err != nil {
+		Err(w, 404, "not a member")
+		return
+	}
+	if roleRank[targetRole] >= roleRank[role] {
+		Err(w, 403, "cannot kick a member of an equal or higher role")
+		return
+	}
+
 	// Remove the member
 	_, err = h.DB.Exec(`DELETE FROM group_members WHERE group_id=? AND user_id=?`, body.GroupId, body.UserId)
 	if err != nil {
@@ -787,16 +789,8 @@ func (h *GroupHandler) Kick(w http.ResponseWriter, r *http.Request) {
 	}
 
 	JSON(w, 200, map[string]any{"ok": true})
+	recheckRoom(h.DB, h.Hub, "group:"+strconv.FormatInt(body.GroupId, 10))
 
 	// Notify the kicked user
-	if h.Hub != nil {
-		h.Hub.Broadcast("user:"+body.UserId, ws.Message{
-			Type: "notification",
-			Payload: map[string]any{
-				"type":    "kicked_from_group",
-				"actorId": u.ID,
-				"groupId": body.GroupId,
-			},
-		})
-	}
+	h.Notifier.Notify(Note{Type: "kicked_from_group", UserID: body.UserId, ActorID: u.ID, GroupID: body.GroupId})
 }
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/pkg/auth"
+)
+
+// ChatSearchHandler searches the DM and group chat history of the current
+// user. Only conversations they take part in are ever searched.
+type ChatSearchHandler struct{ DB *sql.DB }
+
+// ChatHit is a message matching a chat search. Snippet is HTML-escaped
+// with matches in <mark>…</mark> (see markSnippet).
+type ChatHit struct {
+	Kind      string `json:"kind"` // "dm" | "group"
+	ID        int64  `json:"id"`
+	GroupID   int64  `json:"groupId,omitempty"` // group messages
+	PeerID    string `json:"peerId,omitempty"`  // DMs: the other participant
+	SenderID  string `json:"senderId"`
+	Snippet   string `json:"snippet"`
+	CreatedAt string `json:"createdAt"`
+}
+
+const maxChatContext = 50
+
+// GET /api/chat/search?q=<text>&userId=<peer>|groupId=<id>&senderId=&from=&to=&limit=20&offset=0
+// Newest hits first. userId limits the search to one DM conversation and
+// groupId to one group chat; without either, all of them are searched.
+// from/to are dates (2006-01-02, to inclusive) or RFC 3339 times.
+func (h *ChatSearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	qs := r.URL.Query()
+	match := ftsQuery(qs.Get("q"))
+	if match == "" {
+		Err(w, 400, "q required")
+		return
+	}
+	from, err := parseChatTime(qs.Get("from"), false)
+	if err != nil {
+		Err(w, 400, "bad from")
+		return
+	}
+	to, err := parseChatTime(qs.Get("to"), true)
+	if err != nil {
+		Err(w, 400, "bad to")
+		return
+	}
+	peer, groupID, senderID := qs.Get("userId"), qs.Get("groupId"), qs.Get("senderId")
+
+	limit := 20
+	if l := qs.Get("limit"); l != "" {
+		if n, _ := strconv.Atoi(l); n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	offset := 0
+	if o := qs.Get("offset"); o != "" {
+		if n, _ := strconv.Atoi(o); n >= 0 {
+			offset = n
+		}
+	}
+
+	// filters shared by both kinds of message m
+	common := ""
+	var commonArgs []any
+	if senderID != "" {
+		common += " AND m.sender_id = ?"
+		commonArgs = append(commonArgs, senderID)
+	}
+	if from != "" {
+		common += " AND m.created_at >= ?"
+		commonArgs = append(commonArgs, from)
+	}
+	if to != "" {
+		common += " AND m.created_at < ?"
+		commonArgs = append(commonArgs, to)
+	}
+
+	var arms []string
+	var args []any
+	if groupID == "" {
+		q := `
+SELECT 'dm', m.id, 0, CASE WHEN m.sender_id = ? THEN m.recipient_id ELSE m.sender_id END, m.sender_id,
+       snippet(dm_messages_fts, 0, ` + snippetOpen + `, ` + snippetClose + `, '…', 16), m.created_at
+FROM dm_messages_fts
+JOIN dm_messages m ON m.id = dm_messages_fts.rowid
+WHERE dm_messages_fts MATCH ? AND (m.sender_id = ? OR m.recipient_id = ?)`
+		args = append(args, u.ID, match, u.ID, u.ID)
+		if peer != "" {
+			q += " AND (m.sender_id = ? OR m.recipient_id = ?)"
+			args = append(args, peer, peer)
+		}
+		arms = append(arms, q+common)
+		args = append(args, commonArgs...)
+	}
+	if peer == "" {
+		q := `
+SELECT 'group', m.id, m.group_id, '', m.sender_id,
+       snippet(group_messages_fts, 0, ` + snippetOpen + `, ` + snippetClose + `, '…', 16), m.created_at
+FROM group_messages_fts
+JOIN group_messages m ON m.id = group_messages_fts.rowid
+WHERE group_messages_fts MATCH ?
+  AND m.group_id IN (SELECT group_id FROM group_members WHERE user_id = ? AND status = 'accepted')`
+		args = append(args, match, u.ID)
+		if groupID != "" {
+			q += " AND m.group_id = ?"
+			args = append(args, groupID)
+		}
+		arms = append(arms, q+common)
+		args = append(args, commonArgs...)
+	}
+	args = append(args, limit, offset)
+
+	rows, err := h.DB.Query(strings.Join(arms, "\nUNION ALL")+`
+ORDER BY 7 DESC, 2 DESC
+LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer rows.Close()
+
+	out := []ChatHit{}
+	for rows.Next() {
+		var hit ChatHit
+		if err := rows.Scan(&hit.Kind, &hit.ID, &hit.GroupID, &hit.PeerID, &hit.SenderID, &hit.Snippet, &hit.CreatedAt); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		hit.Snippet = markSnippet(hit.Snippet)
+		out = append(out, hit)
+	}
+	if err := rows.Err(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, out)
+}
+
+// GET /api/chat/context?kind=dm|group&id=<messageId>&before=10&after=10
+// Returns the message with up to before/after neighbours from the same
+// conversation, oldest first, so a client can jump to a search hit:
+// {"kind", "anchorId", "messages": [...], "hasOlder", "hasNewer"}
+func (h *ChatSearchHandler) Context(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	qs := r.URL.Query()
+	id, err := strconv.ParseInt(qs.Get("id"), 10, 64)
+	if err != nil {
+		Err(w, 400, "id required")
+		return
+	}
+	before, after := 10, 10
+	if n, err := strconv.Atoi(qs.Get("before")); err == nil && n >= 0 && n <= maxChatContext {
+		before = n
+	}
+	if n, err := strconv.Atoi(qs.Get("after")); err == nil && n >= 0 && n <= maxChatContext {
+		after = n
+	}
+
+	switch qs.Get("kind") {
+	case "dm":
+		var anchor DMMessage
+		err := h.DB.QueryRow(`SELECT id, sender_id, recipient_id, body, created_at FROM dm_messages WHERE id=?`, id).
+			Scan(&anchor.ID, &anchor.SenderID, &anchor.RecipientID, &anchor.Body, &anchor.CreatedAt)
+		if err == sql.ErrNoRows || (err == nil && anchor.SenderID != u.ID && anchor.RecipientID != u.ID) {
+			Err(w, 404, "not found")
+			return
+		}
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+
+		pair := `((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?))`
+		pairArgs := []any{anchor.SenderID, anchor.RecipientID, anchor.RecipientID, anchor.SenderID}
+		older, err := h.dmWindow(`WHERE `+pair+` AND id < ? ORDER BY id DESC`, append(pairArgs, id, before+1)...)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		newer, err := h.dmWindow(`WHERE `+pair+` AND id > ? ORDER BY id ASC`, append(pairArgs, id, after+1)...)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		hasOlder, hasNewer := len(older) > before, len(newer) > after
+		older, newer = older[:min(len(older), before)], newer[:min(len(newer), after)]
+
+		msgs := make([]DMMessage, 0, len(older)+1+len(newer))
+		for i := len(older) - 1; i >= 0; i-- {
+			msgs = append(msgs, older[i])
+		}
+		msgs = append(msgs, anchor)
+		msgs = append(msgs, newer...)
+		JSON(w, 200, map[string]any{"kind": "dm", "anchorId": id, "messages": msgs, "hasOlder": hasOlder, "hasNewer": hasNewer})
+
+	case "group":
+		var anchor GroupMessage
+		err := h.DB.QueryRow(`
+SELECT gm.id, gm.group_id, gm.sender_id, gm.body, gm.created_at FROM group_messages gm
+JOIN group_members m ON m.group_id = gm.group_id AND m.user_id = ? AND m.status = 'accepted'
+WHERE gm.id = ?`, u.ID, id).Scan(&anchor.ID, &anchor.GroupID, &anchor.SenderID, &anchor.Body, &anchor.CreatedAt)
+		if err == sql.ErrNoRows {
+			Err(w, 404, "not found")
+			return
+		}
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+
+		older, err := h.groupWindow(`WHERE group_id = ? AND id < ? ORDER BY id DESC`, anchor.GroupID, id, before+1)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		newer, err := h.groupWindow(`WHERE group_id = ? AND id > ? ORDER BY id ASC`, anchor.GroupID, id, after+1)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		hasOlder, hasNewer := len(older) > before, len(newer) > after
+		older, newer = older[:min(len(older), before)], newer[:min(len(newer), after)]
+
+		msgs := make([]GroupMessage, 0, len(older)+1+len(newer))
+		for i := len(older) - 1; i >= 0; i-- {
+			msgs = append(msgs, older[i])
+		}
+		msgs = append(msgs, anchor)
+		msgs = append(msgs, newer...)
+		JSON(w, 200, map[string]any{"kind": "group", "anchorId": id, "messages": msgs, "hasOlder": hasOlder, "hasNewer": hasNewer})
+
+	default:
+		Err(w, 400, "kind must be dm or group")
+	}
+}
+
+// dmWindow runs "SELECT ... FROM dm_messages <where> LIMIT ?".
+func (h *ChatSearchHandler) dmWindow(where string, args ...any) ([]DMMessage, error) {
+	rows, err := h.DB.Query(`SELECT id, sender_id, recipient_id, body, created_at FROM dm_messages `+where+` LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DMMessage
+	for rows.Next() {
+		var m DMMessage
+		if err := rows.Scan(&m.ID, &m.SenderID, &m.RecipientID, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// groupWindow runs "SELECT ... FROM group_messages <where> LIMIT ?".
+func (h *ChatSearchHandler) groupWindow(where string, args ...any) ([]GroupMessage, error) {
+	rows, err := h.DB.Query(`SELECT id, group_id, sender_id, body, created_at FROM group_messages `+where+` LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []GroupMessage
+	for rows.Next() {
+		var m GroupMessage
+		if err := rows.Scan(&m.ID, &m.GroupID, &m.SenderID, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// parseChatTime turns a from/to query value into the stored timestamp
+// format. A bare date used as an upper bound means the end of that day.
+func parseChatTime(s string, upper bool) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		if upper {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t.Format("2006-01-02 15:04:05"), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format("2006-01-02 15:04:05"), nil
+}
@@ -13,16 +13,18 @@ import (
 )
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"postId"`
-	UserID    string `json:"userId"`
-	Body      string `json:"body"`
-	CreatedAt string `json:"createdAt"`
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"postId"`
+	UserID    string    `json:"userId"`
+	Body      string    `json:"body"`
+	CreatedAt string    `json:"createdAt"`
+	Mentions  []Mention `json:"mentions"`
 }
 
 type CommentHandler struct {
-	DB  *sql.DB
-	Hub *ws.Hub
+	DB       *sql.DB
+	Hub      *ws.Hub
+	Notifier *Notifier
 }
 
 func (h *CommentHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -44,15 +46,35 @@ func (h *CommentHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Err(w, 400, "bad json")
 		return
 	}
-	res, err := h.DB.Exec(`INSERT INTO comments(post_id, user_id, body, created_at) VALUES(?,?,?,datetime('now'))`,
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	res, err := tx.Exec(`INSERT INTO comments(post_id, user_id, body, created_at) VALUES(?,?,?,datetime('now'))`,
 		req.PostID, u.ID, req.Body)
 	if err != nil {
+		_ = tx.Rollback()
 		Err(w, 500, "db")
 		return
 	}
 	id, _ := res.LastInsertId()
-	out := Comment{ID: id, PostID: req.PostID, UserID: u.ID, Body: req.Body, CreatedAt: time.Now().UTC().Format("2006-01-02 15:04:05")}
+	mentioned, err := indexText(tx, req.PostID, &id, u.ID, req.Body)
+	if err != nil {
+		_ = tx.Rollback()
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	mentions, _ := loadMentions(h.DB, []int64{id}, true)
+	out := Comment{ID: id, PostID: req.PostID, UserID: u.ID, Body: req.Body, CreatedAt: time.Now().UTC().Format("2006-01-02 15:04:05"),
+		Mentions: nonNilMentions(mentions[id])}
 	JSON(w, 200, out)
+	notifyMentions(h.Notifier, u.ID, req.PostID, &id, mentioned)
+	h.notifyComment(u.ID, req.PostID, id)
 
 	// Broadcast via WebSocket (in goroutine to avoid blocking HTTP response)
 	go func() {
@@ -91,11 +113,120 @@ func (h *CommentHandler) ListByPost(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	var list []Comment
+	var ids []int64
 	for rows.Next() {
 		var c Comment
 		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Body, &c.CreatedAt); err == nil {
 			list = append(list, c)
+			ids = append(ids, c.ID)
 		}
 	}
+	mentions, _ := loadMentions(h.DB, ids, true)
+	for i := range list {
+		list[i].Mentions = nonNilMentions(mentions[list[i].ID])
+	}
 	JSON(w, 200, list)
 }
+
+// notifyComment tells the post's author about a new comment, and everyone
+// else who commented on the post (and can still see it) about the reply.
+func (h *CommentHandler) notifyComment(actorID string, postID, commentID int64) {
+	if h.Notifier == nil {
+		return
+	}
+	var authorID string
+	if err := h.DB.QueryRow(`SELECT user_id FROM posts WHERE id=?`, postID).Scan(&authorID); err != nil {
+		return
+	}
+	h.Notifier.Notify(Note{Type: "comment", UserID: authorID, ActorID: actorID, PostID: postID, CommentID: commentID})
+
+	rows, err := h.DB.Query(`SELECT DISTINCT user_id FROM comments WHERE post_id=? AND user_id NOT IN (?, ?)`, postID, authorID, actorID)
+	if err != nil {
+		return
+	}
+	var others []string
+	for rows.Next() {
+		var uid string
+		if rows.Scan(&uid) == nil {
+			others = append(others, uid)
+		}
+	}
+	rows.Close()
+	for _, uid := range others {
+		if ok, _ := canViewPost(h.DB, strconv.FormatInt(postID, 10), uid); ok {
+			h.Notifier.Notify(Note{Type: "reply", UserID: uid, ActorID: actorID, PostID: postID, CommentID: commentID})
+		}
+	}
+}
+
+// PUT /api/comments {id, body} - Edit the text of your own comment
+func (h *CommentHandler) Update(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPut {
+		Err(w, 405, "method")
+		return
+	}
+
+	var req struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 || req.Body == "" {
+		Err(w, 400, "bad json")
+		return
+	}
+
+	var c Comment
+	err = h.DB.QueryRow(`SELECT id, post_id, user_id, created_at FROM comments WHERE id=?`, req.ID).
+		Scan(&c.ID, &c.PostID, &c.UserID, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		Err(w, 404, "comment not found")
+		return
+	}
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if c.UserID != u.ID {
+		Err(w, 403, "not your comment")
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if _, err := tx.Exec(`UPDATE comments SET body=? WHERE id=?`, req.Body, c.ID); err != nil {
+		_ = tx.Rollback()
+		Err(w, 500, "db")
+		return
+	}
+	mentioned, err := indexText(tx, c.PostID, &c.ID, u.ID, req.Body)
+	if err != nil {
+		_ = tx.Rollback()
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	mentions, _ := loadMentions(h.DB, []int64{c.ID}, true)
+	c.Body = req.Body
+	c.Mentions = nonNilMentions(mentions[c.ID])
+	JSON(w, 200, c)
+
+	if h.Hub != nil {
+		room := "post:" + strconv.FormatInt(c.PostID, 10)
+		h.Hub.Broadcast(room, ws.Message{
+			Type: "comment_updated", Room: room, From: u.ID, At: time.Now().Unix(),
+			Payload: c,
+		})
+	}
+	notifyMentions(h.Notifier, u.ID, c.PostID, &c.ID, mentioned)
+}
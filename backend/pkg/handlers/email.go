@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"social-network/backend/pkg/mail"
+)
+
+// emailableSQL limits notifications n to unread ones that haven't been
+// mailed yet and whose type the recipient wants email for.
+const emailableSQL = `n.read_at IS NULL AND n.emailed_at IS NULL
+  AND COALESCE((SELECT p.email FROM notification_preferences p WHERE p.user_id = n.user_id AND p.type = n.type), 1) = 1`
+
+// mailedNow are sent by email right away instead of waiting for a digest.
+var mailedNow = map[string]bool{"follow_request": true, "group_invite": true}
+
+// notificationPath is the frontend page a notification links to.
+func notificationPath(typ string, t *NotificationTarget) string {
+	switch {
+	case typ == "follow_request":
+		return "/profile/me/requests"
+	case t == nil:
+		return "/"
+	case t.Type == "user":
+		return "/profile/" + t.ID
+	case t.Type == "group" || t.Type == "event":
+		return "/groups"
+	}
+	return "/"
+}
+
+// digestGrace gives people a chance to see a notification in the app
+// before it goes into a digest.
+const digestGrace = time.Hour
+
+const maxDigestItems = 20
+
+// mailNow emails notification id to its recipient and marks it as mailed.
+func (n *Notifier) mailNow(ctx context.Context, id int64) {
+	var email, name string
+	if err := n.DB.QueryRow(`
+SELECT u.email, `+displayNameSQL+` FROM notifications n JOIN users u ON u.id = n.user_id
+WHERE n.id = ? AND `+emailableSQL, id).Scan(&email, &name); err != nil {
+		return
+	}
+	list, err := loadNotifications(n.DB, `n.id=?`, id)
+	if err != nil || len(list) == 0 {
+		return
+	}
+	note := list[0]
+	err = n.Mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: note.Text,
+		Text: fmt.Sprintf("Hi %s,\n\n%s.\n\n%s%s\n\n%s",
+			name, note.Text, n.AppURL, notificationPath(note.Type, note.Target), n.emailFooter("You get these emails right away")),
+	})
+	if err != nil {
+		log.Println("mail notification:", err)
+		return
+	}
+	_, _ = n.DB.Exec(`UPDATE notifications SET emailed_at=datetime('now') WHERE id=?`, id)
+}
+
+// heldMailAge keeps SendHeldMail off notifications whose mailNow may still
+// be in flight.
+const heldMailAge = time.Minute
+
+// SendHeldMail sends the mailedNow emails that quiet hours (or a failed send)
+// held back, once the recipient's quiet hours are over. Without it they would
+// only go out in a digest, which most users never turn on. It is run
+// periodically by the job scheduler.
+func (n *Notifier) SendHeldMail(ctx context.Context) error {
+	if n.Mailer == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	args := []any{now.Add(-24 * time.Hour).Format("2006-01-02 15:04:05"), now.Add(-heldMailAge).Format("2006-01-02 15:04:05")}
+	ph := make([]string, 0, len(mailedNow))
+	for t := range mailedNow {
+		ph = append(ph, "?")
+		args = append(args, t)
+	}
+	// quiet hours last under a day: anything older was never held by them
+	rows, err := n.DB.QueryContext(ctx, `
+SELECT n.id, n.user_id FROM notifications n
+WHERE n.created_at > ? AND n.created_at <= ? AND n.type IN (`+strings.Join(ph, ",")+`) AND `+emailableSQL+`
+ORDER BY n.id`, args...)
+	if err != nil {
+		return err
+	}
+	type held struct {
+		id     int64
+		userID string
+	}
+	var pending []held
+	for rows.Next() {
+		var h held
+		if err := rows.Scan(&h.id, &h.userID); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	quiet := map[string]bool{}
+	for _, h := range pending {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		q, ok := quiet[h.userID]
+		if !ok {
+			hours := quietHours(n.DB, h.userID)
+			q = hours != nil && hours.contains(time.Now())
+			quiet[h.userID] = q
+		}
+		if !q {
+			n.mailNow(ctx, h.id)
+		}
+	}
+	return nil
+}
+
+// SendDigests mails everyone whose daily or weekly digest is due a summary
+// of the unread notifications they haven't been emailed about. Digests are
+// off until a user picks one. It is run
+// periodically by the job scheduler.
+func (n *Notifier) SendDigests(ctx context.Context) error {
+	if n.Mailer == nil {
+		return nil
+	}
+	rows, err := n.DB.QueryContext(ctx, `
+SELECT u.id, u.email, `+displayNameSQL+`, s.digest
+FROM users u JOIN notification_settings s ON s.user_id = u.id
+WHERE s.digest <> 'off'
+  AND (s.last_digest_at IS NULL
+       OR s.last_digest_at <= datetime('now', CASE s.digest WHEN 'weekly' THEN '-7 days' ELSE '-1 day' END))
+  AND EXISTS (SELECT 1 FROM notifications n WHERE n.user_id = u.id AND n.created_at <= ? AND `+emailableSQL+`)`,
+		time.Now().UTC().Add(-digestGrace).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return err
+	}
+	type recipient struct{ id, email, name, digest string }
+	var due []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.id, &r.email, &r.name, &r.digest); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if q := quietHours(n.DB, r.id); q != nil && q.contains(time.Now()) {
+			continue // next run
+		}
+		if err := n.sendDigest(ctx, r.id, r.email, r.name, r.digest); err != nil {
+			log.Printf("digest for %s: %v", r.id, err)
+		}
+	}
+	return nil
+}
+
+func (n *Notifier) sendDigest(ctx context.Context, userID, email, name, digest string) error {
+	var total int
+	if err := n.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications n WHERE n.user_id=? AND `+emailableSQL, userID).
+		Scan(&total); err != nil {
+		return err
+	}
+	list, err := loadNotifications(n.DB, `n.user_id=? AND `+emailableSQL+` ORDER BY n.created_at DESC, n.id DESC LIMIT ?`,
+		userID, maxDigestItems)
+	if err != nil || len(list) == 0 {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\n", name)
+	if total == 1 {
+		b.WriteString("You have an unread notification:\n\n")
+	} else {
+		fmt.Fprintf(&b, "You have %d unread notifications:\n\n", total)
+	}
+	var newest int64
+	for _, note := range list {
+		fmt.Fprintf(&b, "- %s\n", note.Text)
+		newest = max(newest, note.ID)
+	}
+	if total > len(list) {
+		fmt.Fprintf(&b, "…and %d more.\n", total-len(list))
+	}
+	fmt.Fprintf(&b, "\n%s/\n\n%s", n.AppURL, n.emailFooter("You get this digest "+digest))
+
+	subject := fmt.Sprintf("Your %s digest: %d unread notifications", digest, total)
+	if total == 1 {
+		subject = fmt.Sprintf("Your %s digest: %s", digest, list[0].Text)
+	}
+	if err := n.Mailer.Send(ctx, mail.Message{To: email, Subject: subject, Text: b.String()}); err != nil {
+		return err
+	}
+
+	// everything up to the newest listed one counts as mailed, including the
+	// items past maxDigestItems that were only counted
+	if _, err := n.DB.Exec(`
+UPDATE notifications SET emailed_at=datetime('now')
+WHERE user_id=? AND read_at IS NULL AND emailed_at IS NULL AND id <= ?`, userID, newest); err != nil {
+		return err
+	}
+	_, err = n.DB.Exec(`
+INSERT INTO notification_settings (user_id, last_digest_at) VALUES (?, datetime('now'))
+ON CONFLICT (user_id) DO UPDATE SET last_digest_at=excluded.last_digest_at`, userID)
+	return err
+}
+
+func (n *Notifier) emailFooter(why string) string {
+	return "-- \n" + why + ". Change your email settings at " + n.AppURL + "/profile/settings"
+}
+
+// digestFrequency validates a digest setting from the API.
+func digestFrequency(s string) bool {
+	return s == "off" || s == "daily" || s == "weekly"
+}
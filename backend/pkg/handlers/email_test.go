@@ -0,0 +1,67 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"social-network/backend/pkg/mail"
+)
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *recordingMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sent)
+}
+
+// TestHeldMail checks that a follow request emailed right away is sent once
+// quiet hours end, even with digests off.
+func TestHeldMail(t *testing.T) {
+	db := testDB(t)
+	annID, _ := testUser(t, db, "ann")
+	bobID, _ := testUser(t, db, "bob")
+	now := time.Now().UTC()
+	if _, err := db.Exec(`INSERT INTO notification_settings (user_id, quiet_start, quiet_end, quiet_tz) VALUES (?, ?, ?, 'UTC')`,
+		bobID, now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04")); err != nil {
+		t.Fatal(err)
+	}
+	m := &recordingMailer{}
+	n := NewNotifier(db, nil)
+	n.Mailer = m
+	ctx := context.Background()
+
+	n.Notify(Note{Type: "follow_request", UserID: bobID, ActorID: annID})
+	_, _ = db.Exec(`UPDATE notifications SET created_at=datetime('now', '-5 minutes')`)
+	if err := n.SendHeldMail(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if m.count() != 0 {
+		t.Fatalf("%d emails during quiet hours", m.count())
+	}
+
+	_, _ = db.Exec(`UPDATE notification_settings SET quiet_start=NULL, quiet_end=NULL`)
+	for i := 0; i < 2; i++ {
+		if err := n.SendHeldMail(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m.count() != 1 || m.sent[0].To != "bob@example.com" {
+		t.Errorf("sent %+v, want one email to bob", m.sent)
+	}
+}
@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/rrule"
+	"social-network/backend/pkg/ws"
+)
+
+// eventReminders are sent to members going, this long before an event. An
+// event coming up sooner than a reminder's lead time only gets the later ones.
+var eventReminders = []struct {
+	Kind   string
+	Before time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+// PUT /api/events/update {eventId, title?, description?, eventDate?, timezone?, recurrence?, capacity?}
+// Only the fields given change; "capacity": null removes the limit and
+// "recurrence": null makes a one-off event. A new timezone without a new
+// eventDate keeps the event at the same wall-clock time there. Moving a
+// series moves its responses and skipped occurrences along. Raising the
+// capacity gives free seats to the waitlists; lowering it below the number
+// going doesn't take anyone's seat. Everyone who responded is told what
+// changed.
+func (h *EventsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodPut {
+		Err(w, 405, "method")
+		return
+	}
+
+	var body struct {
+		EventID     int64           `json:"eventId"`
+		Title       *string         `json:"title"`
+		Description *string         `json:"description"`
+		EventDate   *string         `json:"eventDate"`
+		Timezone    *string         `json:"timezone"`
+		Recurrence  json.RawMessage `json:"recurrence"`
+		Capacity    json.RawMessage `json:"capacity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.EventID == 0 {
+		Err(w, 400, "bad json")
+		return
+	}
+
+	var groupID int64
+	var creatorID, title, eventDate, timezone, status string
+	var description, recurrence *string
+	var capacity *int
+	err = h.DB.QueryRow(`SELECT group_id, creator_id, title, description, event_date, timezone, recurrence, capacity, status FROM events WHERE id=?`,
+		body.EventID).Scan(&groupID, &creatorID, &title, &description, &eventDate, &timezone, &recurrence, &capacity, &status)
+	if err != nil {
+		Err(w, 404, "event not found")
+		return
+	}
+	if !canManageEvent(h.DB, groupID, creatorID, u.ID) {
+		Err(w, 403, "not authorized")
+		return
+	}
+	if status == "cancelled" {
+		Err(w, 409, "event cancelled")
+		return
+	}
+
+	var changes []string
+	if body.Title != nil && *body.Title != title {
+		if strings.TrimSpace(*body.Title) == "" {
+			Err(w, 400, "title is required")
+			return
+		}
+		title = *body.Title
+		changes = append(changes, "title")
+	}
+	if body.Description != nil {
+		var current string
+		if description != nil {
+			current = *description
+		}
+		if *body.Description != current {
+			description = body.Description
+			if *description == "" {
+				description = nil
+			}
+			changes = append(changes, "description")
+		}
+	}
+	start, _ := time.Parse(eventDateLayout, eventDate)
+	loc := eventLocation(timezone)
+	newStart := start
+	if body.Timezone != nil && *body.Timezone != timezone {
+		newLoc, err := loadLocation(*body.Timezone)
+		if err != nil {
+			Err(w, 400, err.Error())
+			return
+		}
+		wall := start.In(loc)
+		newStart = time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, newLoc).UTC()
+		loc, timezone = newLoc, newLoc.String()
+		changes = append(changes, "timezone")
+	}
+	if body.EventDate != nil {
+		if newStart, err = parseEventDate(*body.EventDate, loc); err != nil {
+			Err(w, 400, err.Error())
+			return
+		}
+	}
+	if !newStart.Equal(start) {
+		eventDate = storedEventDate(newStart)
+		changes = append(changes, "eventDate")
+	}
+	if body.Recurrence != nil {
+		var rec *string
+		if err := json.Unmarshal(body.Recurrence, &rec); err != nil {
+			Err(w, 400, "bad recurrence")
+			return
+		}
+		if rec != nil && *rec != "" {
+			rule, err := recurrenceRule(*rec)
+			if err != nil {
+				Err(w, 400, err.Error())
+				return
+			}
+			rec = &rule
+		} else {
+			rec = nil
+		}
+		if (rec == nil) != (recurrence == nil) || (rec != nil && *rec != *recurrence) {
+			recurrence = rec
+			changes = append(changes, "recurrence")
+		}
+	}
+	if body.Capacity != nil {
+		var c *int
+		if err := json.Unmarshal(body.Capacity, &c); err != nil {
+			Err(w, 400, "bad capacity")
+			return
+		}
+		if c != nil && *c <= 0 {
+			Err(w, 400, "capacity must be positive")
+			return
+		}
+		if (c == nil) != (capacity == nil) || (c != nil && *c != *capacity) {
+			capacity = c
+			changes = append(changes, "capacity")
+		}
+	}
+
+	// asked first: the update may drop responses to occurrences that are gone
+	responders := eventResponderIDs(h.DB, body.EventID)
+	var promoted map[string][]string
+	if len(changes) > 0 {
+		if promoted, err = h.update(body.EventID, title, description, eventDate, timezone, recurrence, capacity, changes); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+	}
+
+	event, err := scanEvent(h.DB.QueryRow(eventSelectSQL+` WHERE e.id = ?`, u.ID, body.EventID))
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	event.localize(userLocation(h.DB, u.ID))
+	JSON(w, 200, event)
+	if len(changes) == 0 {
+		return
+	}
+
+	for occurrence, ids := range promoted {
+		h.notifyPromoted(body.EventID, occurrence, groupID, creatorID, ids)
+	}
+	h.Notifier.NotifyAll(responders, Note{
+		Type: "event_updated", ActorID: u.ID, GroupID: groupID, EventID: body.EventID,
+		Extra: map[string]any{"changes": changes, "eventDate": event.EventDate, "timezone": event.Timezone},
+		Dedup: *event.UpdatedAt, // each edit is news
+	})
+
+	if h.Hub != nil {
+		event.UserResponse, event.ViewerDate = nil, nil // the editor's, not everyone's
+		h.Hub.Broadcast("group:"+strconv.FormatInt(groupID, 10), ws.Message{
+			Type:    "group_event_updated",
+			Payload: map[string]any{"event": event, "changes": changes},
+		})
+	}
+}
+
+// update saves an edited event. A new schedule re-arms the reminders and
+// moves a series' occurrence keys; a new capacity may take people off the
+// waitlists, who are returned by occurrence.
+func (h *EventsHandler) update(eventID int64, title string, description *string, eventDate, timezone string, recurrence *string,
+	capacity *int, changes []string) (map[string][]string, error) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var oldDate, oldTimezone string
+	var oldRecurrence *string
+	if err := tx.QueryRow(`SELECT event_date, timezone, recurrence FROM events WHERE id=?`, eventID).
+		Scan(&oldDate, &oldTimezone, &oldRecurrence); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE events SET title=?, description=?, event_date=?, timezone=?, recurrence=?, capacity=?, updated_at=datetime('now') WHERE id=?`,
+		title, description, eventDate, timezone, recurrence, capacity, eventID); err != nil {
+		return nil, err
+	}
+	if recurrence != nil && oldRecurrence != nil &&
+		(eventDate != oldDate || timezone != oldTimezone || *recurrence != *oldRecurrence) {
+		if err := moveOccurrences(tx, eventID, oldDate, oldTimezone, eventDate, timezone, *recurrence); err != nil {
+			return nil, err
+		}
+	}
+	promoted := map[string][]string{}
+	for _, c := range changes {
+		switch c {
+		case "eventDate", "timezone":
+			_, err = tx.Exec(`DELETE FROM event_reminders WHERE event_id=?`, eventID)
+		case "recurrence":
+			// responses to a one-off event carry over to the first occurrence
+			// of the series it becomes, and back
+			from, to := "", eventDate
+			if recurrence == nil {
+				from, to = eventDate, ""
+			}
+			if _, err = tx.Exec(`DELETE FROM event_reminders WHERE event_id=?`, eventID); err == nil {
+				_, err = tx.Exec(`UPDATE OR IGNORE event_responses SET occurrence=? WHERE event_id=? AND occurrence=?`, to, eventID, from)
+			}
+		case "capacity":
+			var occurrences []string
+			if occurrences, err = waitlistedOccurrences(tx, eventID); err != nil {
+				return nil, err
+			}
+			for _, occ := range occurrences {
+				if promoted[occ], err = promoteWaitlist(tx, eventID, occ); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return promoted, tx.Commit()
+}
+
+// moveOccurrences rekeys the responses to and exceptions from a series'
+// occurrences after its schedule changed. Occurrences are named by their UTC
+// start, so each moves by as many days and as much wall-clock time as the
+// first one did, in the new time zone if there is one: a series moved a day
+// later keeps everyone's answers, a day later. Rows for times that aren't in
+// the series any more, e.g. under a new RRULE, are dropped.
+func moveOccurrences(tx *sql.Tx, eventID int64, fromDate, fromTimezone, toDate, toTimezone, recurrence string) error {
+	rule, err := rrule.Parse(recurrence)
+	if err != nil {
+		return err
+	}
+	oldLoc, newLoc := eventLocation(fromTimezone), eventLocation(toTimezone)
+	oldStart, _ := time.Parse(eventDateLayout, fromDate)
+	newStart, _ := time.Parse(eventDateLayout, toDate)
+	ow, nw := oldStart.In(oldLoc), newStart.In(newLoc)
+	days := int(time.Date(nw.Year(), nw.Month(), nw.Day(), 0, 0, 0, 0, time.UTC).
+		Sub(time.Date(ow.Year(), ow.Month(), ow.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	minutes := nw.Hour()*60 + nw.Minute() - ow.Hour()*60 - ow.Minute()
+
+	for _, table := range []string{"event_responses", "event_exceptions"} {
+		rows, err := tx.Query(`SELECT DISTINCT occurrence FROM `+table+` WHERE event_id=? AND occurrence <> ''`, eventID)
+		if err != nil {
+			return err
+		}
+		var occurrences []string
+		for rows.Next() {
+			var occ string
+			if rows.Scan(&occ) == nil {
+				occurrences = append(occurrences, occ)
+			}
+		}
+		rows.Close()
+
+		// out of the way first, so that no key moves onto one yet to move
+		if _, err := tx.Exec(`UPDATE `+table+` SET occurrence = '~' || occurrence WHERE event_id=? AND occurrence <> ''`, eventID); err != nil {
+			return err
+		}
+		for _, occ := range occurrences {
+			t, err := time.Parse(eventDateLayout, occ)
+			if err != nil {
+				continue
+			}
+			w := t.In(oldLoc)
+			moved := time.Date(w.Year(), w.Month(), w.Day()+days, w.Hour(), w.Minute()+minutes, 0, 0, newLoc)
+			if !rule.Includes(nw, moved) {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE OR IGNORE `+table+` SET occurrence=? WHERE event_id=? AND occurrence=?`,
+				storedEventDate(moved), eventID, "~"+occ); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE event_id=? AND occurrence LIKE '~%'`, eventID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitlistedOccurrences lists the occurrences of an event with a waitlist.
+func waitlistedOccurrences(tx *sql.Tx, eventID int64) ([]string, error) {
+	rows, err := tx.Query(`SELECT DISTINCT occurrence FROM event_responses WHERE event_id=? AND response='waitlisted'`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var occ string
+		if err := rows.Scan(&occ); err != nil {
+			return nil, err
+		}
+		out = append(out, occ)
+	}
+	return out, rows.Err()
+}
+
+// POST /api/events/cancel {eventId, reason?}
+// A cancelled event stays listed (with "status": "cancelled") but takes no
+// more responses or edits, and sends no reminders.
+func (h *EventsHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var body struct {
+		EventID int64  `json:"eventId"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.EventID == 0 {
+		Err(w, 400, "bad json")
+		return
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+
+	var groupID int64
+	var creatorID, status string
+	err = h.DB.QueryRow(`SELECT group_id, creator_id, status FROM events WHERE id=?`, body.EventID).Scan(&groupID, &creatorID, &status)
+	if err != nil {
+		Err(w, 404, "event not found")
+		return
+	}
+	if !canManageEvent(h.DB, groupID, creatorID, u.ID) {
+		Err(w, 403, "not authorized")
+		return
+	}
+	if status == "cancelled" {
+		Err(w, 409, "already cancelled")
+		return
+	}
+
+	if _, err := h.DB.Exec(`UPDATE events SET status='cancelled', cancel_reason=?, updated_at=datetime('now') WHERE id=?`,
+		nullIfEmpty(body.Reason), body.EventID); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, map[string]any{"ok": true})
+
+	extra := map[string]any{}
+	if body.Reason != "" {
+		extra["reason"] = body.Reason
+	}
+	h.Notifier.NotifyAll(eventResponderIDs(h.DB, body.EventID), Note{
+		Type: "event_cancelled", ActorID: u.ID, GroupID: groupID, EventID: body.EventID, Extra: extra,
+	})
+
+	if h.Hub != nil {
+		h.Hub.Broadcast("group:"+strconv.FormatInt(groupID, 10), ws.Message{
+			Type: "group_event_cancelled",
+			Payload: map[string]any{
+				"eventId": body.EventID,
+				"groupId": groupID,
+				"reason":  nullIfEmpty(body.Reason),
+			},
+		})
+	}
+}
+
+// SendReminders notifies the members going to an event that it is coming
+// up, once per entry of eventReminders. It is run periodically by the job
+// scheduler.
+func (h *EventsHandler) SendReminders(ctx context.Context) error {
+	now := time.Now().UTC()
+	from := now
+	for _, rem := range eventReminders {
+		to := now.Add(rem.Before)
+		if err := h.sendReminders(ctx, rem.Kind, from, to); err != nil {
+			return err
+		}
+		from = to
+	}
+	return nil
+}
+
+// sendReminders sends the kind reminder for what starts in (from, to].
+func (h *EventsHandler) sendReminders(ctx context.Context, kind string, from, to time.Time) error {
+	upcoming, err := upcomingOccurrences(ctx, h.DB, from, to)
+	if err != nil {
+		return err
+	}
+	sent := 0
+	for _, o := range upcoming {
+		ids, err := h.remindees(ctx, o, kind)
+		if err != nil {
+			return err
+		}
+		for _, uid := range ids {
+			res, err := h.DB.ExecContext(ctx, `INSERT OR IGNORE INTO event_reminders (event_id, occurrence, user_id, kind) VALUES (?, ?, ?, ?)`,
+				o.EventID, o.Occurrence, uid, kind)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			extra := map[string]any{"reminder": kind, "eventDate": o.Start}
+			if o.Occurrence != "" {
+				extra["occurrence"] = o.Occurrence
+			}
+			note := Note{
+				Type: "event_reminder", UserID: uid, ActorID: o.CreatorID, GroupID: o.GroupID, EventID: o.EventID,
+				Extra: extra,
+				Dedup: kind + o.Occurrence,
+			}
+			if uid == o.CreatorID {
+				note.ActorID = "" // the organizer going to their own event wants reminding too
+			}
+			h.Notifier.Notify(note)
+			sent++
+		}
+	}
+	if sent > 0 {
+		log.Printf("events: sent %d %s reminders", sent, kind)
+	}
+	return nil
+}
+
+// remindees are the members going to o who haven't had the kind reminder.
+func (h *EventsHandler) remindees(ctx context.Context, o upcomingOccurrence, kind string) ([]string, error) {
+	rows, err := h.DB.QueryContext(ctx, `
+SELECT r.user_id FROM event_responses r
+JOIN group_members m ON m.group_id = ? AND m.user_id = r.user_id AND m.status = 'accepted'
+WHERE r.event_id = ? AND r.occurrence = ? AND r.response = 'going'
+  AND NOT EXISTS (SELECT 1 FROM event_reminders x
+                  WHERE x.event_id = r.event_id AND x.occurrence = r.occurrence AND x.user_id = r.user_id AND x.kind = ?)`,
+		o.GroupID, o.EventID, o.Occurrence, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// eventResponderIDs lists everyone who answered the event's RSVP, for any
+// of its occurrences.
+func eventResponderIDs(db *sql.DB, eventID int64) []string {
+	rows, err := db.Query(`SELECT DISTINCT user_id FROM event_responses WHERE event_id=?`, eventID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
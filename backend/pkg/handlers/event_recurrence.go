@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/rrule"
+	"social-network/backend/pkg/ws"
+)
+
+// eventDateLayout is how event dates and occurrence names are stored, in
+// UTC.
+const eventDateLayout = "2006-01-02T15:04"
+
+// the longest window GET /api/events/group expands recurring events over,
+// and the default one
+const (
+	maxEventWindow     = 366 * 24 * time.Hour
+	defaultEventWindow = 90 * 24 * time.Hour
+)
+
+// maxOccurrences caps how many occurrences of one series a listing shows.
+const maxOccurrences = 500
+
+var recurrenceShorthands = map[string]string{
+	"daily":   "FREQ=DAILY",
+	"weekly":  "FREQ=WEEKLY",
+	"monthly": "FREQ=MONTHLY",
+	"yearly":  "FREQ=YEARLY",
+}
+
+// recurrenceRule validates a recurrence from the API, either "daily",
+// "weekly", "monthly", "yearly" or an RRULE, and returns its canonical form.
+func recurrenceRule(s string) (string, error) {
+	if rule, ok := recurrenceShorthands[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return rule, nil
+	}
+	rule, err := rrule.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return rule.String(), nil
+}
+
+// checkOccurrence validates the occurrence a request names, as stored
+// ("2006-01-02T15:04", UTC) or in RFC 3339, and returns how it is stored:
+// "" for one-off events (which may also name their date).
+func checkOccurrence(eventDate, timezone string, recurrence *string, occurrence string) (string, error) {
+	notOne := errors.New("not an occurrence of this event")
+	start, err := time.Parse(eventDateLayout, eventDate)
+	if err != nil {
+		return "", err
+	}
+	var t time.Time
+	if occurrence != "" {
+		if t, err = parseEventDate(occurrence, time.UTC); err != nil {
+			return "", notOne
+		}
+	}
+	if recurrence == nil {
+		if occurrence != "" && !t.Equal(start) {
+			return "", notOne
+		}
+		return "", nil
+	}
+	if occurrence == "" {
+		return "", errors.New("occurrence required for a recurring event")
+	}
+	rule, err := rrule.Parse(*recurrence)
+	if err != nil {
+		return "", err
+	}
+	if !rule.Includes(start.In(eventLocation(timezone)), t) {
+		return "", notOne
+	}
+	return storedEventDate(t), nil
+}
+
+// occurrenceSkipped reports whether the occurrence was taken out of its series.
+func occurrenceSkipped(db *sql.DB, eventID int64, occurrence string) bool {
+	var n int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM event_exceptions WHERE event_id=? AND occurrence=?`, eventID, occurrence).Scan(&n)
+	return n > 0
+}
+
+// occurrenceExtra is notification metadata naming an occurrence, if any.
+func occurrenceExtra(occurrence string) map[string]any {
+	if occurrence == "" {
+		return nil
+	}
+	return map[string]any{"occurrence": occurrence}
+}
+
+// eventWindow reads ?from= and ?to=: dates or times in loc, or RFC 3339.
+// Without either, windowed is false and the window is the next 90 days
+// from the start of today in loc.
+func eventWindow(r *http.Request, loc *time.Location) (from, to time.Time, windowed bool, err error) {
+	parse := func(name string) (time.Time, error) {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			return time.Time{}, nil
+		}
+		windowed = true
+		if t, err := time.ParseInLocation("2006-01-02", v, loc); err == nil {
+			return t.UTC(), nil
+		}
+		t, err := parseEventDate(v, loc)
+		if err != nil {
+			return t, errors.New("bad " + name)
+		}
+		return t, nil
+	}
+	if from, err = parse("from"); err != nil {
+		return
+	}
+	if to, err = parse("to"); err != nil {
+		return
+	}
+	if from.IsZero() {
+		if to.IsZero() {
+			y, m, d := time.Now().In(loc).Date()
+			from = time.Date(y, m, d, 0, 0, 0, 0, loc).UTC()
+		} else {
+			from = to.Add(-defaultEventWindow)
+		}
+	}
+	if to.IsZero() {
+		to = from.Add(defaultEventWindow)
+	}
+	switch {
+	case !to.After(from):
+		err = errors.New("to must be after from")
+	case to.Sub(from) > maxEventWindow:
+		err = errors.New("window too large")
+	}
+	return
+}
+
+// expandEvent lists the occurrences of the recurring event e in [from, to),
+// each with its own response counts and userID's response. Occurrences
+// taken out of the series are left out.
+func expandEvent(db *sql.DB, e Event, userID string, from, to time.Time) ([]Event, error) {
+	rule, err := rrule.Parse(*e.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	// expanded in its own zone, so it keeps its wall-clock time across DST
+	start := e.start.In(eventLocation(e.Timezone))
+	times := rule.Between(start, from, to, maxOccurrences)
+	if len(times) == 0 {
+		return nil, nil
+	}
+	lo, hi := storedEventDate(times[0]), storedEventDate(times[len(times)-1])
+
+	skipped := map[string]bool{}
+	rows, err := db.Query(`SELECT occurrence FROM event_exceptions WHERE event_id=? AND occurrence BETWEEN ? AND ?`, e.ID, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var occ string
+		if rows.Scan(&occ) == nil {
+			skipped[occ] = true
+		}
+	}
+	rows.Close()
+
+	counts := map[string]*EventResponses{}
+	mine := map[string]string{}
+	rows, err = db.Query(`
+SELECT occurrence, response, COUNT(*), MAX(user_id = ?)
+FROM event_responses WHERE event_id=? AND occurrence BETWEEN ? AND ?
+GROUP BY occurrence, response`, userID, e.ID, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var occ, response string
+		var n int
+		var me bool
+		if err := rows.Scan(&occ, &response, &n, &me); err != nil {
+			return nil, err
+		}
+		c := counts[occ]
+		if c == nil {
+			c = &EventResponses{}
+			counts[occ] = c
+		}
+		switch response {
+		case "going":
+			c.Going = n
+		case "maybe":
+			c.Maybe = n
+		case "not_going":
+			c.NotGoing = n
+		case "waitlisted":
+			c.Waitlisted = n
+		}
+		if me {
+			mine[occ] = response
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var out []Event
+	for _, t := range times {
+		occ := storedEventDate(t)
+		if skipped[occ] {
+			continue
+		}
+		o := e
+		o.Occurrence = occ
+		o.EventDate = apiEventDate(t)
+		o.start = t.UTC()
+		o.Responses = &EventResponses{}
+		if c := counts[occ]; c != nil {
+			o.Responses = c
+		}
+		o.UserResponse = nil
+		if resp, ok := mine[occ]; ok {
+			o.UserResponse = &resp
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// upcomingOccurrence is a scheduled event, or one occurrence of a
+// recurring one, with its start.
+type upcomingOccurrence struct {
+	EventID    int64
+	GroupID    int64
+	CreatorID  string
+	Occurrence string // "" for one-off events
+	Start      string // RFC 3339, UTC
+}
+
+// upcomingOccurrences lists what starts in (from, to], skipping cancelled
+// events and occurrences.
+func upcomingOccurrences(ctx context.Context, db *sql.DB, from, to time.Time) ([]upcomingOccurrence, error) {
+	const layout = "2006-01-02 15:04:05"
+	rows, err := db.QueryContext(ctx, `
+SELECT e.id, e.group_id, e.creator_id, e.event_date, e.timezone, e.recurrence FROM events e
+WHERE e.status = 'scheduled' AND datetime(e.event_date) <= ?
+  AND (e.recurrence IS NOT NULL OR datetime(e.event_date) > ?)`, to.Format(layout), from.Format(layout))
+	if err != nil {
+		return nil, err
+	}
+	type series struct {
+		upcomingOccurrence
+		timezone, recurrence string
+	}
+	var list []series
+	for rows.Next() {
+		var s series
+		var recurrence *string
+		if err := rows.Scan(&s.EventID, &s.GroupID, &s.CreatorID, &s.Start, &s.timezone, &recurrence); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if recurrence != nil {
+			s.recurrence = *recurrence
+		}
+		list = append(list, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var out []upcomingOccurrence
+	for _, s := range list {
+		start, err := time.Parse(eventDateLayout, s.Start)
+		if err != nil {
+			continue
+		}
+		if s.recurrence == "" {
+			o := s.upcomingOccurrence
+			o.Start = apiEventDate(start)
+			out = append(out, o)
+			continue
+		}
+		rule, err := rrule.Parse(s.recurrence)
+		if err != nil {
+			continue
+		}
+		start = start.In(eventLocation(s.timezone))
+		// Between is [from, to); reminders want (from, to]
+		for _, t := range rule.Between(start, from.Add(time.Second), to.Add(time.Second), maxOccurrences) {
+			o := s.upcomingOccurrence
+			o.Occurrence = storedEventDate(t)
+			o.Start = apiEventDate(t)
+			if !occurrenceSkipped(db, o.EventID, o.Occurrence) {
+				out = append(out, o)
+			}
+		}
+	}
+	return out, nil
+}
+
+// GET    /api/events/exceptions?eventId=123 -> ["2025-01-13T18:00", ...] (UTC)
+// POST   /api/events/exceptions {eventId, occurrence}: take an occurrence out
+// DELETE /api/events/exceptions?eventId=123&occurrence=2025-01-13T18:00: put it back
+// Members can list them; the creator and group owner/admins change them.
+// Whoever responded to an occurrence is told when it is taken out.
+func (h *EventsHandler) Exceptions(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	eventID, _ := strconv.ParseInt(r.URL.Query().Get("eventId"), 10, 64)
+	occurrence := r.URL.Query().Get("occurrence")
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+	case http.MethodPost:
+		var body struct {
+			EventID    int64  `json:"eventId"`
+			Occurrence string `json:"occurrence"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			Err(w, 400, "bad json")
+			return
+		}
+		eventID, occurrence = body.EventID, body.Occurrence
+	default:
+		Err(w, 405, "method")
+		return
+	}
+	if eventID == 0 {
+		Err(w, 400, "eventId required")
+		return
+	}
+
+	var groupID int64
+	var creatorID, eventDate, timezone string
+	var recurrence *string
+	err = h.DB.QueryRow(`SELECT group_id, creator_id, event_date, timezone, recurrence FROM events WHERE id=?`, eventID).
+		Scan(&groupID, &creatorID, &eventDate, &timezone, &recurrence)
+	if err != nil {
+		Err(w, 404, "event not found")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if code, msg := groupReadDenied(h.DB, groupID, u.ID); code != 0 {
+			Err(w, code, msg)
+			return
+		}
+		rows, err := h.DB.Query(`SELECT occurrence FROM event_exceptions WHERE event_id=? ORDER BY occurrence`, eventID)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		defer rows.Close()
+		out := []string{}
+		for rows.Next() {
+			var occ string
+			if rows.Scan(&occ) == nil {
+				out = append(out, occ)
+			}
+		}
+		JSON(w, 200, out)
+		return
+	}
+
+	if !canManageEvent(h.DB, groupID, creatorID, u.ID) {
+		Err(w, 403, "not authorized")
+		return
+	}
+	if recurrence == nil {
+		Err(w, 400, "not a recurring event")
+		return
+	}
+	if occurrence, err = checkOccurrence(eventDate, timezone, recurrence, occurrence); err != nil {
+		Err(w, 400, err.Error())
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if _, err := h.DB.Exec(`DELETE FROM event_exceptions WHERE event_id=? AND occurrence=?`, eventID, occurrence); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		JSON(w, 200, map[string]any{"ok": true})
+		h.broadcastOccurrence(groupID, eventID, occurrence, false)
+		return
+	}
+
+	res, err := h.DB.Exec(`INSERT OR IGNORE INTO event_exceptions (event_id, occurrence) VALUES (?, ?)`, eventID, occurrence)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, map[string]any{"ok": true})
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	rows, err := h.DB.Query(`SELECT user_id FROM event_responses WHERE event_id=? AND occurrence=?`, eventID, occurrence)
+	if err == nil {
+		var ids []string
+		for rows.Next() {
+			var id string
+			if rows.Scan(&id) == nil {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+		h.Notifier.NotifyAll(ids, Note{
+			Type: "event_cancelled", ActorID: u.ID, GroupID: groupID, EventID: eventID,
+			Extra: occurrenceExtra(occurrence), Dedup: occurrence,
+		})
+	}
+	h.broadcastOccurrence(groupID, eventID, occurrence, true)
+}
+
+func (h *EventsHandler) broadcastOccurrence(groupID, eventID int64, occurrence string, cancelled bool) {
+	if h.Hub == nil {
+		return
+	}
+	typ := "group_event_occurrence_restored"
+	if cancelled {
+		typ = "group_event_occurrence_cancelled"
+	}
+	h.Hub.Broadcast("group:"+strconv.FormatInt(groupID, 10), ws.Message{
+		Type: typ,
+		Payload: map[string]any{
+			"eventId":    eventID,
+			"groupId":    groupID,
+			"occurrence": occurrence,
+		},
+	})
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/ws"
+)
+
+// EventAttendee is a member who answered an event's RSVP.
+type EventAttendee struct {
+	ID          string  `json:"id"`
+	DisplayName string  `json:"displayName"`
+	AvatarURL   *string `json:"avatarUrl,omitempty"`
+	RespondedAt string  `json:"respondedAt"`
+}
+
+// respond records userID's answer to an event occurrence ("" for one-off
+// events) and returns what was stored: "going" becomes "waitlisted" when it
+// is full. If a seat was freed, the users promoted from the waitlist are
+// returned too.
+func respond(db *sql.DB, eventID int64, occurrence, userID, want string) (response string, promoted []string, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	var prev string
+	err = tx.QueryRow(`SELECT response FROM event_responses WHERE event_id=? AND occurrence=? AND user_id=?`,
+		eventID, occurrence, userID).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return "", nil, err
+	}
+
+	response = want
+	if want == "going" && prev != "going" {
+		free, err := freeSeats(tx, eventID, occurrence)
+		if err != nil {
+			return "", nil, err
+		}
+		if free == 0 {
+			response = "waitlisted"
+		}
+	}
+	// asking again while waitlisted keeps your place in the queue
+	if response != prev {
+		if _, err := tx.Exec(`
+INSERT INTO event_responses (event_id, occurrence, user_id, response) VALUES (?, ?, ?, ?)
+ON CONFLICT (event_id, occurrence, user_id) DO UPDATE SET response=excluded.response, updated_at=datetime('now')`,
+			eventID, occurrence, userID, response); err != nil {
+			return "", nil, err
+		}
+	}
+	if prev == "going" && response != "going" {
+		if promoted, err = promoteWaitlist(tx, eventID, occurrence); err != nil {
+			return "", nil, err
+		}
+	}
+	return response, promoted, tx.Commit()
+}
+
+// freeSeats is how many more people can go to an occurrence; -1 when there
+// is no limit. The capacity applies to each occurrence on its own.
+func freeSeats(tx *sql.Tx, eventID int64, occurrence string) (int, error) {
+	var capacity sql.NullInt64
+	var going int
+	err := tx.QueryRow(`
+SELECT capacity, (SELECT COUNT(*) FROM event_responses WHERE event_id=e.id AND occurrence=? AND response='going')
+FROM events e WHERE id=?`, occurrence, eventID).Scan(&capacity, &going)
+	if err != nil || !capacity.Valid {
+		return -1, err
+	}
+	return max(int(capacity.Int64)-going, 0), nil
+}
+
+// promoteWaitlist moves people from the waitlist to "going", first come
+// first served, while there are free seats. Returns who got one.
+func promoteWaitlist(tx *sql.Tx, eventID int64, occurrence string) ([]string, error) {
+	free, err := freeSeats(tx, eventID, occurrence)
+	if err != nil || free == 0 {
+		return nil, err
+	}
+	rows, err := tx.Query(`
+SELECT user_id FROM event_responses WHERE event_id=? AND occurrence=? AND response='waitlisted'
+ORDER BY updated_at, id LIMIT ?`, eventID, occurrence, free)
+	if err != nil {
+		return nil, err
+	}
+	var promoted []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		promoted = append(promoted, id)
+	}
+	rows.Close()
+	for _, id := range promoted {
+		if _, err := tx.Exec(`UPDATE event_responses SET response='going', updated_at=datetime('now') WHERE event_id=? AND occurrence=? AND user_id=?`,
+			eventID, occurrence, id); err != nil {
+			return nil, err
+		}
+	}
+	return promoted, rows.Err()
+}
+
+// waitlistPosition is userID's place in the occurrence's waitlist, from 1.
+func waitlistPosition(db *sql.DB, eventID int64, occurrence, userID string) int {
+	var pos int
+	_ = db.QueryRow(`
+SELECT COUNT(*) FROM event_responses w
+JOIN event_responses me ON me.event_id = w.event_id AND me.occurrence = w.occurrence AND me.user_id = ?
+WHERE w.event_id = ? AND w.occurrence = ? AND w.response = 'waitlisted'
+  AND (w.updated_at < me.updated_at OR (w.updated_at = me.updated_at AND w.id <= me.id))`, userID, eventID, occurrence).Scan(&pos)
+	return pos
+}
+
+// notifyPromoted tells people taken off the waitlist that they are going.
+func (h *EventsHandler) notifyPromoted(eventID int64, occurrence string, groupID int64, creatorID string, promoted []string) {
+	for _, uid := range promoted {
+		h.Notifier.Notify(Note{
+			Type: "event_promoted", UserID: uid, ActorID: creatorID, GroupID: groupID, EventID: eventID,
+			Extra: occurrenceExtra(occurrence), Dedup: occurrence,
+		})
+		if h.Hub != nil {
+			h.Hub.Broadcast("group:"+strconv.FormatInt(groupID, 10), ws.Message{
+				Type: "group_event_response",
+				Payload: map[string]any{
+					"eventId":    eventID,
+					"occurrence": occurrence,
+					"groupId":    groupID,
+					"userId":     uid,
+					"response":   "going",
+				},
+			})
+		}
+	}
+}
+
+// GET /api/events/attendees?eventId=123[&occurrence=2025-01-06T18:00]
+// {"eventId", "occurrence", "capacity", "going": [...], "maybe": [...],
+// "notGoing": [...], "waitlist": [...]}; the waitlist in the order seats are
+// given out. Recurring events need the occurrence.
+func (h *EventsHandler) Attendees(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	eventID, err := strconv.ParseInt(r.URL.Query().Get("eventId"), 10, 64)
+	if err != nil {
+		Err(w, 400, "eventId required")
+		return
+	}
+	var groupID int64
+	var capacity *int
+	var eventDate, timezone string
+	var recurrence *string
+	if err := h.DB.QueryRow(`SELECT group_id, capacity, event_date, timezone, recurrence FROM events WHERE id=?`, eventID).
+		Scan(&groupID, &capacity, &eventDate, &timezone, &recurrence); err != nil {
+		Err(w, 404, "event not found")
+		return
+	}
+	if code, msg := groupReadDenied(h.DB, groupID, u.ID); code != 0 {
+		Err(w, code, msg)
+		return
+	}
+	occurrence, err := checkOccurrence(eventDate, timezone, recurrence, r.URL.Query().Get("occurrence"))
+	if err != nil {
+		Err(w, 400, err.Error())
+		return
+	}
+
+	rows, err := h.DB.Query(`
+SELECT r.response, u.id, `+displayNameSQL+`, u.avatar_url, r.updated_at
+FROM event_responses r JOIN users u ON u.id = r.user_id
+WHERE r.event_id = ? AND r.occurrence = ?
+ORDER BY r.updated_at, r.id`, eventID, occurrence)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer rows.Close()
+
+	lists := map[string][]EventAttendee{"going": {}, "maybe": {}, "not_going": {}, "waitlisted": {}}
+	for rows.Next() {
+		var response string
+		var a EventAttendee
+		if err := rows.Scan(&response, &a.ID, &a.DisplayName, &a.AvatarURL, &a.RespondedAt); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		lists[response] = append(lists[response], a)
+	}
+	if err := rows.Err(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	JSON(w, 200, map[string]any{
+		"eventId":    eventID,
+		"occurrence": occurrence,
+		"capacity":   capacity,
+		"going":      lists["going"],
+		"maybe":      lists["maybe"],
+		"notGoing":   lists["not_going"],
+		"waitlist":   lists["waitlisted"],
+	})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"social-network/backend/pkg/auth"
+)
+
+// Event times are stored in UTC (events.event_date, eventDateLayout) along
+// with the IANA zone they were scheduled in (events.timezone). The API
+// returns the UTC instant plus renderings in the event's zone and in the
+// viewer's preferred one.
+
+// LocalTime is an event time as seen in one zone.
+type LocalTime struct {
+	Timezone string `json:"timezone"`
+	DateTime string `json:"dateTime"` // RFC 3339 with the zone's offset
+	Display  string `json:"display"`  // e.g. "Tue, 20 Oct 2026 18:00 CEST"
+}
+
+func localTime(t time.Time, loc *time.Location) *LocalTime {
+	t = t.In(loc)
+	return &LocalTime{
+		Timezone: loc.String(),
+		DateTime: t.Format(time.RFC3339),
+		Display:  t.Format("Mon, 02 Jan 2006 15:04 MST"),
+	}
+}
+
+// loadLocation is time.LoadLocation for zones from the API: an IANA name
+// or "UTC", not the server's "Local".
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("invalid timezone")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.New("invalid timezone")
+	}
+	return loc, nil
+}
+
+// eventLocation is the zone of an event; UTC if it is unknown.
+func eventLocation(name string) *time.Location {
+	if loc, err := loadLocation(name); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// userLocation is the zone userID sees times in; UTC if they haven't set one.
+func userLocation(db *sql.DB, userID string) *time.Location {
+	var name sql.NullString
+	_ = db.QueryRow(`SELECT timezone FROM users WHERE id=?`, userID).Scan(&name)
+	return eventLocation(name.String)
+}
+
+// parseEventDate reads an event date from the API: RFC 3339 with an offset
+// is an instant; "2006-01-02T15:04" (seconds optional) is a wall-clock time
+// in loc.
+func parseEventDate(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02T15:04Z07:00", s); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range []string{eventDateLayout, "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New("invalid event date format")
+}
+
+// storedEventDate is how t is kept in events.event_date and in occurrence
+// names.
+func storedEventDate(t time.Time) string {
+	return t.UTC().Format(eventDateLayout)
+}
+
+// apiEventDate is the UTC instant as the API returns it.
+func apiEventDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// localize fills in the zone renderings of e.
+func (e *Event) localize(viewer *time.Location) {
+	e.LocalDate = localTime(e.start, eventLocation(e.Timezone))
+	e.ViewerDate = localTime(e.start, viewer)
+}
+
+// GET /api/profile/timezone -> {timezone}
+// PUT /api/profile/timezone {timezone}: an IANA zone, e.g. "Europe/Berlin",
+// or null for UTC. Event times are also returned in this zone, and new
+// events without a zone are scheduled in it.
+func (h *ProfileHandler) Timezone(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Timezone *string `json:"timezone"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			Err(w, 400, "bad json")
+			return
+		}
+		if body.Timezone != nil {
+			if _, err := loadLocation(*body.Timezone); err != nil {
+				Err(w, 400, err.Error())
+				return
+			}
+		}
+		if _, err := h.DB.Exec(`UPDATE users SET timezone=? WHERE id=?`, body.Timezone, u.ID); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+	default:
+		Err(w, 405, "method")
+		return
+	}
+	JSON(w, 200, map[string]any{"timezone": userLocation(h.DB, u.ID).String()})
+}
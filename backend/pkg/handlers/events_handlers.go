@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"social-network/backend/pkg/auth"
@@ -13,25 +15,40 @@ import (
 )
 
 type EventsHandler struct {
-	DB  *sql.DB
-	Hub *ws.Hub
+	DB       *sql.DB
+	Hub      *ws.Hub
+	Notifier *Notifier
 }
 
 type Event struct {
 	ID           int64           `json:"id"`
 	GroupID      int64           `json:"groupId"`
+	GroupTitle   string          `json:"groupTitle,omitempty"` // in /api/events/mine
 	CreatorID    string          `json:"creatorId"`
 	Title        string          `json:"title"`
 	Description  *string         `json:"description,omitempty"`
-	EventDate    string          `json:"eventDate"`
+	EventDate    string          `json:"eventDate"` // UTC, RFC 3339
+	Timezone     string          `json:"timezone"`  // IANA zone it is scheduled in
+	LocalDate    *LocalTime      `json:"localDate,omitempty"`
+	ViewerDate   *LocalTime      `json:"viewerDate,omitempty"` // in the requesting user's zone
+	Recurrence   *string         `json:"recurrence,omitempty"` // RRULE, nil = one-off
+	Occurrence   string          `json:"occurrence,omitempty"` // which one, for recurring events
+	Capacity     *int            `json:"capacity,omitempty"` // nil = unlimited
+	Status       string          `json:"status"`              // scheduled | cancelled
+	CancelReason *string         `json:"cancelReason,omitempty"`
 	CreatedAt    string          `json:"createdAt"`
+	UpdatedAt    *string         `json:"updatedAt,omitempty"`
 	Responses    *EventResponses `json:"responses,omitempty"`
-	UserResponse *string         `json:"userResponse,omitempty"`
+	UserResponse *string         `json:"userResponse,omitempty"` // going | maybe | not_going | waitlisted
+
+	start time.Time
 }
 
 type EventResponses struct {
-	Going    int `json:"going"`
-	NotGoing int `json:"notGoing"`
+	Going      int `json:"going"`
+	Maybe      int `json:"maybe"`
+	NotGoing   int `json:"notGoing"`
+	Waitlisted int `json:"waitlisted"`
 }
 
 type EventResponse struct {
@@ -58,12 +75,19 @@ func (h *EventsHandler) Create(w http.ResponseWriter, r *http.Request) {
 		GroupID     int64   `json:"groupId"`
 		Title       string  `json:"title"`
 		Description *string `json:"description"`
-		EventDate   string  `json:"eventDate"`
+		EventDate   string  `json:"eventDate"` // RFC 3339, or wall-clock time in timezone
+		Timezone    string  `json:"timezone"`  // IANA zone; default: the creator's
+		Capacity    *int    `json:"capacity"`
+		Recurrence  *string `json:"recurrence"` // daily | weekly | monthly | yearly | RRULE
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		Err(w, 400, "invalid json: "+err.Error())
 		return
 	}
+	if body.Capacity != nil && *body.Capacity <= 0 {
+		Err(w, 400, "capacity must be positive")
+		return
+	}
 	if body.GroupID == 0 {
 		Err(w, 400, "groupId is required")
 		return
@@ -77,31 +101,40 @@ func (h *EventsHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc := userLocation(h.DB, u.ID)
+	if body.Timezone != "" {
+		if loc, err = loadLocation(body.Timezone); err != nil {
+			Err(w, 400, err.Error())
+			return
+		}
+	}
 	// Validate event date format
-	if _, err := time.Parse("2006-01-02T15:04", body.EventDate); err != nil {
-		Err(w, 400, "invalid event date format")
+	start, err := parseEventDate(body.EventDate, loc)
+	if err != nil {
+		Err(w, 400, err.Error())
 		return
 	}
-
-	// Check if user is admin/owner of the group
-	var role string
-	err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, body.GroupID, u.ID).Scan(&role)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			Err(w, 403, "not a member of this group")
-		} else {
-			Err(w, 500, "database error: "+err.Error())
+	if body.Recurrence != nil && *body.Recurrence == "" {
+		body.Recurrence = nil
+	}
+	if body.Recurrence != nil {
+		rule, err := recurrenceRule(*body.Recurrence)
+		if err != nil {
+			Err(w, 400, err.Error())
+			return
 		}
-		return
+		body.Recurrence = &rule
 	}
-	if role != "owner" && role != "admin" {
-		Err(w, 403, "only group owners and admins can create events")
+
+	if _, ok := groupAuthorize(h.DB, body.GroupID, u.ID, permCreateEvents); !ok {
+		Err(w, 403, "not allowed to create events in this group")
 		return
 	}
 
 	// Create event
-	res, err := h.DB.Exec(`INSERT INTO events (group_id, creator_id, title, description, event_date, created_at) 
-		VALUES (?, ?, ?, ?, ?, datetime('now'))`, body.GroupID, u.ID, body.Title, body.Description, body.EventDate)
+	res, err := h.DB.Exec(`INSERT INTO events (group_id, creator_id, title, description, event_date, timezone, recurrence, capacity, created_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))`, body.GroupID, u.ID, body.Title, body.Description, storedEventDate(start), loc.String(),
+		body.Recurrence, body.Capacity)
 	if err != nil {
 		Err(w, 500, "failed to create event: "+err.Error())
 		return
@@ -114,9 +147,17 @@ func (h *EventsHandler) Create(w http.ResponseWriter, r *http.Request) {
 		CreatorID:   u.ID,
 		Title:       body.Title,
 		Description: body.Description,
-		EventDate:   body.EventDate,
+		EventDate:   apiEventDate(start),
+		Timezone:    loc.String(),
+		Recurrence:  body.Recurrence,
+		Capacity:    body.Capacity,
+		Status:      "scheduled",
 		CreatedAt:   time.Now().UTC().Format("2006-01-02 15:04:05"),
+		start:       start,
 	}
+	event.localize(userLocation(h.DB, u.ID))
+	broadcast := event
+	broadcast.ViewerDate = nil // the creator's
 
 	JSON(w, 200, event)
 
@@ -132,7 +173,7 @@ func (h *EventsHandler) Create(w http.ResponseWriter, r *http.Request) {
 			room := "group:" + strconv.FormatInt(body.GroupID, 10)
 			h.Hub.Broadcast(room, ws.Message{
 				Type:    "group_event",
-				Payload: event,
+				Payload: broadcast,
 			})
 		}
 	}()
@@ -145,43 +186,17 @@ func (h *EventsHandler) Create(w http.ResponseWriter, r *http.Request) {
 			}
 		}()
 		
-		// Get all group members
-		rows, err := h.DB.Query(`SELECT user_id FROM group_members WHERE group_id=? AND status='accepted' AND user_id<>?`, body.GroupID, u.ID)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var memberID string
-				if err := rows.Scan(&memberID); err == nil {
-					// Store notification in database
-					res, _ := h.DB.Exec(
-						`INSERT INTO notifications (user_id, type, actor_id, created_at)
-						VALUES (?, 'event_created', ?, datetime('now'))`,
-						memberID, u.ID,
-					)
-					
-					// Send real-time notification
-					if h.Hub != nil && res != nil {
-						id, _ := res.LastInsertId()
-						h.Hub.Broadcast("user:"+memberID, ws.Message{
-							Type: "notification",
-							Payload: map[string]any{
-								"id":        id,
-								"type":      "event_created",
-								"actorId":   u.ID,
-								"eventId":   eventID,
-								"groupId":   body.GroupID,
-								"title":     body.Title,
-								"createdAt": time.Now().UTC().Format("2006-01-02 15:04:05"),
-							},
-						})
-					}
-				}
-			}
-		}
+		h.Notifier.NotifyAll(groupMemberIDs(h.DB, body.GroupID), Note{
+			Type: "event_created", ActorID: u.ID, GroupID: body.GroupID, EventID: eventID,
+			Extra: map[string]any{"title": body.Title},
+		})
 	}()
 }
 
-// GET /api/events/group?groupId=123
+// GET /api/events/group?groupId=123[&from=2025-01-01&to=2025-02-01]
+// Recurring events are expanded into their occurrences in [from, to), by
+// default the next 90 days; one-off events are all listed unless a window
+// is given.
 func (h *EventsHandler) GetGroupEvents(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -195,58 +210,171 @@ func (h *EventsHandler) GetGroupEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is a member of the group
-	var n int
-	_ = h.DB.QueryRow(`SELECT COUNT(*) FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, groupID, u.ID).Scan(&n)
-	if n == 0 {
-		Err(w, 403, "not a member")
+	if code, msg := groupReadDenied(h.DB, groupID, u.ID); code != 0 {
+		Err(w, code, msg)
 		return
 	}
 
-	// Get events with response counts and user's response
-	rows, err := h.DB.Query(`
-		SELECT 
-			e.id, e.group_id, e.creator_id, e.title, e.description, e.event_date, e.created_at,
-			(SELECT COUNT(*) FROM event_responses WHERE event_id = e.id AND response = 'going') as going_count,
-			(SELECT COUNT(*) FROM event_responses WHERE event_id = e.id AND response = 'not_going') as not_going_count,
-			(SELECT response FROM event_responses WHERE event_id = e.id AND user_id = ?) as user_response
-		FROM events e 
-		WHERE e.group_id = ? 
-		ORDER BY e.event_date ASC`, u.ID, groupID)
+	viewer := userLocation(h.DB, u.ID)
+	from, to, windowed, err := eventWindow(r, viewer)
+	if err != nil {
+		Err(w, 400, err.Error())
+		return
+	}
+	where := `e.group_id = ?`
+	args := []any{groupID}
+	if windowed {
+		where += ` AND e.event_date < ? AND (e.recurrence IS NOT NULL OR e.event_date >= ?)`
+		args = append(args, storedEventDate(to), storedEventDate(from))
+	}
+	events, err := h.listEvents(u.ID, viewer, from, to, where, args...)
 	if err != nil {
 		Err(w, 500, "db")
 		return
 	}
+	JSON(w, 200, events)
+}
+
+// GET /api/events/mine?from=&to=&status=going,maybe
+// Events of every group the user belongs to in [from, to) (as for
+// /api/events/group; default the next 90 days), oldest first, with the
+// group's title, the counts and the user's response. status keeps only
+// those the user answered so: going, maybe, not_going, waitlisted, or none
+// for no answer yet.
+func (h *EventsHandler) Mine(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	statuses := map[string]bool{}
+	if v := r.URL.Query().Get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			switch s = strings.TrimSpace(s); s {
+			case "going", "maybe", "not_going", "waitlisted", "none":
+				statuses[s] = true
+			default:
+				Err(w, 400, "bad status")
+				return
+			}
+		}
+	}
+	viewer := userLocation(h.DB, u.ID)
+	from, to, _, err := eventWindow(r, viewer)
+	if err != nil {
+		Err(w, 400, err.Error())
+		return
+	}
+
+	events, err := h.listEvents(u.ID, viewer, from, to, `
+		e.group_id IN (SELECT group_id FROM group_members WHERE user_id = ? AND status = 'accepted')
+		AND e.event_date < ? AND (e.recurrence IS NOT NULL OR e.event_date >= ?)`,
+		u.ID, storedEventDate(to), storedEventDate(from))
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	titles := map[int64]string{}
+	out := []Event{}
+	for _, e := range events {
+		if len(statuses) > 0 {
+			answer := "none"
+			if e.UserResponse != nil {
+				answer = *e.UserResponse
+			}
+			if !statuses[answer] {
+				continue
+			}
+		}
+		if _, ok := titles[e.GroupID]; !ok {
+			var title string
+			_ = h.DB.QueryRow(`SELECT title FROM groups WHERE id=?`, e.GroupID).Scan(&title)
+			titles[e.GroupID] = title
+		}
+		e.GroupTitle = titles[e.GroupID]
+		out = append(out, e)
+	}
+	JSON(w, 200, out)
+}
+
+// listEvents lists the events matching where (with args), recurring ones
+// expanded to their occurrences in [from, to), in order, with userID's
+// responses and times shown in viewer.
+func (h *EventsHandler) listEvents(userID string, viewer *time.Location, from, to time.Time, where string, args ...any) ([]Event, error) {
+	rows, err := h.DB.Query(eventSelectSQL+` WHERE `+where+`
+		ORDER BY e.event_date ASC`, append([]any{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
+	var series []Event
 	events := []Event{}
 	for rows.Next() {
-		var event Event
-		var goingCount, notGoingCount int
-		var userResponse sql.NullString
-
-		err := rows.Scan(&event.ID, &event.GroupID, &event.CreatorID, &event.Title, &event.Description,
-			&event.EventDate, &event.CreatedAt, &goingCount, &notGoingCount, &userResponse)
+		event, err := scanEvent(rows)
 		if err != nil {
 			continue
 		}
-
-		event.Responses = &EventResponses{
-			Going:    goingCount,
-			NotGoing: notGoingCount,
+		if event.Recurrence != nil {
+			series = append(series, event)
+			continue
 		}
+		events = append(events, event)
+	}
+	rows.Close()
 
-		if userResponse.Valid {
-			event.UserResponse = &userResponse.String
+	for _, e := range series {
+		occurrences, err := expandEvent(h.DB, e, userID, from, to)
+		if err != nil {
+			log.Printf("expand event %d: %v", e.ID, err)
+			continue
 		}
-
-		events = append(events, event)
+		events = append(events, occurrences...)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+	for i := range events {
+		events[i].localize(viewer)
 	}
+	return events, nil
+}
 
-	JSON(w, 200, events)
+// eventSelectSQL selects events e with their response counts and the
+// response of the user given as the first argument; rows go to scanEvent.
+// The counts are those of one-off events; see expandEvent for occurrences.
+const eventSelectSQL = `
+		SELECT 
+			e.id, e.group_id, e.creator_id, e.title, e.description, e.event_date, e.timezone, e.recurrence, e.capacity,
+			e.status, e.cancel_reason, e.created_at, e.updated_at,
+			(SELECT COUNT(*) FROM event_responses WHERE event_id = e.id AND occurrence = '' AND response = 'going') as going_count,
+			(SELECT COUNT(*) FROM event_responses WHERE event_id = e.id AND occurrence = '' AND response = 'maybe') as maybe_count,
+			(SELECT COUNT(*) FROM event_responses WHERE event_id = e.id AND occurrence = '' AND response = 'not_going') as not_going_count,
+			(SELECT COUNT(*) FROM event_responses WHERE event_id = e.id AND occurrence = '' AND response = 'waitlisted') as waitlisted_count,
+			(SELECT response FROM event_responses WHERE event_id = e.id AND occurrence = '' AND user_id = ?) as user_response
+		FROM events e`
+
+func scanEvent(row interface{ Scan(...any) error }) (Event, error) {
+	var event Event
+	var counts EventResponses
+	var stored string
+	err := row.Scan(&event.ID, &event.GroupID, &event.CreatorID, &event.Title, &event.Description,
+		&stored, &event.Timezone, &event.Recurrence, &event.Capacity, &event.Status, &event.CancelReason, &event.CreatedAt, &event.UpdatedAt,
+		&counts.Going, &counts.Maybe, &counts.NotGoing, &counts.Waitlisted, &event.UserResponse)
+	if err != nil {
+		return event, err
+	}
+	event.Responses = &counts
+	event.start, err = time.Parse(eventDateLayout, stored)
+	event.EventDate = apiEventDate(event.start)
+	return event, err
 }
 
-// POST /api/events/respond
+// POST /api/events/respond {eventId, occurrence?, response: going|maybe|not_going}
+// Saying "going" to a full event puts you on its waitlist instead (the
+// reply has "response": "waitlisted" and "waitlistPosition"). When someone
+// going drops out, the first person waiting gets their seat. Responses to
+// recurring events are per occurrence, which must be given.
 func (h *EventsHandler) Respond(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -259,26 +387,43 @@ func (h *EventsHandler) Respond(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var body struct {
-		EventID  int64  `json:"eventId"`
-		Response string `json:"response"`
+		EventID    int64  `json:"eventId"`
+		Occurrence string `json:"occurrence"`
+		Response   string `json:"response"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.EventID == 0 {
 		Err(w, 400, "bad json")
 		return
 	}
 
-	if body.Response != "going" && body.Response != "not_going" {
+	if body.Response != "going" && body.Response != "maybe" && body.Response != "not_going" {
 		Err(w, 400, "invalid response")
 		return
 	}
 
 	// Check if user is member of the group that owns this event
 	var groupID int64
-	err = h.DB.QueryRow(`SELECT group_id FROM events WHERE id=?`, body.EventID).Scan(&groupID)
+	var creatorID, status, eventDate, timezone string
+	var recurrence *string
+	err = h.DB.QueryRow(`SELECT group_id, creator_id, status, event_date, timezone, recurrence FROM events WHERE id=?`, body.EventID).
+		Scan(&groupID, &creatorID, &status, &eventDate, &timezone, &recurrence)
 	if err != nil {
 		Err(w, 404, "event not found")
 		return
 	}
+	if status == "cancelled" {
+		Err(w, 409, "event cancelled")
+		return
+	}
+	occurrence, err := checkOccurrence(eventDate, timezone, recurrence, body.Occurrence)
+	if err != nil {
+		Err(w, 400, err.Error())
+		return
+	}
+	if occurrence != "" && occurrenceSkipped(h.DB, body.EventID, occurrence) {
+		Err(w, 409, "occurrence cancelled")
+		return
+	}
 
 	var n int
 	_ = h.DB.QueryRow(`SELECT COUNT(*) FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, groupID, u.ID).Scan(&n)
@@ -287,15 +432,22 @@ func (h *EventsHandler) Respond(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Insert or update response
-	_, err = h.DB.Exec(`INSERT OR REPLACE INTO event_responses (event_id, user_id, response) VALUES (?, ?, ?)`,
-		body.EventID, u.ID, body.Response)
+	response, promoted, err := respond(h.DB, body.EventID, occurrence, u.ID, body.Response)
 	if err != nil {
 		Err(w, 500, "db")
 		return
 	}
 
-	JSON(w, 200, map[string]any{"ok": true, "response": body.Response})
+	out := map[string]any{"ok": true, "response": response}
+	if occurrence != "" {
+		out["occurrence"] = occurrence
+	}
+	if response == "waitlisted" {
+		out["waitlistPosition"] = waitlistPosition(h.DB, body.EventID, occurrence, u.ID)
+	}
+	JSON(w, 200, out)
+
+	h.notifyPromoted(body.EventID, occurrence, groupID, creatorID, promoted)
 
 	// Broadcast event response update to group room for real-time updates
 	go func() {
@@ -309,10 +461,11 @@ func (h *EventsHandler) Respond(w http.ResponseWriter, r *http.Request) {
 			h.Hub.Broadcast(room, ws.Message{
 				Type: "group_event_response",
 				Payload: map[string]any{
-					"eventId":  body.EventID,
-					"groupId":  groupID,
-					"userId":   u.ID,
-					"response": body.Response,
+					"eventId":    body.EventID,
+					"occurrence": occurrence,
+					"groupId":    groupID,
+					"userId":     u.ID,
+					"response":   response,
 				},
 			})
 		}
@@ -338,27 +491,16 @@ func (h *EventsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user is the creator or admin/owner of the group
-	var creatorID string
+	var creatorID, title string
 	var groupID int64
-	err = h.DB.QueryRow(`SELECT creator_id, group_id FROM events WHERE id=?`, eventID).Scan(&creatorID, &groupID)
+	err = h.DB.QueryRow(`SELECT creator_id, group_id, title FROM events WHERE id=?`, eventID).Scan(&creatorID, &groupID, &title)
 	if err != nil {
 		Err(w, 404, "event not found")
 		return
 	}
 
 	// Allow deletion if user is creator OR admin/owner of the group
-	canDelete := false
-	if creatorID == u.ID {
-		canDelete = true
-	} else {
-		var role string
-		err = h.DB.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, groupID, u.ID).Scan(&role)
-		if err == nil && (role == "owner" || role == "admin") {
-			canDelete = true
-		}
-	}
-
-	if !canDelete {
+	if !canManageEvent(h.DB, groupID, creatorID, u.ID) {
 		Err(w, 403, "not authorized")
 		return
 	}
@@ -372,6 +514,12 @@ func (h *EventsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	JSON(w, 200, map[string]any{"ok": true})
 
+	eid, _ := strconv.ParseInt(eventID, 10, 64)
+	h.Notifier.NotifyAll(groupMemberIDs(h.DB, groupID), Note{
+		Type: "event_deleted", ActorID: u.ID, GroupID: groupID, EventID: eid,
+		Extra: map[string]any{"title": title},
+	})
+
 	// Broadcast event deletion to group room for real-time updates
 	go func() {
 		defer func() {
@@ -392,3 +540,29 @@ func (h *EventsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
+// canManageEvent: an event can be edited, cancelled or deleted by its
+// creator and by members of the group who may moderate.
+func canManageEvent(db *sql.DB, groupID int64, creatorID, userID string) bool {
+	if creatorID == userID {
+		return true
+	}
+	_, ok := groupAuthorize(db, groupID, userID, permModerate)
+	return ok
+}
+
+// groupMemberIDs lists the accepted members of a group.
+func groupMemberIDs(db *sql.DB, groupID int64) []string {
+	rows, err := db.Query(`SELECT user_id FROM group_members WHERE group_id=? AND status='accepted'`, groupID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
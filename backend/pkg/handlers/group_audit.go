@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"social-network/backend/pkg/auth"
+)
+
+// GroupAuditEntry is one line of a group's audit log.
+type GroupAuditEntry struct {
+	ID        int64          `json:"id"`
+	ActorID   string         `json:"actorId"`
+	ActorName string         `json:"actorName"`
+	Action    string         `json:"action"`
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt string         `json:"createdAt"`
+}
+
+// groupAudit records that actorID did action in the group.
+func groupAudit(db dbtx, groupID int64, actorID, action string, details map[string]any) error {
+	var js *string
+	if len(details) > 0 {
+		b, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		s := string(b)
+		js = &s
+	}
+	_, err := db.Exec(`INSERT INTO group_audit_log (group_id, actor_id, action, details) VALUES (?, ?, ?, ?)`,
+		groupID, actorID, action, js)
+	return err
+}
+
+// GET /api/groups/audit?groupId=123&limit=50&before=<id> (edit_group)
+// Newest first; pass the last id seen as before for the next page.
+func (h *GroupHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	q := r.URL.Query()
+	groupID, err := strconv.ParseInt(q.Get("groupId"), 10, 64)
+	if err != nil {
+		Err(w, 400, "groupId required")
+		return
+	}
+	if _, ok := groupAuthorize(h.DB, groupID, u.ID, permEditGroup); !ok {
+		Err(w, 403, "not allowed to see the audit log")
+		return
+	}
+	limit := 50
+	if n, _ := strconv.Atoi(q.Get("limit")); n > 0 && n <= 200 {
+		limit = n
+	}
+	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+	if before <= 0 {
+		before = 1<<63 - 1
+	}
+
+	rows, err := h.DB.Query(`
+SELECT a.id, a.actor_id, COALESCE(`+displayNameSQL+`, ''), a.action, a.details, a.created_at
+FROM group_audit_log a LEFT JOIN users u ON u.id = a.actor_id
+WHERE a.group_id = ? AND a.id < ?
+ORDER BY a.id DESC LIMIT ?`, groupID, before, limit)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer rows.Close()
+	out := []GroupAuditEntry{}
+	for rows.Next() {
+		var e GroupAuditEntry
+		var details *string
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.Action, &details, &e.CreatedAt); err != nil {
+			continue
+		}
+		if details != nil {
+			_ = json.Unmarshal([]byte(*details), &e.Details)
+		}
+		out = append(out, e)
+	}
+	JSON(w, 200, out)
+}
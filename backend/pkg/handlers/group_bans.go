@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/pkg/auth"
+)
+
+// maxBanReason caps the length of a ban's reason.
+const maxBanReason = 500
+
+// GroupBan keeps a user out of a group.
+type GroupBan struct {
+	UserID       string  `json:"userId"`
+	Name         string  `json:"name"`
+	BannedBy     string  `json:"bannedBy"`
+	BannedByName string  `json:"bannedByName"`
+	Reason       *string `json:"reason,omitempty"`
+	ExpiresAt    *string `json:"expiresAt,omitempty"`
+	CreatedAt    string  `json:"createdAt"`
+}
+
+// groupBanActiveSQL holds for bans b that haven't run out.
+const groupBanActiveSQL = `(b.expires_at IS NULL OR b.expires_at > datetime('now'))`
+
+// groupBanned reports whether userID is banned from the group.
+func groupBanned(db *sql.DB, groupID any, userID string) bool {
+	var n int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM group_bans b WHERE b.group_id=? AND b.user_id=? AND `+groupBanActiveSQL,
+		groupID, userID).Scan(&n)
+	return n > 0
+}
+
+// POST /api/groups/ban {groupId, userId, reason?, hours?} (ban)
+// Removes the user from the group, along with any invitation or join
+// request, and keeps them out for hours (or until unbanned). Members can only
+// be banned by someone of a higher role; anyone else can be banned before
+// they try to join. Banning again replaces the reason and duration. Only
+// members and invitees are notified.
+func (h *GroupHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var b struct {
+		GroupId int64  `json:"groupId"`
+		UserId  string `json:"userId"`
+		Reason  string `json:"reason"`
+		Hours   int    `json:"hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 || b.UserId == "" {
+		Err(w, 400, "bad json")
+		return
+	}
+	b.Reason = strings.TrimSpace(b.Reason)
+	if len(b.Reason) > maxBanReason {
+		Err(w, 400, "reason too long")
+		return
+	}
+	if b.Hours < 0 || b.Hours > maxHours {
+		Err(w, 400, "hours must be between 0 and "+strconv.Itoa(maxHours))
+		return
+	}
+
+	role, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permBan)
+	if !ok {
+		Err(w, 403, "not allowed to ban")
+		return
+	}
+	if b.UserId == u.ID {
+		Err(w, 400, "cannot ban self")
+		return
+	}
+	var exists int
+	_ = h.DB.QueryRow(`SELECT COUNT(*) FROM users WHERE id=?`, b.UserId).Scan(&exists)
+	if exists == 0 {
+		Err(w, 404, "user not found")
+		return
+	}
+	if targetRole, ok := groupRole(h.DB, b.GroupId, b.UserId); ok && roleRank[targetRole] >= roleRank[role] {
+		Err(w, 403, "cannot ban a member of an equal or higher role")
+		return
+	}
+
+	var expiresAt any
+	if b.Hours > 0 {
+		expiresAt = time.Now().UTC().Add(time.Duration(b.Hours) * time.Hour).Format("2006-01-02 15:04:05")
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer tx.Rollback()
+	// what they were to the group decides whether they hear about it: telling
+	// an outsider would give away a secret group's name
+	var status string
+	err = tx.QueryRow(`DELETE FROM group_members WHERE group_id=? AND user_id=? RETURNING status`, b.GroupId, b.UserId).Scan(&status)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		Err(w, 500, "db")
+		return
+	}
+	if _, err := tx.Exec(`INSERT INTO group_bans (group_id, user_id, banned_by, reason, expires_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (group_id, user_id) DO UPDATE SET banned_by=excluded.banned_by, reason=excluded.reason,
+  expires_at=excluded.expires_at, created_at=datetime('now')`, b.GroupId, b.UserId, u.ID, nullIfEmpty(b.Reason), expiresAt); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := groupAudit(tx, b.GroupId, u.ID, "member_banned", map[string]any{
+		"userId": b.UserId, "reason": nullIfEmpty(b.Reason), "expiresAt": expiresAt,
+	}); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	JSON(w, 200, map[string]any{"ok": true, "expiresAt": expiresAt})
+	recheckRoom(h.DB, h.Hub, "group:"+strconv.FormatInt(b.GroupId, 10))
+
+	if status == "accepted" || status == "invited" {
+		h.Notifier.Notify(Note{Type: "banned_from_group", UserID: b.UserId, ActorID: u.ID, GroupID: b.GroupId})
+	}
+}
+
+// POST /api/groups/unban {groupId, userId} (ban)
+func (h *GroupHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var b struct {
+		GroupId int64  `json:"groupId"`
+		UserId  string `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 || b.UserId == "" {
+		Err(w, 400, "bad json")
+		return
+	}
+	if _, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permBan); !ok {
+		Err(w, 403, "not allowed to unban")
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer tx.Rollback()
+	// a ban that has run out counts as lifted already
+	res, err := tx.Exec(`DELETE FROM group_bans AS b WHERE group_id=? AND user_id=? AND `+groupBanActiveSQL, b.GroupId, b.UserId)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		Err(w, 404, "not banned")
+		return
+	}
+	if err := groupAudit(tx, b.GroupId, u.ID, "member_unbanned", map[string]any{"userId": b.UserId}); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	JSON(w, 200, map[string]any{"ok": true})
+}
+
+// GET /api/groups/bans?groupId=123 -> the users banned now, newest first (ban)
+func (h *GroupHandler) Bans(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodGet {
+		Err(w, 405, "method")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(r.URL.Query().Get("groupId"), 10, 64)
+	if err != nil {
+		Err(w, 400, "groupId required")
+		return
+	}
+	if _, ok := groupAuthorize(h.DB, groupID, u.ID, permBan); !ok {
+		Err(w, 403, "not allowed to see bans")
+		return
+	}
+
+	rows, err := h.DB.Query(`
+SELECT b.user_id, COALESCE(`+displayNameSQL+`, ''), b.banned_by,
+       COALESCE((SELECT `+displayNameSQL+` FROM users u WHERE u.id = b.banned_by), ''), b.reason, b.expires_at, b.created_at
+FROM group_bans b LEFT JOIN users u ON u.id = b.user_id
+WHERE b.group_id = ? AND `+groupBanActiveSQL+`
+ORDER BY b.created_at DESC`, groupID)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer rows.Close()
+	out := []GroupBan{}
+	for rows.Next() {
+		var x GroupBan
+		if rows.Scan(&x.UserID, &x.Name, &x.BannedBy, &x.BannedByName, &x.Reason, &x.ExpiresAt, &x.CreatedAt) == nil {
+			out = append(out, x)
+		}
+	}
+	JSON(w, 200, out)
+}
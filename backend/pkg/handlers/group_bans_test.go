@@ -0,0 +1,50 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"social-network/backend/pkg/ws"
+)
+
+// TestBanNotifiesOnlyMembers checks that banning someone who was never in
+// a secret group doesn't tell them it exists.
+func TestBanNotifiesOnlyMembers(t *testing.T) {
+	db := testDB(t)
+	_, annCookie := testUser(t, db, "ann")
+	testUser(t, db, "bob")
+	testUser(t, db, "cat")
+	for _, q := range []string{
+		`INSERT INTO groups (id, owner_id, title, description, visibility) VALUES (1, 'ann-id', 'hidden', '', 'secret')`,
+		`INSERT INTO group_members (group_id, user_id, role, status) VALUES (1, 'ann-id', 'owner', 'accepted')`,
+		`INSERT INTO group_members (group_id, user_id, role, status) VALUES (1, 'bob-id', 'member', 'accepted')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hub := ws.NewHub()
+	h := &GroupHandler{DB: db, Hub: hub, Notifier: NewNotifier(db, hub)}
+
+	for _, id := range []string{"bob-id", "cat-id"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/groups/ban", strings.NewReader(`{"groupId":1,"userId":"`+id+`"}`))
+		req.AddCookie(annCookie)
+		rec := httptest.NewRecorder()
+		h.Ban(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("ban %s: %d %s", id, rec.Code, rec.Body)
+		}
+	}
+
+	for id, want := range map[string]int{"bob-id": 1, "cat-id": 0} {
+		var n int
+		_ = db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id=? AND type='banned_from_group'`, id).Scan(&n)
+		if n != want {
+			t.Errorf("%s: %d notifications, want %d", id, n, want)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-network/backend/pkg/auth"
+)
+
+// InviteLink is a shareable way into a group. Its token is only ever shown
+// to whoever creates it, and it only works while they may still invite:
+// once they leave, are kicked, banned or demoted, or lose the permission,
+// their links stop working (and start again if they get it back).
+type InviteLink struct {
+	ID          int64   `json:"id"`
+	GroupID     int64   `json:"groupId"`
+	CreatedBy   string  `json:"createdBy"`
+	CreatorName string  `json:"creatorName"`
+	ExpiresAt   *string `json:"expiresAt,omitempty"`
+	MaxUses     *int    `json:"maxUses,omitempty"`
+	Uses        int     `json:"uses"`
+	RevokedAt   *string `json:"revokedAt,omitempty"`
+	CreatedAt   string  `json:"createdAt"`
+	Active      bool    `json:"active"`
+}
+
+// inviteLinkActiveSQL holds for links l that can still be used.
+const inviteLinkActiveSQL = `(l.revoked_at IS NULL AND (l.expires_at IS NULL OR l.expires_at > datetime('now')) AND (l.max_uses IS NULL OR l.uses < l.max_uses))`
+
+const inviteLinkColumns = `l.id, l.group_id, l.created_by, COALESCE(` + displayNameSQL + `, ''), l.expires_at, l.max_uses, l.uses, l.revoked_at, l.created_at, ` + inviteLinkActiveSQL
+
+func scanInviteLink(row interface{ Scan(...any) error }) (InviteLink, error) {
+	var l InviteLink
+	err := row.Scan(&l.ID, &l.GroupID, &l.CreatedBy, &l.CreatorName, &l.ExpiresAt, &l.MaxUses, &l.Uses, &l.RevokedAt, &l.CreatedAt, &l.Active)
+	return l, err
+}
+
+// GET    /api/groups/invite-links?groupId=123 -> the group's links, newest first (invite)
+// POST   /api/groups/invite-links {groupId, hours?, maxUses?} -> {link, token} (invite)
+// DELETE /api/groups/invite-links?id=5 - revoke a link (invite)
+// Links never expire or run out unless given hours or maxUses.
+func (h *GroupHandler) InviteLinks(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		groupID, err := strconv.ParseInt(r.URL.Query().Get("groupId"), 10, 64)
+		if err != nil {
+			Err(w, 400, "groupId required")
+			return
+		}
+		if _, ok := groupAuthorize(h.DB, groupID, u.ID, permInvite); !ok {
+			Err(w, 403, "not allowed to invite")
+			return
+		}
+		rows, err := h.DB.Query(`
+SELECT `+inviteLinkColumns+`
+FROM group_invite_links l LEFT JOIN users u ON u.id = l.created_by
+WHERE l.group_id = ? ORDER BY l.id DESC`, groupID)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		out := []InviteLink{}
+		for rows.Next() {
+			if l, err := scanInviteLink(rows); err == nil {
+				out = append(out, l)
+			}
+		}
+		rows.Close()
+		canInvite := map[string]bool{}
+		for i, l := range out {
+			ok, seen := canInvite[l.CreatedBy]
+			if !seen {
+				_, ok = groupAuthorize(h.DB, l.GroupID, l.CreatedBy, permInvite)
+				canInvite[l.CreatedBy] = ok
+			}
+			out[i].Active = l.Active && ok
+		}
+		JSON(w, 200, out)
+
+	case http.MethodPost:
+		h.createInviteLink(w, r, u.ID)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			Err(w, 400, "id required")
+			return
+		}
+		var groupID int64
+		if err := h.DB.QueryRow(`SELECT group_id FROM group_invite_links WHERE id=?`, id).Scan(&groupID); err != nil {
+			Err(w, 404, "invite link not found")
+			return
+		}
+		if _, ok := groupAuthorize(h.DB, groupID, u.ID, permInvite); !ok {
+			Err(w, 403, "not allowed to invite")
+			return
+		}
+		tx, err := h.DB.Begin()
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		defer tx.Rollback()
+		res, err := tx.Exec(`UPDATE group_invite_links SET revoked_at=datetime('now') WHERE id=? AND revoked_at IS NULL`, id)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			if err := groupAudit(tx, groupID, u.ID, "invite_link_revoked", map[string]any{"linkId": id}); err != nil {
+				Err(w, 500, "db")
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		JSON(w, 200, map[string]any{"ok": true})
+
+	default:
+		Err(w, 405, "method")
+	}
+}
+
+func (h *GroupHandler) createInviteLink(w http.ResponseWriter, r *http.Request, userID string) {
+	var b struct {
+		GroupId int64 `json:"groupId"`
+		Hours   int   `json:"hours"`
+		MaxUses int   `json:"maxUses"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 {
+		Err(w, 400, "bad json")
+		return
+	}
+	if b.Hours < 0 || b.MaxUses < 0 {
+		Err(w, 400, "hours and maxUses must be positive")
+		return
+	}
+	if b.Hours > maxHours {
+		Err(w, 400, "hours must be at most "+strconv.Itoa(maxHours))
+		return
+	}
+	if _, ok := groupAuthorize(h.DB, b.GroupId, userID, permInvite); !ok {
+		Err(w, 403, "not allowed to invite")
+		return
+	}
+
+	var expiresAt, maxUses any
+	if b.Hours > 0 {
+		expiresAt = time.Now().UTC().Add(time.Duration(b.Hours) * time.Hour).Format("2006-01-02 15:04:05")
+	}
+	if b.MaxUses > 0 {
+		maxUses = b.MaxUses
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		Err(w, 500, "token")
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer tx.Rollback()
+	var id int64
+	if err := tx.QueryRow(`
+INSERT INTO group_invite_links (group_id, token_hash, created_by, expires_at, max_uses) VALUES (?, ?, ?, ?, ?)
+RETURNING id`, b.GroupId, tokenHash(token), userID, expiresAt, maxUses).Scan(&id); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := groupAudit(tx, b.GroupId, userID, "invite_link_created", map[string]any{
+		"linkId": id, "expiresAt": expiresAt, "maxUses": maxUses,
+	}); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	l, err := scanInviteLink(h.DB.QueryRow(`
+SELECT `+inviteLinkColumns+`
+FROM group_invite_links l LEFT JOIN users u ON u.id = l.created_by
+WHERE l.id = ?`, id))
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, map[string]any{"link": l, "token": token})
+}
+
+// GET /api/groups/invite-links/uses?id=5 -> who joined through a link (invite)
+func (h *GroupHandler) InviteLinkUses(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodGet {
+		Err(w, 405, "method")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		Err(w, 400, "id required")
+		return
+	}
+	var groupID int64
+	if err := h.DB.QueryRow(`SELECT group_id FROM group_invite_links WHERE id=?`, id).Scan(&groupID); err != nil {
+		Err(w, 404, "invite link not found")
+		return
+	}
+	if _, ok := groupAuthorize(h.DB, groupID, u.ID, permInvite); !ok {
+		Err(w, 403, "not allowed to invite")
+		return
+	}
+
+	rows, err := h.DB.Query(`
+SELECT lu.user_id, COALESCE(`+displayNameSQL+`, ''), lu.used_at
+FROM group_invite_link_uses lu LEFT JOIN users u ON u.id = lu.user_id
+WHERE lu.link_id = ? ORDER BY lu.id DESC`, id)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer rows.Close()
+	type use struct {
+		UserID string `json:"userId"`
+		Name   string `json:"name"`
+		UsedAt string `json:"usedAt"`
+	}
+	out := []use{}
+	for rows.Next() {
+		var x use
+		if rows.Scan(&x.UserID, &x.Name, &x.UsedAt) == nil {
+			out = append(out, x)
+		}
+	}
+	JSON(w, 200, out)
+}
+
+// inviteLinkByToken finds the link a token belongs to, or says why it
+// can't be used as an HTTP status and error.
+func inviteLinkByToken(db *sql.DB, token string) (InviteLink, int, string) {
+	l, err := scanInviteLink(db.QueryRow(`
+SELECT `+inviteLinkColumns+`
+FROM group_invite_links l LEFT JOIN users u ON u.id = l.created_by
+WHERE l.token_hash = ?`, tokenHash(token)))
+	switch {
+	case err != nil:
+		return l, 404, "invite link not found"
+	case l.RevokedAt != nil:
+		return l, 410, "invite link revoked"
+	case !l.Active && l.MaxUses != nil && l.Uses >= *l.MaxUses:
+		return l, 410, "invite link used up"
+	case !l.Active:
+		return l, 410, "invite link expired"
+	}
+	if _, ok := groupAuthorize(db, l.GroupID, l.CreatedBy, permInvite); !ok {
+		l.Active = false
+		return l, 410, "invite link no longer valid"
+	}
+	return l, 0, ""
+}
+
+// GET  /api/groups/join-link?token=... -> the group the link leads to, to show before joining
+// POST /api/groups/join-link {token} - join straight away, invited or not,
+// whatever the group's visibility
+func (h *GroupHandler) JoinLink(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		l, code, msg := inviteLinkByToken(h.DB, r.URL.Query().Get("token"))
+		if code != 0 {
+			Err(w, code, msg)
+			return
+		}
+		g, err := loadGroupSettings(h.DB, l.GroupID)
+		if err != nil {
+			Err(w, 404, "group not found")
+			return
+		}
+		status := ""
+		_ = h.DB.QueryRow(`SELECT status FROM group_members WHERE group_id=? AND user_id=?`, l.GroupID, u.ID).Scan(&status)
+		JSON(w, 200, map[string]any{"group": g, "invitedBy": l.CreatorName, "myStatus": status})
+
+	case http.MethodPost:
+		var b struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.Token == "" {
+			Err(w, 400, "bad json")
+			return
+		}
+		l, code, msg := inviteLinkByToken(h.DB, b.Token)
+		if code != 0 {
+			Err(w, code, msg)
+			return
+		}
+		if _, ok := groupRole(h.DB, l.GroupID, u.ID); ok {
+			Err(w, 409, "already a member")
+			return
+		}
+		if groupBanned(h.DB, l.GroupID, u.ID) {
+			Err(w, 403, "banned from this group")
+			return
+		}
+
+		tx, err := h.DB.Begin()
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		defer tx.Rollback()
+		// checked again here, in case the last use went while we looked
+		res, err := tx.Exec(`UPDATE group_invite_links AS l SET uses = uses + 1 WHERE id=? AND `+inviteLinkActiveSQL, l.ID)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			Err(w, 410, "invite link expired")
+			return
+		}
+		// a pending invitation or join request is accepted along the way
+		for _, q := range []struct {
+			sql  string
+			args []any
+		}{
+			{`INSERT INTO group_members (group_id, user_id, role, status) VALUES (?, ?, 'member', 'accepted')
+ON CONFLICT (group_id, user_id) DO UPDATE SET status='accepted'`, []any{l.GroupID, u.ID}},
+			{`INSERT INTO group_invite_link_uses (link_id, user_id) VALUES (?, ?)`, []any{l.ID, u.ID}},
+		} {
+			if _, err := tx.Exec(q.sql, q.args...); err != nil {
+				Err(w, 500, "db")
+				return
+			}
+		}
+		if err := groupAudit(tx, l.GroupID, u.ID, "invite_link_used", map[string]any{"linkId": l.ID, "createdBy": l.CreatedBy}); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+
+		JSON(w, 200, map[string]any{"ok": true, "groupId": l.GroupID})
+
+	default:
+		Err(w, 405, "method")
+	}
+}
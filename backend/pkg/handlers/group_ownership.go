@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/ws"
+)
+
+// POST /api/groups/transfer {groupId, userId} - make a member the owner (owner only)
+// The old owner stays on as an admin, and can leave from then on.
+func (h *GroupHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var b struct {
+		GroupId int64  `json:"groupId"`
+		UserId  string `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 || b.UserId == "" {
+		Err(w, 400, "bad json")
+		return
+	}
+
+	if _, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permManageGroup); !ok {
+		Err(w, 403, "not owner")
+		return
+	}
+	if b.UserId == u.ID {
+		Err(w, 400, "already owner")
+		return
+	}
+	if _, ok := groupRole(h.DB, b.GroupId, b.UserId); !ok {
+		Err(w, 404, "not a member")
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer tx.Rollback()
+	for _, q := range []struct {
+		sql  string
+		args []any
+	}{
+		{`UPDATE group_members SET role='admin' WHERE group_id=? AND user_id=?`, []any{b.GroupId, u.ID}},
+		{`UPDATE group_members SET role='owner' WHERE group_id=? AND user_id=?`, []any{b.GroupId, b.UserId}},
+		{`UPDATE groups SET owner_id=? WHERE id=?`, []any{b.UserId, b.GroupId}},
+	} {
+		if _, err := tx.Exec(q.sql, q.args...); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	JSON(w, 200, map[string]any{"ok": true})
+
+	h.Notifier.Notify(Note{Type: "group_new_owner", UserID: b.UserId, ActorID: u.ID, GroupID: b.GroupId})
+	if h.Hub != nil {
+		h.Hub.Broadcast("group:"+strconv.FormatInt(b.GroupId, 10), ws.Message{
+			Type:    "group_owner_changed",
+			Payload: map[string]any{"groupId": b.GroupId, "ownerId": b.UserId, "previousOwnerId": u.ID},
+		})
+	}
+}
+
+// POST /api/groups/demote {groupId, userId, role?: moderator|member} - lower an
+// admin or moderator; to member unless said otherwise (owner only)
+func (h *GroupHandler) Demote(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var b struct {
+		GroupId int64  `json:"groupId"`
+		UserId  string `json:"userId"`
+		Role    string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 || b.UserId == "" {
+		Err(w, 400, "bad json")
+		return
+	}
+	if b.Role == "" {
+		b.Role = "member"
+	}
+	if b.Role != "moderator" && b.Role != "member" {
+		Err(w, 400, "role must be moderator or member")
+		return
+	}
+
+	if _, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permManageGroup); !ok {
+		Err(w, 403, "only owner can demote")
+		return
+	}
+
+	// only ever downwards, and never the owner
+	current, ok := groupRole(h.DB, b.GroupId, b.UserId)
+	if !ok || current == "owner" || roleRank[current] <= roleRank[b.Role] {
+		Err(w, 404, "user not found or not above "+b.Role)
+		return
+	}
+	_, err = h.DB.Exec(`UPDATE group_members SET role=? WHERE group_id=? AND user_id=? AND status='accepted'`, b.Role, b.GroupId, b.UserId)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	JSON(w, 200, map[string]any{"ok": true})
+}
+
+// DELETE /api/groups/delete?groupId=123 (owner only)
+// Takes the group with its members, invitations, messages and events (and
+// everything hanging off those), then its cover and chat files unless used
+// elsewhere; its former members are told.
+func (h *GroupHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		Err(w, 405, "method")
+		return
+	}
+
+	groupID, err := strconv.ParseInt(r.URL.Query().Get("groupId"), 10, 64)
+	if err != nil {
+		Err(w, 400, "groupId required")
+		return
+	}
+	if _, ok := groupAuthorize(h.DB, groupID, u.ID, permManageGroup); !ok {
+		Err(w, 403, "not owner")
+		return
+	}
+
+	var title string
+	_ = h.DB.QueryRow(`SELECT title FROM groups WHERE id=?`, groupID).Scan(&title)
+	members := groupMemberIDs(h.DB, groupID)
+
+	// the attachment rows go with the messages, so collect the files first
+	var urls []string
+	rows, err := h.DB.Query(`
+SELECT cover_url FROM groups WHERE id=? AND cover_url LIKE '/uploads/%'
+UNION
+SELECT '/uploads/' || a.name FROM media_attachments a
+JOIN group_messages gm ON gm.id = a.group_message_id WHERE gm.group_id=?`, groupID, groupID)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	for rows.Next() {
+		var url string
+		if rows.Scan(&url) == nil {
+			urls = append(urls, url)
+		}
+	}
+	rows.Close()
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer tx.Rollback()
+	gid := strconv.FormatInt(groupID, 10)
+	// events, their responses and reminders, and the role permissions go
+	// with the group through their foreign keys
+	for _, q := range []struct {
+		sql  string
+		args []any
+	}{
+		{`DELETE FROM group_messages WHERE group_id=?`, []any{groupID}},
+		{`DELETE FROM group_members WHERE group_id=?`, []any{groupID}},
+		{`DELETE FROM notification_mutes WHERE target_type='group' AND target_id=?`, []any{gid}},
+		{`DELETE FROM groups WHERE id=?`, []any{groupID}},
+	} {
+		if _, err := tx.Exec(q.sql, q.args...); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	JSON(w, 200, map[string]any{"ok": true})
+	deleteUnusedMedia(h.DB, h.Store, urls)
+
+	var others []string
+	for _, id := range members {
+		if id != u.ID {
+			others = append(others, id)
+		}
+	}
+	h.Notifier.NotifyAll(others, Note{
+		Type: "group_deleted", ActorID: u.ID, GroupID: groupID,
+		Extra: map[string]any{"groupTitle": title},
+	})
+	if h.Hub != nil {
+		msg := ws.Message{Type: "group_deleted", Payload: map[string]any{"groupId": groupID, "title": title}}
+		h.Hub.Broadcast("group:"+gid, msg)
+		// for those without the group open, e.g. to drop it from their list
+		for _, id := range members {
+			h.Hub.Broadcast("user:"+id, msg)
+		}
+		recheckRoom(h.DB, h.Hub, "group:"+gid)
+	}
+}
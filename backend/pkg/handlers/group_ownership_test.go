@@ -0,0 +1,64 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"social-network/backend/pkg/storage"
+)
+
+// TestGroupDeleteRemovesMedia checks that deleting a group removes its cover
+// and chat files, but not one still used as an avatar.
+func TestGroupDeleteRemovesMedia(t *testing.T) {
+	db := testDB(t)
+	_, annCookie := testUser(t, db, "ann")
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, name := range []string{"cover.png", "chat.png", "avatar.png"} {
+		if err := store.Put(ctx, name, strings.NewReader("x"), 1, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{
+		`INSERT INTO media (name, owner_id) VALUES ('cover.png', 'ann-id'), ('chat.png', 'ann-id'), ('avatar.png', 'ann-id')`,
+		`UPDATE users SET avatar_url='/uploads/avatar.png' WHERE id='ann-id'`,
+		`INSERT INTO media_attachments (name, user_id) VALUES ('avatar.png', 'ann-id')`,
+		`INSERT INTO groups (id, owner_id, title, description, cover_url) VALUES (1, 'ann-id', 'g', '', '/uploads/cover.png')`,
+		`INSERT INTO group_members (group_id, user_id, role, status) VALUES (1, 'ann-id', 'owner', 'accepted')`,
+		`INSERT INTO group_messages (id, group_id, sender_id, body) VALUES (1, 1, 'ann-id', 'see /uploads/chat.png and /uploads/avatar.png')`,
+		`INSERT INTO media_attachments (name, group_message_id) VALUES ('chat.png', 1), ('avatar.png', 1)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/groups/delete?groupId=1", nil)
+	req.AddCookie(annCookie)
+	rec := httptest.NewRecorder()
+	(&GroupHandler{DB: db, Store: store}).Delete(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+	}
+
+	for name, kept := range map[string]bool{"cover.png": false, "chat.png": false, "avatar.png": true} {
+		_, err := store.Stat(ctx, name)
+		if gone := errors.Is(err, storage.ErrNotFound); gone == kept {
+			t.Errorf("%s: stat %v, want kept=%v", name, err, kept)
+		}
+		var n int
+		_ = db.QueryRow(`SELECT COUNT(*) FROM media WHERE name=?`, name).Scan(&n)
+		if (n == 1) != kept {
+			t.Errorf("%s: %d media rows, want kept=%v", name, n, kept)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"social-network/backend/pkg/auth"
+)
+
+// groupPermission is something a member may be allowed to do in a group.
+type groupPermission string
+
+const (
+	permPost         groupPermission = "post" // send group messages
+	permCreateEvents groupPermission = "create_events"
+	permInvite       groupPermission = "invite"
+	permApproveJoins groupPermission = "approve_joins" // see, approve and reject join requests
+	permKick         groupPermission = "kick"          // remove members of a lower role
+	permModerate     groupPermission = "moderate"      // edit, cancel and delete others' events
+	permEditGroup    groupPermission = "edit_group"    // title, description, cover and rules; the audit log
+	permBan          groupPermission = "ban"           // ban members of a lower role, lift bans, see the ban list
+
+	// roles, permissions and group settings; owner only, not configurable
+	permManageGroup groupPermission = "manage_group"
+)
+
+// groupPermissions are the permissions an owner can hand out, in order.
+var groupPermissions = []groupPermission{permPost, permCreateEvents, permInvite, permApproveJoins, permKick, permModerate, permEditGroup, permBan}
+
+// groupRoles are the roles below owner, highest first.
+var groupRoles = []string{"admin", "moderator", "member"}
+
+// roleRank orders roles; a member can only act on (kick, demote) lower ones.
+var roleRank = map[string]int{"owner": 4, "admin": 3, "moderator": 2, "member": 1}
+
+// groupPermissionDefaults is what each role may do until the owner says
+// otherwise. Only owners kick by default.
+var groupPermissionDefaults = map[string][]groupPermission{
+	"admin":     {permPost, permCreateEvents, permInvite, permApproveJoins, permModerate, permEditGroup, permBan},
+	"moderator": {permPost, permModerate},
+	"member":    {permPost},
+}
+
+func validGroupPermission(p groupPermission) bool {
+	for _, q := range groupPermissions {
+		if p == q {
+			return true
+		}
+	}
+	return false
+}
+
+// groupRole is userID's role in the group, if they are an accepted member.
+func groupRole(db *sql.DB, groupID any, userID string) (string, bool) {
+	var role string
+	err := db.QueryRow(`SELECT role FROM group_members WHERE group_id=? AND user_id=? AND status='accepted'`, groupID, userID).Scan(&role)
+	return role, err == nil
+}
+
+// groupAuthorize is the check every group handler makes before letting a
+// member act: it returns userID's role and whether they are an accepted
+// member whose role has perm in this group.
+func groupAuthorize(db *sql.DB, groupID any, userID string, perm groupPermission) (string, bool) {
+	role, ok := groupRole(db, groupID, userID)
+	if !ok {
+		return "", false
+	}
+	return role, roleAllowed(db, groupID, role, perm)
+}
+
+// roleAllowed reports whether role has perm in the group.
+func roleAllowed(db *sql.DB, groupID any, role string, perm groupPermission) bool {
+	if role == "owner" {
+		return true
+	}
+	if perm == permManageGroup {
+		return false
+	}
+	var allowed bool
+	err := db.QueryRow(`SELECT allowed FROM group_role_permissions WHERE group_id=? AND role=? AND permission=?`,
+		groupID, role, perm).Scan(&allowed)
+	if err == nil {
+		return allowed
+	}
+	for _, p := range groupPermissionDefaults[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// rolePermissions lists what each role may do in the group.
+func rolePermissions(db *sql.DB, groupID any) map[string][]groupPermission {
+	out := map[string][]groupPermission{}
+	for _, role := range append([]string{"owner"}, groupRoles...) {
+		out[role] = []groupPermission{}
+		for _, p := range groupPermissions {
+			if roleAllowed(db, groupID, role, p) {
+				out[role] = append(out[role], p)
+			}
+		}
+	}
+	return out
+}
+
+// groupUsersWith lists the accepted members allowed perm, e.g. everyone
+// to tell about a join request.
+func groupUsersWith(db *sql.DB, groupID int64, perm groupPermission) []string {
+	rows, err := db.Query(`SELECT user_id, role FROM group_members WHERE group_id=? AND status='accepted'`, groupID)
+	if err != nil {
+		return nil
+	}
+	type member struct{ id, role string }
+	var members []member
+	for rows.Next() {
+		var m member
+		if rows.Scan(&m.id, &m.role) == nil {
+			members = append(members, m)
+		}
+	}
+	rows.Close()
+
+	allowed := map[string]bool{}
+	var ids []string
+	for _, m := range members {
+		ok, seen := allowed[m.role]
+		if !seen {
+			ok = roleAllowed(db, groupID, m.role, perm)
+			allowed[m.role] = ok
+		}
+		if ok {
+			ids = append(ids, m.id)
+		}
+	}
+	return ids
+}
+
+// GET /api/groups/permissions?groupId=123 -> {roles: {owner: [...], admin: [...], ...}, myRole, myPermissions}
+// PUT /api/groups/permissions {groupId, roles: {admin?: [...], moderator?: [...], member?: [...]}} (owner only)
+// A role given gets exactly the permissions listed: post, create_events,
+// invite, approve_joins, kick, moderate, edit_group, ban. Owners always have
+// all of them.
+func (h *GroupHandler) Permissions(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	var groupID int64
+	switch r.Method {
+	case http.MethodGet:
+		if groupID, err = strconv.ParseInt(r.URL.Query().Get("groupId"), 10, 64); err != nil {
+			Err(w, 400, "groupId required")
+			return
+		}
+		if _, ok := groupRole(h.DB, groupID, u.ID); !ok {
+			Err(w, 403, "not a member")
+			return
+		}
+
+	case http.MethodPut:
+		var b struct {
+			GroupId int64                        `json:"groupId"`
+			Roles   map[string][]groupPermission `json:"roles"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 {
+			Err(w, 400, "bad json")
+			return
+		}
+		groupID = b.GroupId
+		if _, ok := groupAuthorize(h.DB, groupID, u.ID, permManageGroup); !ok {
+			Err(w, 403, "not owner")
+			return
+		}
+		for role, perms := range b.Roles {
+			if _, ok := groupPermissionDefaults[role]; !ok {
+				Err(w, 400, "unknown role "+role)
+				return
+			}
+			for _, p := range perms {
+				if !validGroupPermission(p) {
+					Err(w, 400, "unknown permission "+string(p))
+					return
+				}
+			}
+		}
+		if err := h.setRolePermissions(groupID, b.Roles); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+
+	default:
+		Err(w, 405, "method")
+		return
+	}
+
+	role, _ := groupRole(h.DB, groupID, u.ID)
+	roles := rolePermissions(h.DB, groupID)
+	JSON(w, 200, map[string]any{"roles": roles, "myRole": role, "myPermissions": roles[role]})
+}
+
+func (h *GroupHandler) setRolePermissions(groupID int64, roles map[string][]groupPermission) error {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for role, perms := range roles {
+		given := map[groupPermission]bool{}
+		for _, p := range perms {
+			given[p] = true
+		}
+		for _, p := range groupPermissions {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO group_role_permissions (group_id, role, permission, allowed) VALUES (?, ?, ?, ?)`,
+				groupID, role, p, given[p]); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
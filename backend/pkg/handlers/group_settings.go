@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/storage"
+	"social-network/backend/pkg/ws"
+)
+
+// maxGroupRules caps the length of a group's rules text.
+const maxGroupRules = 10000
+
+// GroupSettings is a group with everything its settings page shows.
+type GroupSettings struct {
+	Group
+	Rules     *string `json:"rules,omitempty"`
+	UpdatedAt *string `json:"updatedAt,omitempty"`
+}
+
+func loadGroupSettings(db *sql.DB, groupID int64) (GroupSettings, error) {
+	var g GroupSettings
+	err := db.QueryRow(`
+SELECT id, title, description, owner_id, visibility, cover_url, created_at, rules, updated_at
+FROM groups WHERE id=?`, groupID).
+		Scan(&g.ID, &g.Title, &g.Description, &g.OwnerID, &g.Visibility, &g.CoverURL, &g.CreatedAt, &g.Rules, &g.UpdatedAt)
+	return g, err
+}
+
+// GET /api/groups/settings?groupId=123 - the group with its rules; for
+// anyone who can find it
+// PUT /api/groups/settings {groupId, title?, description?, coverUrl?, rules?} (edit_group)
+// Only the fields given change; "" clears the description, cover and rules.
+// The cover must be an image the editor uploaded. Each edit is logged in the
+// audit log and sent to group:<id> as group_updated.
+func (h *GroupHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		groupID, err := strconv.ParseInt(r.URL.Query().Get("groupId"), 10, 64)
+		if err != nil {
+			Err(w, 400, "groupId required")
+			return
+		}
+		// private groups show who they are to those thinking of joining
+		if code, msg := groupReadDenied(h.DB, groupID, u.ID); code == 404 {
+			Err(w, code, msg)
+			return
+		}
+		g, err := loadGroupSettings(h.DB, groupID)
+		if err != nil {
+			Err(w, 404, "group not found")
+			return
+		}
+		JSON(w, 200, g)
+
+	case http.MethodPut:
+		h.updateSettings(w, r, u.ID)
+
+	default:
+		Err(w, 405, "method")
+	}
+}
+
+func (h *GroupHandler) updateSettings(w http.ResponseWriter, r *http.Request, userID string) {
+	var b struct {
+		GroupId     int64   `json:"groupId"`
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		CoverURL    *string `json:"coverUrl"`
+		Rules       *string `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 {
+		Err(w, 400, "bad json")
+		return
+	}
+
+	if _, ok := groupAuthorize(h.DB, b.GroupId, userID, permEditGroup); !ok {
+		Err(w, 403, "not allowed to edit the group")
+		return
+	}
+	g, err := loadGroupSettings(h.DB, b.GroupId)
+	if err != nil {
+		Err(w, 404, "group not found")
+		return
+	}
+
+	var changes []string
+	before, after := map[string]any{}, map[string]any{}
+	set := func(name string, field **string, v *string) {
+		if v == nil {
+			return
+		}
+		var cur string
+		if *field != nil {
+			cur = **field
+		}
+		if *v == cur {
+			return
+		}
+		before[name], after[name] = *field, nullIfEmpty(*v)
+		*field = v
+		if *v == "" {
+			*field = nil
+		}
+		changes = append(changes, name)
+	}
+
+	if b.Title != nil {
+		t := strings.TrimSpace(*b.Title)
+		if t == "" {
+			Err(w, 400, "title is required")
+			return
+		}
+		if t != g.Title {
+			before["title"], after["title"] = g.Title, t
+			g.Title = t
+			changes = append(changes, "title")
+		}
+	}
+	set("description", &g.Description, b.Description)
+	if b.CoverURL != nil && *b.CoverURL != "" {
+		if !h.ownImage(userID, *b.CoverURL) {
+			Err(w, 400, "coverUrl must be an image you uploaded")
+			return
+		}
+	}
+	set("coverUrl", &g.CoverURL, b.CoverURL)
+	if b.Rules != nil && len(*b.Rules) > maxGroupRules {
+		Err(w, 400, "rules too long")
+		return
+	}
+	set("rules", &g.Rules, b.Rules)
+
+	if len(changes) == 0 {
+		JSON(w, 200, g)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE groups SET title=?, description=?, cover_url=?, rules=?, updated_at=datetime('now') WHERE id=?`,
+		g.Title, g.Description, g.CoverURL, g.Rules, g.ID); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := groupAudit(tx, g.ID, userID, "group_updated", map[string]any{"changes": changes, "before": before, "after": after}); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	if g, err = loadGroupSettings(h.DB, g.ID); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, g)
+
+	if h.Hub != nil {
+		h.Hub.Broadcast("group:"+strconv.FormatInt(g.ID, 10), ws.Message{
+			Type:    "group_updated",
+			Payload: map[string]any{"group": g, "changes": changes, "updatedBy": userID},
+		})
+	}
+}
+
+// ownImage reports whether url is an image (or GIF) userID uploaded.
+func (h *GroupHandler) ownImage(userID, url string) bool {
+	name := strings.TrimPrefix(url, "/uploads/")
+	if name == url || !storage.ValidName(name) {
+		return false
+	}
+	var n int
+	_ = h.DB.QueryRow(`SELECT COUNT(*) FROM media WHERE name=? AND owner_id=? AND media_type IN ('image', 'gif')`, name, userID).Scan(&n)
+	return n > 0
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"social-network/backend/pkg/auth"
+)
+
+// Group visibilities:
+//   - public: anyone can read its messages, members and events, and join
+//   - private: discoverable, joined by request
+//   - secret: invite only, hidden from everyone not in or invited to it
+const (
+	groupPublic  = "public"
+	groupPrivate = "private"
+	groupSecret  = "secret"
+)
+
+func validGroupVisibility(v string) bool {
+	return v == groupPublic || v == groupPrivate || v == groupSecret
+}
+
+// visibleGroupSQL keeps the groups g the user given as its argument can
+// find: all but the secret ones they aren't in or invited to.
+const visibleGroupSQL = `(g.visibility != 'secret' OR EXISTS (
+	SELECT 1 FROM group_members vm WHERE vm.group_id = g.id AND vm.user_id = ? AND vm.status IN ('invited', 'accepted')))`
+
+// groupReadDenied tells why userID can't read a group's messages, members
+// and events, as an HTTP status and error: 404 if the group doesn't exist
+// or is hidden from them, 403 if they'd have to be a member. 0 if they can.
+func groupReadDenied(db *sql.DB, groupID any, userID string) (int, string) {
+	var visibility string
+	var status sql.NullString
+	err := db.QueryRow(`
+SELECT g.visibility, m.status FROM groups g
+LEFT JOIN group_members m ON m.group_id = g.id AND m.user_id = ?
+WHERE g.id = ?`, userID, groupID).Scan(&visibility, &status)
+	switch {
+	case err != nil:
+		return 404, "group not found"
+	case status.String == "accepted" || visibility == groupPublic:
+		return 0, ""
+	case visibility == groupSecret && status.String != "invited":
+		return 404, "group not found"
+	}
+	return 403, "not a member"
+}
+
+// POST /api/groups/visibility {groupId, visibility: public|private|secret} (owner only)
+// Making a group public lets in everyone waiting for approval.
+func (h *GroupHandler) SetVisibility(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauth")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var b struct {
+		GroupId    int64  `json:"groupId"`
+		Visibility string `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil || b.GroupId == 0 {
+		Err(w, 400, "bad json")
+		return
+	}
+	if !validGroupVisibility(b.Visibility) {
+		Err(w, 400, "visibility must be public, private or secret")
+		return
+	}
+
+	if _, ok := groupAuthorize(h.DB, b.GroupId, u.ID, permManageGroup); !ok {
+		Err(w, 403, "not owner")
+		return
+	}
+
+	if _, err := h.DB.Exec(`UPDATE groups SET visibility=? WHERE id=?`, b.Visibility, b.GroupId); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	var admitted []string
+	if b.Visibility == groupPublic {
+		rows, err := h.DB.Query(`UPDATE group_members SET status='accepted' WHERE group_id=? AND status='requested' RETURNING user_id`, b.GroupId)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		for rows.Next() {
+			var id string
+			if rows.Scan(&id) == nil {
+				admitted = append(admitted, id)
+			}
+		}
+		rows.Close()
+	}
+
+	JSON(w, 200, map[string]any{"ok": true, "visibility": b.Visibility})
+	recheckRoom(h.DB, h.Hub, "group:"+strconv.FormatInt(b.GroupId, 10))
+	h.Notifier.NotifyAll(admitted, Note{Type: "group_join_approved", ActorID: u.ID, GroupID: b.GroupId})
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/storage"
+)
+
+// MediaHandler serves files from the media store, but only to viewers
+// allowed to see the resource that references them (post, message, avatar).
+// A signed, expiring URL (?exp=<unix>&sig=<hex>) grants access without a session.
+type MediaHandler struct {
+	DB     *sql.DB
+	Store  storage.MediaStore
+	Secret []byte // HMAC key for signed URLs
+}
+
+const maxSignedURLTTL = 7 * 24 * time.Hour
+
+// NewMediaHandler uses key to sign share URLs. With an empty key a random one
+// is generated, so signed URLs only stay valid until the server restarts.
+func NewMediaHandler(db *sql.DB, store storage.MediaStore, key string) *MediaHandler {
+	secret := []byte(key)
+	if key == "" {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal("media: signing key: ", err)
+		}
+		log.Println("media: MEDIA_SIGNING_KEY not set; signed URLs will not survive a restart")
+	}
+	return &MediaHandler{DB: db, Store: store, Secret: secret}
+}
+
+// GET /uploads/<name>[?exp=<unix>&sig=<hex>]
+func (h *MediaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		Err(w, 405, "method")
+		return
+	}
+
+	// only plain file names; no sub-paths, no directory listing
+	name := strings.TrimPrefix(r.URL.Path, "/uploads/")
+	if !storage.ValidName(name) {
+		Err(w, 404, "not found")
+		return
+	}
+
+	cache := ""
+	if exp, sig := r.URL.Query().Get("exp"), r.URL.Query().Get("sig"); sig != "" {
+		expAt, err := strconv.ParseInt(exp, 10, 64)
+		left := time.Until(time.Unix(expAt, 0))
+		if err != nil || left <= 0 || !hmac.Equal([]byte(sig), []byte(h.sign(name, expAt))) {
+			Err(w, 403, "invalid or expired link")
+			return
+		}
+		cache = fmt.Sprintf("private, max-age=%d", int(left.Seconds()))
+	} else {
+		viewerID := ""
+		if u, err := auth.FromRequest(h.DB, r); err == nil {
+			viewerID = u.ID
+		}
+		ok, public, err := canViewMedia(h.DB, name, viewerID)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		if !ok {
+			// don't reveal whether the file exists
+			Err(w, 404, "not found")
+			return
+		}
+		if public {
+			cache = "public, max-age=86400"
+		} else {
+			cache = "private, max-age=300"
+			w.Header().Set("Vary", "Cookie")
+		}
+	}
+
+	storeErr := func(err error) {
+		if errors.Is(err, storage.ErrNotFound) {
+			Err(w, 404, "not found")
+		} else {
+			log.Println("media get:", err)
+			Err(w, 502, "storage")
+		}
+	}
+
+	// a HEAD or a revalidation is answered from the metadata alone, which
+	// for a remote store saves fetching the whole object
+	inm := r.Header.Get("If-None-Match")
+	if r.Method == http.MethodHead || inm != "" {
+		info, err := h.Store.Stat(r.Context(), name)
+		if err != nil {
+			storeErr(err)
+			return
+		}
+		w.Header().Set("Cache-Control", cache)
+		w.Header().Set("ETag", info.ETag)
+		if info.ETag != "" && inm == info.ETag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.Method == http.MethodHead {
+			setMediaHeaders(w, info)
+			return
+		}
+	}
+
+	f, info, err := h.Store.Get(r.Context(), name)
+	if err != nil {
+		storeErr(err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Cache-Control", cache)
+	w.Header().Set("ETag", info.ETag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// ServeContent answers If-Modified-Since / Range for us
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, name, info.ModTime, rs)
+		return
+	}
+	// remote backends stream without seeking
+	setMediaHeaders(w, info)
+	_, _ = io.Copy(w, f)
+}
+
+// setMediaHeaders describes a file being sent whole.
+func setMediaHeaders(w http.ResponseWriter, info *storage.Info) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+// POST /api/media/sign {url, ttl} -> {url, expiresAt}
+// ttl is in seconds (default 1h, max 7 days). Only viewers who can see the
+// file themselves may create a share link for it.
+func (h *MediaHandler) Sign(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var body struct {
+		URL string `json:"url"`
+		TTL int64  `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !strings.HasPrefix(body.URL, "/uploads/") {
+		Err(w, 400, "bad json")
+		return
+	}
+	name := strings.TrimPrefix(body.URL, "/uploads/")
+	if i := strings.IndexByte(name, '?'); i >= 0 {
+		name = name[:i]
+	}
+
+	ttl := time.Hour
+	if body.TTL > 0 {
+		ttl = time.Duration(body.TTL) * time.Second
+	}
+	if ttl > maxSignedURLTTL {
+		ttl = maxSignedURLTTL
+	}
+
+	ok, _, err := canViewMedia(h.DB, name, u.ID)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if !ok {
+		Err(w, 404, "not found")
+		return
+	}
+
+	exp := time.Now().Add(ttl).Unix()
+	JSON(w, 200, map[string]any{
+		"url":       fmt.Sprintf("/uploads/%s?exp=%d&sig=%s", name, exp, h.sign(name, exp)),
+		"expiresAt": time.Unix(exp, 0).UTC().Format("2006-01-02 15:04:05"),
+	})
+}
+
+func (h *MediaHandler) sign(name string, exp int64) string {
+	m := hmac.New(sha256.New, h.Secret)
+	m.Write([]byte(name + "\n" + strconv.FormatInt(exp, 10)))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// canViewMedia checks the uploaded file against every resource that links to it.
+// public reports whether anyone (even logged out) may see it, for cache headers.
+//   - avatars are public, as are the covers of groups that aren't secret
+//   - post images follow canViewPost
+//   - files attached to chat messages are visible to the DM pair / accepted
+//     group members (or anyone, in a public group)
+//   - secret groups' covers are visible to their members and invitees
+//   - anything else only to the uploader
+//
+// Avatars and chat files count only through media_attachments, which only
+// the uploader can create: a profile or message merely naming someone
+// else's file grants nothing.
+func canViewMedia(db *sql.DB, name, viewerID string) (ok, public bool, err error) {
+	url := "/uploads/" + name
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM media_attachments WHERE name=? AND user_id IS NOT NULL`, name).Scan(&n); err != nil {
+		return false, false, err
+	}
+	if n > 0 {
+		return true, true, nil
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM groups WHERE cover_url=? AND visibility != 'secret'`, url).Scan(&n); err != nil {
+		return false, false, err
+	}
+	if n > 0 {
+		return true, true, nil
+	}
+
+	rows, err := db.Query(`
+SELECT p.id, p.visibility FROM post_media pm JOIN posts p ON p.id = pm.post_id WHERE pm.url=? OR pm.poster_url=?
+UNION
+SELECT id, visibility FROM posts WHERE image_url=?`, url, url, url)
+	if err != nil {
+		return false, false, err
+	}
+	var postIDs []string
+	for rows.Next() {
+		var id, vis string
+		if err := rows.Scan(&id, &vis); err == nil {
+			if vis == "public" {
+				rows.Close()
+				return true, true, nil
+			}
+			postIDs = append(postIDs, id)
+		}
+	}
+	rows.Close()
+	for _, id := range postIDs {
+		if ok, _ := canViewPost(db, id, viewerID); ok {
+			return true, false, nil
+		}
+	}
+
+	if viewerID == "" {
+		return false, false, nil
+	}
+
+	if err := db.QueryRow(`
+SELECT COUNT(*) FROM media_attachments a JOIN dm_messages dm ON dm.id = a.dm_message_id
+WHERE a.name=? AND (dm.sender_id=? OR dm.recipient_id=?)`, name, viewerID, viewerID).Scan(&n); err != nil {
+		return false, false, err
+	}
+	if n > 0 {
+		return true, false, nil
+	}
+
+	if err := db.QueryRow(`
+SELECT COUNT(*) FROM media_attachments a
+JOIN group_messages gm ON gm.id = a.group_message_id
+JOIN groups g ON g.id = gm.group_id
+LEFT JOIN group_members m ON m.group_id = gm.group_id AND m.user_id=? AND m.status='accepted'
+WHERE a.name=? AND (m.user_id IS NOT NULL OR g.visibility = 'public')`, viewerID, name).Scan(&n); err != nil {
+		return false, false, err
+	}
+	if n > 0 {
+		return true, false, nil
+	}
+
+	if err := db.QueryRow(`
+SELECT COUNT(*) FROM groups g
+JOIN group_members m ON m.group_id = g.id AND m.user_id=? AND m.status IN ('invited', 'accepted')
+WHERE g.cover_url=?`, viewerID, url).Scan(&n); err != nil {
+		return false, false, err
+	}
+	if n > 0 {
+		return true, false, nil
+	}
+
+	var ownerID sql.NullString
+	err = db.QueryRow(`SELECT owner_id FROM media WHERE name=?`, name).Scan(&ownerID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, false, err
+	}
+	return ownerID.Valid && ownerID.String == viewerID, false, nil
+}
+
+// claimAvatar makes an upload the avatar of a user signing up. The account
+// didn't exist when the image was uploaded, so it must be a logged-out upload
+// nobody has claimed yet; the new user becomes its owner.
+func claimAvatar(tx *sql.Tx, userID, url string) (bool, error) {
+	name := strings.TrimPrefix(url, "/uploads/")
+	if name == url || !storage.ValidName(name) {
+		return false, nil
+	}
+	res, err := tx.Exec(`UPDATE media SET owner_id=? WHERE name=? AND owner_id IS NULL AND media_type IN ('image', 'gif')`, userID, name)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	_, err = tx.Exec(`INSERT INTO media_attachments (name, user_id) VALUES (?, ?)`, name, userID)
+	return err == nil, err
+}
+
+// uploadRef matches a link to an uploaded file in message text.
+var uploadRef = regexp.MustCompile(`/uploads/([A-Za-z0-9_-]+(?:\.[A-Za-z0-9]+)?)`)
+
+// attachChatMedia records the files linked in a chat message as attached to
+// it (column is dm_message_id or group_message_id), along with their poster
+// frames. Only files the sender uploaded are attached; links to anyone
+// else's stay plain text.
+func attachChatMedia(db dbtx, column string, messageID int64, senderID, body string) error {
+	seen := map[string]bool{}
+	for _, m := range uploadRef.FindAllStringSubmatch(body, -1) {
+		name := m[1]
+		if seen[name] || !storage.ValidName(name) {
+			continue
+		}
+		seen[name] = true
+		if _, err := db.Exec(`
+INSERT INTO media_attachments (name, `+column+`)
+SELECT name, ? FROM media
+WHERE owner_id=? AND (name=? OR '/uploads/' || name = (SELECT poster_url FROM media WHERE name=?))`,
+			messageID, senderID, name, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"time"
+)
+
+// Limits for uploaded media. Clips are meant to be short loops, not films.
+const (
+	maxImageBytes    = 10 << 20
+	maxVideoBytes    = 50 << 20
+	maxClipDuration  = 60 * time.Second
+	maxGIFDimension  = 4096
+	maxGIFFrames     = 2000
+	maxGIFPixels     = 400 << 20 // all frames together
+	gifZeroDelaySecs = 0.1       // browsers play 0-delay frames at ~100ms
+)
+
+var (
+	errClipTooLong     = errors.New("clip too long")
+	errUnknownDuration = errors.New("cannot read clip duration")
+)
+
+// probeGIF reads an animated (or still) GIF, returning its play time and a
+// PNG of the first frame to use as poster. The frames are counted without
+// decoding them (see gifDuration), so a small file can't make us inflate
+// thousands of full-canvas frames; only the first is decoded.
+func probeGIF(r io.ReadSeeker) (time.Duration, []byte, error) {
+	cfg, err := gif.DecodeConfig(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if cfg.Width > maxGIFDimension || cfg.Height > maxGIFDimension {
+		return 0, nil, errors.New("gif too large")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	secs, err := gifDuration(bufio.NewReader(r))
+	if err != nil {
+		return 0, nil, err
+	}
+	dur, err := clipDuration(secs)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	first, err := gif.Decode(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	// the first frame may cover only part of the canvas
+	canvas := image.NewRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+	draw.Draw(canvas, first.Bounds(), first, first.Bounds().Min, draw.Over)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return 0, nil, err
+	}
+	return dur, buf.Bytes(), nil
+}
+
+// gifDuration walks a GIF's blocks, skipping the image data, and adds up the
+// frame delays in seconds. It stops at maxGIFFrames frames or maxGIFPixels
+// pixels, before the decoder would have to hold them.
+func gifDuration(r *bufio.Reader) (float64, error) {
+	errBad := errors.New("invalid gif")
+	var hdr [13]byte // signature and logical screen descriptor
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, errBad
+	}
+	width, height := int(binary.LittleEndian.Uint16(hdr[6:8])), int(binary.LittleEndian.Uint16(hdr[8:10]))
+	if err := skipColorTable(r, hdr[10]); err != nil {
+		return 0, errBad
+	}
+
+	var secs float64
+	frames, pixels, delay := 0, 0, 0
+	for {
+		block, err := r.ReadByte()
+		if err != nil {
+			return 0, errBad
+		}
+		switch block {
+		case 0x21: // extension
+			label, err := r.ReadByte()
+			if err != nil {
+				return 0, errBad
+			}
+			if label == 0xF9 { // graphic control: the next frame's delay
+				var gce [5]byte // size, flags, delay, transparent index
+				if _, err := io.ReadFull(r, gce[:]); err != nil || gce[0] != 4 {
+					return 0, errBad
+				}
+				delay = int(binary.LittleEndian.Uint16(gce[2:4]))
+			}
+			if err := skipSubBlocks(r); err != nil {
+				return 0, errBad
+			}
+		case 0x2C: // image descriptor
+			var d [9]byte
+			if _, err := io.ReadFull(r, d[:]); err != nil {
+				return 0, errBad
+			}
+			left, top := int(binary.LittleEndian.Uint16(d[0:2])), int(binary.LittleEndian.Uint16(d[2:4]))
+			w, h := int(binary.LittleEndian.Uint16(d[4:6])), int(binary.LittleEndian.Uint16(d[6:8]))
+			if left+w > width || top+h > height {
+				return 0, errBad
+			}
+			frames++
+			pixels += w * h
+			if frames > maxGIFFrames || pixels > maxGIFPixels {
+				return 0, errors.New("gif has too many frames")
+			}
+			if err := skipColorTable(r, d[8]); err != nil {
+				return 0, errBad
+			}
+			if _, err := r.ReadByte(); err != nil { // LZW minimum code size
+				return 0, errBad
+			}
+			if err := skipSubBlocks(r); err != nil {
+				return 0, errBad
+			}
+			if delay <= 0 {
+				secs += gifZeroDelaySecs
+			} else {
+				secs += float64(delay) / 100
+			}
+			delay = 0
+		case 0x3B: // trailer
+			if frames == 0 {
+				return 0, errors.New("empty gif")
+			}
+			return secs, nil
+		default:
+			return 0, errBad
+		}
+	}
+}
+
+// skipColorTable skips the color table a GIF descriptor's flags announce.
+func skipColorTable(r *bufio.Reader, flags byte) error {
+	if flags&0x80 == 0 {
+		return nil
+	}
+	_, err := r.Discard(3 << (flags&7 + 1))
+	return err
+}
+
+// skipSubBlocks skips GIF data sub-blocks up to their zero-length terminator.
+func skipSubBlocks(r *bufio.Reader) error {
+	for {
+		n, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(n)); err != nil {
+			return err
+		}
+	}
+}
+
+// clipDuration checks a play time in seconds read from a file: zero,
+// negative and NaN mean the file doesn't say, and huge values (which would
+// overflow a Duration) are too long.
+func clipDuration(secs float64) (time.Duration, error) {
+	if !(secs > 0) {
+		return 0, errUnknownDuration
+	}
+	if secs > maxClipDuration.Seconds() {
+		return 0, errClipTooLong
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// mp4Duration finds moov/mvhd in an ISO-BMFF (MP4) file and returns the
+// movie duration. moov may sit before or after mdat, so boxes are skipped by size.
+// Fragmented files leave mvhd's duration at 0 and may give it in moov/mvex/mehd
+// instead; without either it can't be checked and the file is rejected.
+func mp4Duration(r io.ReadSeeker) (time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	moov, moovEnd, err := findBox(r, 0, end, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhd, _, err := findBox(r, moov, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(mvhd, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var hdr [32]byte
+	if _, err := io.ReadFull(r, hdr[:4]); err != nil {
+		return 0, errUnknownDuration
+	}
+	var scale, units uint64
+	if hdr[0] == 1 { // version 1: 64-bit times
+		if _, err := io.ReadFull(r, hdr[:28]); err != nil {
+			return 0, errUnknownDuration
+		}
+		scale = uint64(binary.BigEndian.Uint32(hdr[16:20]))
+		units = binary.BigEndian.Uint64(hdr[20:28])
+	} else {
+		if _, err := io.ReadFull(r, hdr[:16]); err != nil {
+			return 0, errUnknownDuration
+		}
+		scale = uint64(binary.BigEndian.Uint32(hdr[8:12]))
+		units = uint64(binary.BigEndian.Uint32(hdr[12:16]))
+	}
+	if scale == 0 {
+		return 0, errUnknownDuration
+	}
+	if units == 0 {
+		if units, err = mehdDuration(r, moov, moovEnd); err != nil {
+			return 0, err
+		}
+	}
+	return clipDuration(float64(units) / float64(scale))
+}
+
+// mehdDuration reads the fragment duration in moov/mvex/mehd, in the
+// movie's time scale.
+func mehdDuration(r io.ReadSeeker, moov, moovEnd int64) (uint64, error) {
+	mvex, mvexEnd, err := findBox(r, moov, moovEnd, "mvex")
+	if err != nil {
+		return 0, err
+	}
+	mehd, _, err := findBox(r, mvex, mvexEnd, "mehd")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(mehd, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var b [12]byte
+	if _, err := io.ReadFull(r, b[:4]); err != nil {
+		return 0, errUnknownDuration
+	}
+	if b[0] == 1 { // version 1: 64-bit
+		if _, err := io.ReadFull(r, b[4:12]); err != nil {
+			return 0, errUnknownDuration
+		}
+		return binary.BigEndian.Uint64(b[4:12]), nil
+	}
+	if _, err := io.ReadFull(r, b[4:8]); err != nil {
+		return 0, errUnknownDuration
+	}
+	return uint64(binary.BigEndian.Uint32(b[4:8])), nil
+}
+
+// findBox scans sibling boxes in [start, end) and returns the payload range of
+// the first box of the given type.
+func findBox(r io.ReadSeeker, start, end int64, typ string) (int64, int64, error) {
+	pos := start
+	var hdr [16]byte
+	for pos+8 <= end {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(r, hdr[:8]); err != nil {
+			return 0, 0, errUnknownDuration
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		head := int64(8)
+		switch size {
+		case 0: // box runs to the end of its parent
+			size = end - pos
+		case 1: // 64-bit size follows the type
+			if _, err := io.ReadFull(r, hdr[8:16]); err != nil {
+				return 0, 0, errUnknownDuration
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			head = 16
+		}
+		if size < head || pos+size > end {
+			return 0, 0, errUnknownDuration
+		}
+		if string(hdr[4:8]) == typ {
+			return pos + head, pos + size, nil
+		}
+		pos += size
+	}
+	return 0, 0, errUnknownDuration
+}
+
+// WebM/Matroska element IDs we need.
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlUnknownSize   = -1
+)
+
+// webmDuration reads Segment/Info/Duration (scaled by TimecodeScale).
+// Files written without a Duration (e.g. live MediaRecorder output) are
+// rejected, since their length cannot be checked without decoding them.
+func webmDuration(r io.ReadSeeker) (time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	// skip the EBML header element
+	if _, size, err := readElement(r); err != nil || size < 0 {
+		return 0, errUnknownDuration
+	} else if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+		return 0, err
+	}
+
+	id, size, err := readElement(r)
+	if err != nil || id != ebmlSegment {
+		return 0, errUnknownDuration
+	}
+	segStart, _ := r.Seek(0, io.SeekCurrent)
+	segEnd := end
+	if size != ebmlUnknownSize && segStart+size < end {
+		segEnd = segStart + size
+	}
+
+	for pos := segStart; pos < segEnd; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		id, size, err := readElement(r)
+		if err != nil || size == ebmlUnknownSize {
+			return 0, errUnknownDuration
+		}
+		body, _ := r.Seek(0, io.SeekCurrent)
+		if id == ebmlInfo {
+			return webmInfoDuration(r, body, body+size)
+		}
+		pos = body + size
+	}
+	return 0, errUnknownDuration
+}
+
+func webmInfoDuration(r io.ReadSeeker, start, end int64) (time.Duration, error) {
+	scale := uint64(1000000) // default TimecodeScale: 1ms
+	dur := -1.0
+	for pos := start; pos < end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		id, size, err := readElement(r)
+		if err != nil || size < 0 {
+			return 0, errUnknownDuration
+		}
+		body, _ := r.Seek(0, io.SeekCurrent)
+		if (id == ebmlTimecodeScale || id == ebmlDuration) && size <= 8 {
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return 0, errUnknownDuration
+			}
+			if id == ebmlTimecodeScale {
+				var v uint64
+				for _, b := range buf {
+					v = v<<8 | uint64(b)
+				}
+				scale = v
+			} else if size == 4 {
+				dur = float64(math.Float32frombits(binary.BigEndian.Uint32(buf)))
+			} else if size == 8 {
+				dur = math.Float64frombits(binary.BigEndian.Uint64(buf))
+			}
+		}
+		pos = body + size
+	}
+	// a missing Duration stays -1; clipDuration also turns away 0, NaN and ±Inf
+	return clipDuration(dur * float64(scale) / float64(time.Second))
+}
+
+// readElement reads an EBML element ID and data size. Size is
+// ebmlUnknownSize when all data bits are set.
+func readElement(r io.Reader) (uint64, int64, error) {
+	id, _, err := readVint(r, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, allOnes, err := readVint(r, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	if allOnes {
+		return id, ebmlUnknownSize, nil
+	}
+	return id, int64(size), nil
+}
+
+// readVint decodes an EBML variable-length integer. IDs keep their length
+// marker bit; sizes drop it.
+func readVint(r io.Reader, keepMarker bool) (uint64, bool, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return 0, false, err
+	}
+	n := 1
+	for mask := byte(0x80); n <= 8 && b[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > 8 {
+		return 0, false, errUnknownDuration
+	}
+	if _, err := io.ReadFull(r, b[1:n]); err != nil {
+		return 0, false, err
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= uint64(0xFF >> n)
+	}
+	allOnes := v == uint64(0xFF>>n)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+		if b[i] != 0xFF {
+			allOnes = false
+		}
+	}
+	return v, allOnes && !keepMarker, nil
+}
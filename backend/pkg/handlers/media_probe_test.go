@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestProbeGIF(t *testing.T) {
+	pal := color.Palette{color.Black, color.White}
+	g := &gif.GIF{Config: image.Config{ColorModel: pal, Width: 20, Height: 10}}
+	for _, delay := range []int{10, 0, 50} {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 20, 10), pal))
+		g.Delay = append(g.Delay, delay)
+	}
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		t.Fatal(err)
+	}
+	dur, poster, err := probeGIF(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dur != 700*time.Millisecond {
+		t.Errorf("duration %v, want 700ms (a 0 delay plays as 100ms)", dur)
+	}
+	if img, err := png.Decode(bytes.NewReader(poster)); err != nil || img.Bounds().Dx() != 20 || img.Bounds().Dy() != 10 {
+		t.Errorf("poster: %v %v", img.Bounds(), err)
+	}
+}
+
+// rawGIF builds a GIF of frames w×h images on a size×size canvas, with just
+// an end-of-data code for each frame's pixels: tiny, however large it claims
+// to be.
+func rawGIF(size, frames, w, h int) []byte {
+	var b bytes.Buffer
+	le := func(v int) { _ = binary.Write(&b, binary.LittleEndian, uint16(v)) }
+	b.WriteString("GIF89a")
+	le(size)
+	le(size)
+	b.Write([]byte{0x80, 0, 0}) // 2-color global table
+	b.Write([]byte{0, 0, 0, 255, 255, 255})
+	for i := 0; i < frames; i++ {
+		b.Write([]byte{0x21, 0xF9, 4, 0, 5, 0, 0, 0}) // 50ms
+		b.WriteByte(0x2C)
+		le(0)
+		le(0)
+		le(w)
+		le(h)
+		b.Write([]byte{0, 2, 1, 0x2C, 0}) // flags, LZW code size, clear + end
+	}
+	b.WriteByte(0x3B)
+	return b.Bytes()
+}
+
+func TestProbeGIFLimits(t *testing.T) {
+	if secs, err := gifDuration(bufio.NewReader(bytes.NewReader(rawGIF(10, 3, 10, 10)))); err != nil || math.Abs(secs-0.15) > 1e-9 {
+		t.Errorf("gifDuration = %v, %v; want 0.15s", secs, err)
+	}
+	for name, data := range map[string][]byte{
+		"too many frames":        rawGIF(10, maxGIFFrames+1, 1, 1),
+		"too many pixels":        rawGIF(maxGIFDimension, maxGIFPixels/(maxGIFDimension*maxGIFDimension)+1, maxGIFDimension, maxGIFDimension),
+		"frame outside canvas":   rawGIF(10, 1, 11, 10),
+		"no frames":              rawGIF(10, 0, 0, 0),
+		"truncated":              rawGIF(10, 2, 10, 10)[:40],
+		"canvas over the limits": rawGIF(maxGIFDimension+1, 1, 1, 1),
+	} {
+		if _, _, err := probeGIF(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+// webm builds the smallest WebM webmDuration reads: an EBML header and a
+// Segment of unknown size holding an Info with an 8-byte Duration.
+func webm(duration float64) []byte {
+	b := []byte{0x1A, 0x45, 0xDF, 0xA3, 0x80}
+	b = append(b, 0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	b = append(b, 0x15, 0x49, 0xA9, 0x66, 0x8B, 0x44, 0x89, 0x88)
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(duration))
+}
+
+func TestWebMDuration(t *testing.T) {
+	if d, err := webmDuration(bytes.NewReader(webm(5000))); err != nil || d != 5*time.Second {
+		t.Errorf("5000ms: %v, %v", d, err)
+	}
+	for _, ms := range []float64{math.NaN(), 0, -1, math.Inf(1), math.Inf(-1), 1e300} {
+		if d, err := webmDuration(bytes.NewReader(webm(ms))); err == nil {
+			t.Errorf("duration %v accepted as %v", ms, d)
+		} else if ms > 0 && !errors.Is(err, errClipTooLong) {
+			t.Errorf("duration %v: %v, want too long", ms, err)
+		}
+	}
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(b, typ...), body...)
+}
+
+func TestMP4Duration(t *testing.T) {
+	// version 0 mvhd: flags, creation and modification time, time scale, duration
+	mvhd := func(scale, units uint32) []byte {
+		b := make([]byte, 20)
+		binary.BigEndian.PutUint32(b[12:], scale)
+		binary.BigEndian.PutUint32(b[16:], units)
+		return box("mvhd", b)
+	}
+	mehd := box("mvex", box("mehd", []byte{0, 0, 0, 0, 0, 0, 0x0B, 0xB8})) // 3000
+
+	for name, c := range map[string]struct {
+		file []byte
+		want time.Duration
+	}{
+		"plain":                   {box("moov", mvhd(1000, 2500)), 2500 * time.Millisecond},
+		"moov after mdat":         {append(box("mdat", make([]byte, 100)), box("moov", mvhd(600, 1200))...), 2 * time.Second},
+		"fragmented, with mehd":   {box("moov", mvhd(1000, 0), mehd), 3 * time.Second},
+		"fragmented, no duration": {box("moov", mvhd(1000, 0)), 0},
+		"no time scale":           {box("moov", mvhd(0, 100)), 0},
+		"too long":                {box("moov", mvhd(1, math.MaxUint32)), 0},
+	} {
+		d, err := mp4Duration(bytes.NewReader(c.file))
+		if c.want == 0 {
+			if err == nil {
+				t.Errorf("%s: accepted as %v", name, d)
+			}
+		} else if err != nil || d != c.want {
+			t.Errorf("%s: %v, %v; want %v", name, d, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	_ "time/tzdata" // quiet hours use IANA zones; don't depend on the host having them
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/ws"
+)
+
+// Delivery says on which channels a notification goes out.
+type Delivery struct {
+	InApp   bool `json:"inApp"`   // stored and listed in GET /api/notifications
+	Push    bool `json:"push"`    // pushed live over the WebSocket
+	WebPush bool `json:"webPush"` // sent to their browsers and phones while offline
+	Email   bool `json:"email"`   // mailed, in a digest or right away (see mailedNow)
+
+	quiet bool // within the recipient's quiet hours
+}
+
+func (d Delivery) any() bool { return d.InApp || d.Push || d.WebPush || d.Email }
+
+// QuietHours holds back pushes between Start and End ("HH:MM", in Timezone).
+// Start after End wraps past midnight, e.g. 22:00–07:00.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// maxHours caps durations given in hours (mutes, bans, invite links): ten
+// years, well short of overflowing a time.Duration.
+const maxHours = 10 * 365 * 24
+
+// Mute silences everything about a post, a group or a DM conversation.
+type Mute struct {
+	TargetType string  `json:"targetType"` // post | group | conversation
+	TargetID   string  `json:"targetId"`   // for a conversation: the other user
+	Until      *string `json:"until,omitempty"`
+	CreatedAt  string  `json:"createdAt"`
+}
+
+// notificationTypes are the types a preference can be set for.
+func notificationTypes() []string {
+	types := make([]string, 0, len(notificationTexts))
+	for t := range notificationTexts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// contains reports whether t falls inside the quiet hours.
+func (q QuietHours) contains(t time.Time) bool {
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start, err1 := time.Parse("15:04", q.Start)
+	end, err2 := time.Parse("15:04", q.End)
+	if err1 != nil || err2 != nil || q.Start == q.End {
+		return false
+	}
+	t = t.In(loc)
+	now := t.Hour()*60 + t.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from < to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+func (q QuietHours) valid() bool {
+	_, err1 := time.Parse("15:04", q.Start)
+	_, err2 := time.Parse("15:04", q.End)
+	_, err3 := time.LoadLocation(q.Timezone)
+	return err1 == nil && err2 == nil && err3 == nil && q.Start != q.End
+}
+
+// quietHours returns the user's quiet hours, or nil when they have none.
+func quietHours(db *sql.DB, userID string) *QuietHours {
+	var q QuietHours
+	var start, end sql.NullString
+	if err := db.QueryRow(`SELECT quiet_start, quiet_end, quiet_tz FROM notification_settings WHERE user_id=?`, userID).
+		Scan(&start, &end, &q.Timezone); err != nil || !start.Valid || !end.Valid {
+		return nil
+	}
+	q.Start, q.End = start.String, end.String
+	return &q
+}
+
+// delivery decides how note reaches its recipient: not at all when something
+// it is about is muted, else per their preference for its type, with pushes
+// held back during quiet hours (immediate mail waits for SendHeldMail then).
+func (n *Notifier) delivery(note Note, conversation string) Delivery {
+	targets := map[string]string{}
+	if note.PostID != 0 {
+		targets["post"] = strconv.FormatInt(note.PostID, 10)
+	}
+	if note.GroupID != 0 {
+		targets["group"] = strconv.FormatInt(note.GroupID, 10)
+	}
+	if conversation != "" {
+		targets["conversation"] = conversation
+	}
+	for typ, id := range targets {
+		var muted int
+		_ = n.DB.QueryRow(`
+SELECT COUNT(*) FROM notification_mutes
+WHERE user_id=? AND target_type=? AND target_id=? AND (until IS NULL OR until > datetime('now'))`,
+			note.UserID, typ, id).Scan(&muted)
+		if muted > 0 {
+			return Delivery{}
+		}
+	}
+
+	d := Delivery{InApp: true, Push: true, WebPush: true, Email: true}
+	err := n.DB.QueryRow(`SELECT in_app, push, web_push, email FROM notification_preferences WHERE user_id=? AND type=?`,
+		note.UserID, note.Type).Scan(&d.InApp, &d.Push, &d.WebPush, &d.Email)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("notify prefs:", err)
+	}
+	if d.Push || d.WebPush || d.Email {
+		if q := quietHours(n.DB, note.UserID); q != nil && q.contains(time.Now()) {
+			d.Push, d.WebPush, d.quiet = false, false, true
+		}
+	}
+	return d
+}
+
+// NotifyDM nudges to that from sent them a direct message. DMs aren't stored
+// as notifications; the nudge only respects mutes, preferences and quiet hours.
+func (n *Notifier) NotifyDM(to, from string) {
+	if n == nil || to == from {
+		return
+	}
+	d := n.delivery(Note{Type: "dm", UserID: to, ActorID: from}, from)
+	if d.Push && n.Hub != nil {
+		n.Hub.Broadcast("user:"+to, ws.Message{
+			Type:    "notification",
+			Payload: map[string]any{"type": "dm", "from": from},
+		})
+	}
+
+	if !d.WebPush {
+		return
+	}
+	var name string
+	_ = n.DB.QueryRow(`SELECT `+displayNameSQL+` FROM users u WHERE u.id=?`, from).Scan(&name)
+	go n.pushOffline(to, map[string]any{
+		"type":  "dm",
+		"title": "Social Network",
+		"body":  notificationText("dm", name, 1),
+		"url":   n.AppURL + "/chat",
+		"tag":   "dm:" + from,
+		"from":  from,
+	})
+}
+
+// GET /api/notifications/preferences
+// {"types": {"like": {"inApp","push","webPush","email"}, ...}, "quietHours": {...}|null,
+// "digest": "off|daily|weekly", "mutes": [...]}
+//
+// PUT /api/notifications/preferences {"types": {"like": {"push": false}}, "quietHours": {...}|null, "digest": "weekly"}
+// Only the types and channels given change; "quietHours": null clears them.
+func (h *NotificationsHandler) Preferences(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			Types map[string]struct {
+				InApp   *bool `json:"inApp"`
+				Push    *bool `json:"push"`
+				WebPush *bool `json:"webPush"`
+				Email   *bool `json:"email"`
+			} `json:"types"`
+			QuietHours json.RawMessage `json:"quietHours"`
+			Digest     string          `json:"digest"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			Err(w, 400, "bad json")
+			return
+		}
+		if body.Digest != "" && !digestFrequency(body.Digest) {
+			Err(w, 400, "digest must be off, daily or weekly")
+			return
+		}
+		for typ := range body.Types {
+			if _, ok := notificationTexts[typ]; !ok {
+				Err(w, 400, "unknown type "+typ)
+				return
+			}
+		}
+		var quiet *QuietHours
+		if len(body.QuietHours) > 0 && string(body.QuietHours) != "null" {
+			if err := json.Unmarshal(body.QuietHours, &quiet); err != nil {
+				Err(w, 400, "bad quietHours")
+				return
+			}
+			if quiet.Timezone == "" {
+				quiet.Timezone = "UTC"
+			}
+			if !quiet.valid() {
+				Err(w, 400, "quietHours needs start and end as HH:MM and a valid timezone")
+				return
+			}
+		}
+
+		tx, err := h.DB.Begin()
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		defer tx.Rollback()
+		for typ, ch := range body.Types {
+			if _, err := tx.Exec(`
+INSERT INTO notification_preferences (user_id, type) VALUES (?, ?)
+ON CONFLICT (user_id, type) DO NOTHING`, u.ID, typ); err != nil {
+				Err(w, 500, "db")
+				return
+			}
+			if _, err := tx.Exec(`
+UPDATE notification_preferences
+SET in_app=COALESCE(?, in_app), push=COALESCE(?, push), web_push=COALESCE(?, web_push), email=COALESCE(?, email)
+WHERE user_id=? AND type=?`, ch.InApp, ch.Push, ch.WebPush, ch.Email, u.ID, typ); err != nil {
+				Err(w, 500, "db")
+				return
+			}
+		}
+		if len(body.QuietHours) > 0 {
+			var start, end any
+			tz := "UTC"
+			if quiet != nil {
+				start, end, tz = quiet.Start, quiet.End, quiet.Timezone
+			}
+			if _, err := tx.Exec(`
+INSERT INTO notification_settings (user_id, quiet_start, quiet_end, quiet_tz) VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE SET quiet_start=excluded.quiet_start, quiet_end=excluded.quiet_end, quiet_tz=excluded.quiet_tz`,
+				u.ID, start, end, tz); err != nil {
+				Err(w, 500, "db")
+				return
+			}
+		}
+		if body.Digest != "" {
+			if _, err := tx.Exec(`
+INSERT INTO notification_settings (user_id, digest) VALUES (?, ?)
+ON CONFLICT (user_id) DO UPDATE SET digest=excluded.digest`, u.ID, body.Digest); err != nil {
+				Err(w, 500, "db")
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+	default:
+		Err(w, 405, "method")
+		return
+	}
+
+	types := map[string]Delivery{}
+	for _, t := range notificationTypes() {
+		types[t] = Delivery{InApp: true, Push: true, WebPush: true, Email: true}
+	}
+	rows, err := h.DB.Query(`SELECT type, in_app, push, web_push, email FROM notification_preferences WHERE user_id=?`, u.ID)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var typ string
+		var d Delivery
+		if err := rows.Scan(&typ, &d.InApp, &d.Push, &d.WebPush, &d.Email); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		types[typ] = d
+	}
+
+	mutes, err := h.mutes(u.ID)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	digest := "off"
+	_ = h.DB.QueryRow(`SELECT digest FROM notification_settings WHERE user_id=?`, u.ID).Scan(&digest)
+	JSON(w, 200, map[string]any{"types": types, "quietHours": quietHours(h.DB, u.ID), "mutes": mutes, "digest": digest})
+}
+
+func (h *NotificationsHandler) mutes(userID string) ([]Mute, error) {
+	rows, err := h.DB.Query(`
+SELECT target_type, target_id, until, created_at FROM notification_mutes
+WHERE user_id=? AND (until IS NULL OR until > datetime('now'))
+ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Mute{}
+	for rows.Next() {
+		var m Mute
+		if err := rows.Scan(&m.TargetType, &m.TargetID, &m.Until, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// POST /api/notifications/mute {targetType: post|group|conversation, targetId, hours?}
+// Without hours the mute lasts until it is lifted with /unmute.
+func (h *NotificationsHandler) Mute(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var body struct {
+		TargetType string `json:"targetType"`
+		TargetID   string `json:"targetId"`
+		Hours      int    `json:"hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TargetID == "" || body.Hours < 0 {
+		Err(w, 400, "bad json")
+		return
+	}
+	if body.Hours > maxHours {
+		Err(w, 400, "hours too large")
+		return
+	}
+
+	var exists int
+	switch body.TargetType {
+	case "post":
+		ok, err := canViewPost(h.DB, body.TargetID, u.ID)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		if ok {
+			exists = 1
+		}
+	case "group":
+		// secret groups stay hidden from those not in them
+		_ = h.DB.QueryRow(`SELECT COUNT(*) FROM groups g WHERE g.id=? AND `+visibleGroupSQL, body.TargetID, u.ID).Scan(&exists)
+	case "conversation":
+		_ = h.DB.QueryRow(`SELECT COUNT(*) FROM users WHERE id=?`, body.TargetID).Scan(&exists)
+	default:
+		Err(w, 400, "targetType must be post, group or conversation")
+		return
+	}
+	if exists == 0 {
+		Err(w, 404, "not found")
+		return
+	}
+
+	var until any
+	if body.Hours > 0 {
+		until = time.Now().UTC().Add(time.Duration(body.Hours) * time.Hour).Format("2006-01-02 15:04:05")
+	}
+	if _, err := h.DB.Exec(`
+INSERT INTO notification_mutes (user_id, target_type, target_id, until) VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id, target_type, target_id) DO UPDATE SET until=excluded.until, created_at=datetime('now')`,
+		u.ID, body.TargetType, body.TargetID, until); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, map[string]any{"ok": true, "until": until})
+}
+
+// POST /api/notifications/unmute {targetType, targetId}
+func (h *NotificationsHandler) Unmute(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var body struct {
+		TargetType string `json:"targetType"`
+		TargetID   string `json:"targetId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TargetType == "" || body.TargetID == "" {
+		Err(w, 400, "bad json")
+		return
+	}
+	if _, err := h.DB.Exec(`DELETE FROM notification_mutes WHERE user_id=? AND target_type=? AND target_id=?`,
+		u.ID, body.TargetType, body.TargetID); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, map[string]any{"ok": true})
+}
@@ -1,27 +1,55 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/ws"
 )
 
-type NotificationsHandler struct{ DB *sql.DB }
+type NotificationsHandler struct {
+	DB       *sql.DB
+	Notifier *Notifier // sends notification_count after changes
+}
 
 type Notification struct {
-	ID        int64   `json:"id"`
-	Type      string  `json:"type"`
-	ActorID   *string `json:"actorId,omitempty"`
-	PostID    *int64  `json:"postId,omitempty"`
-	CommentID *int64  `json:"commentId,omitempty"`
-	CreatedAt string  `json:"createdAt"`
-	ReadAt    *string `json:"readAt,omitempty"`
+	ID         int64               `json:"id"`
+	Type       string              `json:"type"`
+	ActorID    *string             `json:"actorId,omitempty"`
+	PostID     *int64              `json:"postId,omitempty"`
+	CommentID  *int64              `json:"commentId,omitempty"`
+	Target     *NotificationTarget `json:"target,omitempty"`
+	Metadata   json.RawMessage     `json:"metadata,omitempty"` // ids and titles, e.g. {"groupId":3,"groupTitle":"Hikers"}
+	Actor      *NotificationActor  `json:"actor,omitempty"`    // latest actor
+	Actors     []NotificationActor `json:"actors,omitempty"`   // a few most recent, when aggregated
+	ActorCount int                 `json:"actorCount"`         // > 1 when several people did the same thing
+	Text       string              `json:"text"`               // e.g. "Ali and 3 others liked your post"
+	CreatedAt  string              `json:"createdAt"`
+	ReadAt     *string             `json:"readAt,omitempty"`
+}
+
+// NotificationTarget is what the notification links to.
+type NotificationTarget struct {
+	Type string `json:"type"` // post | comment | user | group | event
+	ID   string `json:"id"`
 }
 
+type NotificationActor struct {
+	ID          string  `json:"id"`
+	DisplayName string  `json:"displayName"`
+	AvatarURL   *string `json:"avatarUrl,omitempty"`
+}
+
+// maxListedActors caps Notification.Actors.
+const maxListedActors = 3
+
 // GET /api/notifications?unread=1&limit=50
 func (h *NotificationsHandler) List(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
@@ -38,28 +66,88 @@ func (h *NotificationsHandler) List(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	q := `SELECT id, type, actor_id, post_id, comment_id, created_at, read_at
-	      FROM notifications WHERE user_id=? `
+	where := `n.user_id=? AND n.in_app=1 `
 	if onlyUnread {
-		q += `AND read_at IS NULL `
+		where += `AND n.read_at IS NULL `
 	}
-	q += `ORDER BY created_at DESC LIMIT ?`
-
-	rows, err := h.DB.Query(q, u.ID, limit)
+	out, err := loadNotifications(h.DB, where+`ORDER BY n.created_at DESC, n.id DESC LIMIT ?`, u.ID, limit)
 	if err != nil {
 		Err(w, 500, "db")
 		return
 	}
+	JSON(w, 200, out)
+}
+
+// loadNotifications returns notifications n matching where (which may carry
+// ORDER BY / LIMIT), with actors resolved to names and avatars.
+func loadNotifications(db *sql.DB, where string, args ...any) ([]Notification, error) {
+	rows, err := db.Query(`
+SELECT n.id, n.type, n.actor_id, n.post_id, n.comment_id, n.target_type, n.target_id, n.metadata,
+       n.actor_count, `+displayNameSQL+`, u.avatar_url, n.created_at, n.read_at
+FROM notifications n LEFT JOIN users u ON u.id = n.actor_id
+WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var out []Notification
+	out := []Notification{}
+	var aggregatedIDs []any
 	for rows.Next() {
 		var n Notification
-		if err := rows.Scan(&n.ID, &n.Type, &n.ActorID, &n.PostID, &n.CommentID, &n.CreatedAt, &n.ReadAt); err == nil {
-			out = append(out, n)
+		var targetType, targetID, metadata, actorName sql.NullString
+		var avatar *string
+		if err := rows.Scan(&n.ID, &n.Type, &n.ActorID, &n.PostID, &n.CommentID, &targetType, &targetID, &metadata,
+			&n.ActorCount, &actorName, &avatar, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		if targetType.Valid {
+			n.Target = &NotificationTarget{Type: targetType.String, ID: targetID.String}
 		}
+		if metadata.Valid && json.Valid([]byte(metadata.String)) {
+			n.Metadata = json.RawMessage(metadata.String)
+		}
+		if n.ActorID != nil && actorName.Valid {
+			n.Actor = &NotificationActor{ID: *n.ActorID, DisplayName: actorName.String, AvatarURL: avatar}
+		}
+		n.Text = notificationText(n.Type, actorName.String, n.ActorCount)
+		if n.ActorCount > 1 {
+			aggregatedIDs = append(aggregatedIDs, n.ID)
+		}
+		out = append(out, n)
 	}
-	JSON(w, 200, out)
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(aggregatedIDs) == 0 {
+		return out, nil
+	}
+
+	// the few most recent actors of aggregated notifications
+	actors := map[int64][]NotificationActor{}
+	rows, err = db.Query(`
+SELECT na.notification_id, u.id, `+displayNameSQL+`, u.avatar_url
+FROM notification_actors na JOIN users u ON u.id = na.actor_id
+WHERE na.notification_id IN (?`+strings.Repeat(",?", len(aggregatedIDs)-1)+`)
+ORDER BY na.created_at DESC, na.rowid DESC`, aggregatedIDs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var nid int64
+		var a NotificationActor
+		if err := rows.Scan(&nid, &a.ID, &a.DisplayName, &a.AvatarURL); err != nil {
+			return nil, err
+		}
+		if len(actors[nid]) < maxListedActors {
+			actors[nid] = append(actors[nid], a)
+		}
+	}
+	for i := range out {
+		out[i].Actors = actors[out[i].ID]
+	}
+	return out, rows.Err()
 }
 
 // POST /api/notifications/mark_read { "ids": [1,2,3] }
@@ -92,4 +180,147 @@ func (h *NotificationsHandler) MarkRead(w http.ResponseWriter, r *http.Request)
 	_ = tx.Commit()
 
 	JSON(w, 200, map[string]any{"ok": true})
+	h.Notifier.SendCount(u.ID)
+}
+
+// POST /api/notifications/mark_all_read {"before": <id>}
+// before is optional: the newest id the client has seen, so notifications
+// that arrive meanwhile stay unread.
+func (h *NotificationsHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var body struct {
+		Before int64 `json:"before"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			Err(w, 400, "bad json")
+			return
+		}
+	}
+	// email-only notifications were never shown, so they stay for the digest
+	q := `UPDATE notifications SET read_at=datetime('now') WHERE user_id=? AND read_at IS NULL AND in_app=1`
+	args := []any{u.ID}
+	if body.Before > 0 {
+		q += ` AND id <= ?`
+		args = append(args, body.Before)
+	}
+	res, err := h.DB.Exec(q, args...)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	n, _ := res.RowsAffected()
+
+	JSON(w, 200, map[string]any{"ok": true, "updated": n})
+	h.Notifier.SendCount(u.ID)
+}
+
+// POST /api/notifications/delete {"ids": [1,2,3]} or {"allRead": true}
+// Dismisses notifications for good; allRead clears every read one.
+func (h *NotificationsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		Err(w, 405, "method")
+		return
+	}
+
+	var body struct {
+		IDs     []int64 `json:"ids"`
+		AllRead bool    `json:"allRead"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (len(body.IDs) == 0 && !body.AllRead) {
+		Err(w, 400, "bad json")
+		return
+	}
+
+	var deleted int64
+	if body.AllRead {
+		res, err := h.DB.Exec(`DELETE FROM notifications WHERE user_id=? AND read_at IS NOT NULL`, u.ID)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		deleted, _ = res.RowsAffected()
+	}
+	if len(body.IDs) > 0 {
+		args := []any{u.ID}
+		for _, id := range body.IDs {
+			args = append(args, id)
+		}
+		res, err := h.DB.Exec(`DELETE FROM notifications WHERE user_id=? AND id IN (?`+strings.Repeat(",?", len(body.IDs)-1)+`)`, args...)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		n, _ := res.RowsAffected()
+		deleted += n
+	}
+
+	JSON(w, 200, map[string]any{"ok": true, "deleted": deleted})
+	h.Notifier.SendCount(u.ID)
+}
+
+// GET /api/notifications/unread_count -> {"count": 3}
+func (h *NotificationsHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	count, err := unreadCount(h.DB, u.ID)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, map[string]int{"count": count})
+}
+
+func unreadCount(db *sql.DB, userID string) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id=? AND in_app=1 AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// SendCount pushes {"count": n} as a "notification_count" event to the
+// user's sockets, so every open tab keeps its badge in sync.
+func (n *Notifier) SendCount(userID string) {
+	if n == nil || n.Hub == nil {
+		return
+	}
+	count, err := unreadCount(n.DB, userID)
+	if err != nil {
+		return
+	}
+	n.Hub.Broadcast("user:"+userID, ws.Message{Type: "notification_count", Payload: map[string]int{"count": count}})
+}
+
+// PruneNotifications deletes read notifications older than retention, and
+// email-only ones (not in_app) once mailed or as old. Unread ones stay.
+// It is run periodically by the job scheduler.
+func (n *Notifier) PruneNotifications(ctx context.Context, retention time.Duration) error {
+	cutoff := time.Now().UTC().Add(-retention).Format("2006-01-02 15:04:05")
+	res, err := n.DB.ExecContext(ctx, `
+DELETE FROM notifications
+WHERE (read_at IS NOT NULL AND read_at < ?)
+   OR (in_app = 0 AND (emailed_at IS NOT NULL OR created_at < ?))`, cutoff, cutoff)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := res.RowsAffected(); deleted > 0 {
+		log.Printf("notifications: pruned %d", deleted)
+	}
+	return nil
 }
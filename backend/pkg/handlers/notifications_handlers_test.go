@@ -0,0 +1,37 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMarkAllReadKeepsEmailOnly checks that marking everything read leaves
+// notifications that were never listed in the app for the next digest.
+func TestMarkAllReadKeepsEmailOnly(t *testing.T) {
+	db := testDB(t)
+	annID, _ := testUser(t, db, "ann")
+	bobID, bobCookie := testUser(t, db, "bob")
+	if _, err := db.Exec(`INSERT INTO notification_preferences (user_id, type, in_app) VALUES (?, 'like', 0)`, bobID); err != nil {
+		t.Fatal(err)
+	}
+	n := NewNotifier(db, nil)
+	n.Notify(Note{Type: "like", UserID: bobID, ActorID: annID, PostID: 1})
+	n.Notify(Note{Type: "new_follower", UserID: bobID, ActorID: annID})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/notifications/mark_all_read", nil)
+	req.AddCookie(bobCookie)
+	rec := httptest.NewRecorder()
+	(&NotificationsHandler{DB: db, Notifier: n}).MarkAllRead(rec, req)
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `"updated":1`) {
+		t.Fatalf("mark_all_read: %d %s", rec.Code, rec.Body)
+	}
+	var unread string
+	_ = db.QueryRow(`SELECT group_concat(type) FROM notifications WHERE user_id=? AND read_at IS NULL`, bobID).Scan(&unread)
+	if unread != "like" {
+		t.Errorf("unread %q, want the email-only like", unread)
+	}
+}
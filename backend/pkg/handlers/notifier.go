@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"social-network/backend/pkg/mail"
+	"social-network/backend/pkg/webpush"
+	"social-network/backend/pkg/ws"
+)
+
+// Notifier is the one place notifications are created. It stores them and
+// pushes them to the recipient's "user:<id>" room, or through Web Push when
+// they have no open socket.
+//   - nobody is notified about their own action
+//   - likes, comments and replies on one post fold into a single unread
+//     notification with an actor count ("Ali and 3 others liked your post")
+//   - repeating an action (like/unlike/like, re-sending a follow request)
+//     doesn't notify twice while the first one is unread
+//   - the recipient's preferences, mutes and quiet hours decide which
+//     channels it goes out on (see delivery)
+//
+// A nil *Notifier drops everything, so handlers built without one still work.
+type Notifier struct {
+	DB     *sql.DB
+	Hub    *ws.Hub
+	Mailer mail.Mailer // nil = no email
+	AppURL string      // frontend base URL for links in emails and pushes
+
+	Push     *webpush.Sender // nil = no Web Push
+	Presence *Presence       // who is online; others get Web Push
+}
+
+func NewNotifier(db *sql.DB, hub *ws.Hub) *Notifier {
+	return &Notifier{DB: db, Hub: hub}
+}
+
+// Note is something that happened to UserID. Zero IDs mean "not involved".
+type Note struct {
+	Type      string
+	UserID    string // recipient
+	ActorID   string
+	PostID    int64
+	CommentID int64
+	GroupID   int64
+	EventID   int64
+	Extra     map[string]any // stored in the metadata, e.g. an event title
+	Dedup     string         // tells apart notes that are otherwise the same, e.g. which reminder
+}
+
+// aggregated types are folded per post rather than per actor.
+var aggregated = map[string]bool{"like": true, "comment": true, "reply": true}
+
+var notificationTexts = map[string]string{
+	"like":                "%s liked your post",
+	"comment":             "%s commented on your post",
+	"reply":               "%s also commented on a post you commented on",
+	"mention":             "%s mentioned you",
+	"follow_request":      "%s wants to follow you",
+	"follow_accepted":     "%s accepted your follow request",
+	"new_follower":        "%s started following you",
+	"group_invite":        "%s invited you to a group",
+	"group_join_request":  "%s asked to join your group",
+	"group_join_approved": "%s approved your request to join a group",
+	"kicked_from_group":   "%s removed you from a group",
+	"banned_from_group":   "%s banned you from a group",
+	"group_new_owner":     "%s made you the owner of a group",
+	"group_deleted":       "%s deleted a group you were in",
+	"event_created":       "%s created an event in your group",
+	"event_updated":       "%s changed an event you responded to",
+	"event_cancelled":     "%s cancelled an event you responded to",
+	"event_deleted":       "%s deleted an event in your group",
+	"event_reminder":      "Reminder: an event you're going to is coming up",
+	"event_promoted":      "A seat opened up at %s's event: you're going",
+	"dm":                  "%s sent you a message",
+}
+
+// notificationText renders e.g. "Ali and 3 others liked your post".
+func notificationText(typ, actorName string, actorCount int) string {
+	who := actorName
+	if who == "" {
+		who = "Someone"
+	}
+	switch {
+	case actorCount == 2:
+		who += " and 1 other"
+	case actorCount > 2:
+		who += fmt.Sprintf(" and %d others", actorCount-1)
+	}
+	tmpl, ok := notificationTexts[typ]
+	if !ok {
+		tmpl = "%s sent you a notification"
+	}
+	if !strings.Contains(tmpl, "%s") {
+		return tmpl
+	}
+	return fmt.Sprintf(tmpl, who)
+}
+
+// key identifies notifications that are "the same thing" for dedup.
+func (n Note) key() string {
+	if aggregated[n.Type] {
+		return fmt.Sprintf("%s:post:%d", n.Type, n.PostID)
+	}
+	key := fmt.Sprintf("%s:%s:p%d:c%d:g%d:e%d", n.Type, n.ActorID, n.PostID, n.CommentID, n.GroupID, n.EventID)
+	if n.Dedup != "" {
+		key += ":" + n.Dedup
+	}
+	return key
+}
+
+// target is what the notification links to. Aggregated notifications point
+// at the post they are folded on.
+func (n Note) target() (string, string) {
+	switch {
+	case n.EventID != 0:
+		return "event", strconv.FormatInt(n.EventID, 10)
+	case n.GroupID != 0:
+		return "group", strconv.FormatInt(n.GroupID, 10)
+	case n.CommentID != 0 && !aggregated[n.Type]:
+		return "comment", strconv.FormatInt(n.CommentID, 10)
+	case n.PostID != 0:
+		return "post", strconv.FormatInt(n.PostID, 10)
+	case n.ActorID != "":
+		return "user", n.ActorID
+	}
+	return "", ""
+}
+
+// metadata collects the ids and titles a client needs to render note.
+func (n *Notifier) metadata(note Note) string {
+	m := map[string]any{}
+	for k, v := range map[string]int64{"postId": note.PostID, "commentId": note.CommentID, "groupId": note.GroupID, "eventId": note.EventID} {
+		if v != 0 {
+			m[k] = v
+		}
+	}
+	if note.GroupID != 0 {
+		var title string
+		if n.DB.QueryRow(`SELECT title FROM groups WHERE id=?`, note.GroupID).Scan(&title) == nil {
+			m["groupTitle"] = title
+		}
+	}
+	if note.EventID != 0 {
+		var title string
+		if n.DB.QueryRow(`SELECT title FROM events WHERE id=?`, note.EventID).Scan(&title) == nil {
+			m["title"] = title
+		}
+	}
+	if note.PostID != 0 {
+		var body string
+		if n.DB.QueryRow(`SELECT body FROM posts WHERE id=?`, note.PostID).Scan(&body) == nil {
+			m["postExcerpt"] = excerpt(body, 80)
+		}
+	}
+	for k, v := range note.Extra {
+		m[k] = v
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// excerpt shortens s to at most max runes, on a word boundary if it can.
+func excerpt(s string, max int) string {
+	r := []rune(strings.Join(strings.Fields(s), " "))
+	if len(r) <= max {
+		return string(r)
+	}
+	cut := string(r[:max])
+	if i := strings.LastIndexByte(cut, ' '); i > max/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// Notify records note and pushes it live, unless it is a duplicate. The live
+// payload has the same shape as an item of GET /api/notifications.
+func (n *Notifier) Notify(note Note) {
+	if n == nil || note.UserID == "" || note.UserID == note.ActorID {
+		return
+	}
+	d := n.delivery(note, "")
+	if !d.any() {
+		return
+	}
+	id, fresh, err := n.store(note, d.InApp)
+	if err != nil {
+		log.Println("notify:", err)
+		return
+	}
+	if !fresh {
+		return
+	}
+	if d.InApp {
+		n.SendCount(note.UserID)
+	}
+	if mailedNow[note.Type] && d.Email && !d.quiet && n.Mailer != nil {
+		go n.mailNow(context.Background(), id)
+	}
+	if !d.Push && !d.WebPush {
+		return
+	}
+	list, err := loadNotifications(n.DB, `n.id=?`, id)
+	if err != nil || len(list) == 0 {
+		return
+	}
+	if d.Push && n.Hub != nil {
+		n.Hub.Broadcast("user:"+note.UserID, ws.Message{Type: "notification", Payload: list[0]})
+	}
+	if d.WebPush {
+		go n.pushOffline(note.UserID, n.pushPayload(list[0]))
+	}
+}
+
+// NotifyAll sends the same note to each user (the actor is skipped).
+func (n *Notifier) NotifyAll(userIDs []string, note Note) {
+	for _, uid := range userIDs {
+		note.UserID = uid
+		n.Notify(note)
+	}
+}
+
+// Retract takes the actor back out of an unread notification, e.g. after an
+// unlike. The notification goes away once nobody is left in it.
+func (n *Notifier) Retract(note Note) {
+	if n == nil || note.UserID == "" || note.UserID == note.ActorID {
+		return
+	}
+	tx, err := n.DB.Begin()
+	if err != nil {
+		log.Println("notify retract:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(`SELECT id FROM notifications WHERE user_id=? AND agg_key=? AND read_at IS NULL ORDER BY id DESC LIMIT 1`,
+		note.UserID, note.key()).Scan(&id); err != nil {
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM notification_actors WHERE notification_id=? AND actor_id=?`, id, note.ActorID); err != nil {
+		log.Println("notify retract:", err)
+		return
+	}
+	var left int
+	_ = tx.QueryRow(`SELECT COUNT(*) FROM notification_actors WHERE notification_id=?`, id).Scan(&left)
+	if left == 0 {
+		_, err = tx.Exec(`DELETE FROM notifications WHERE id=?`, id)
+	} else {
+		_, err = tx.Exec(`
+UPDATE notifications SET actor_count=?,
+       actor_id=(SELECT actor_id FROM notification_actors WHERE notification_id=? ORDER BY created_at DESC, rowid DESC LIMIT 1)
+WHERE id=?`, left, id, id)
+	}
+	if err != nil {
+		log.Println("notify retract:", err)
+		return
+	}
+	if tx.Commit() == nil && left == 0 {
+		n.SendCount(note.UserID)
+	}
+}
+
+// store inserts note or folds it into the matching unread notification.
+// fresh is false when nothing changed (the same actor did the same thing).
+// A notification that isn't inApp is kept for the other channels only.
+func (n *Notifier) store(note Note, inApp bool) (id int64, fresh bool, err error) {
+	key := note.key()
+	targetType, targetID := note.target()
+	metadata := n.metadata(note)
+
+	tx, err := n.DB.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT id FROM notifications WHERE user_id=? AND agg_key=? AND read_at IS NULL ORDER BY id DESC LIMIT 1`,
+		note.UserID, key).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		res, err := tx.Exec(`
+INSERT INTO notifications (user_id, type, actor_id, post_id, comment_id, agg_key, target_type, target_id, metadata, in_app, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))`,
+			note.UserID, note.Type, nullIfEmpty(note.ActorID), nullIfZero(note.PostID), nullIfZero(note.CommentID), key,
+			nullIfEmpty(targetType), nullIfEmpty(targetID), metadata, inApp)
+		if err != nil {
+			return 0, false, err
+		}
+		id, _ = res.LastInsertId()
+		if note.ActorID != "" {
+			if _, err := tx.Exec(`INSERT INTO notification_actors (notification_id, actor_id) VALUES (?, ?)`, id, note.ActorID); err != nil {
+				return 0, false, err
+			}
+		}
+
+	case err != nil:
+		return 0, false, err
+
+	default:
+		if note.ActorID == "" {
+			return id, false, nil
+		}
+		res, err := tx.Exec(`INSERT OR IGNORE INTO notification_actors (notification_id, actor_id) VALUES (?, ?)`, id, note.ActorID)
+		if err != nil {
+			return 0, false, err
+		}
+		if added, _ := res.RowsAffected(); added == 0 {
+			return id, false, nil
+		}
+		// the latest actor and comment lead; it moves back to the top of the list
+		if _, err := tx.Exec(`
+UPDATE notifications SET actor_id=?, comment_id=COALESCE(?, comment_id), metadata=?, created_at=datetime('now'),
+       in_app=MAX(in_app, ?), actor_count=(SELECT COUNT(*) FROM notification_actors WHERE notification_id=?)
+WHERE id=?`, note.ActorID, nullIfZero(note.CommentID), metadata, inApp, id, id); err != nil {
+			return 0, false, err
+		}
+	}
+	return id, true, tx.Commit()
+}
+
+func nullIfZero(v int64) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
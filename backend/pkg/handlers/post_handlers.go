@@ -11,24 +11,29 @@ import (
 	"time"
 
 	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/storage"
 	"social-network/backend/pkg/ws"
 )
 
 type PostHandler struct {
-	DB  *sql.DB
-	Hub *ws.Hub // can be nil if you don't want realtime
+	DB    *sql.DB
+	Hub   *ws.Hub            // can be nil if you don't want realtime
+	Store    storage.MediaStore // used to clean up media of deleted posts
+	Notifier *Notifier
 }
 
 type Post struct {
-	ID           int64   `json:"id"`
-	UserID       string  `json:"userId"`
-	Body         string  `json:"body"`
-	ImageURL     *string `json:"imageUrl,omitempty"`
-	Visibility   string  `json:"visibility"` // NEW
-	CreatedAt    string  `json:"createdAt"`
-	LikeCount    int     `json:"likeCount"`
-	CommentCount int     `json:"commentCount"`
-	Liked        bool    `json:"liked,omitempty"`
+	ID           int64       `json:"id"`
+	UserID       string      `json:"userId"`
+	Body         string      `json:"body"`
+	ImageURL     *string     `json:"imageUrl,omitempty"`
+	Visibility   string      `json:"visibility"` // NEW
+	CreatedAt    string      `json:"createdAt"`
+	LikeCount    int         `json:"likeCount"`
+	CommentCount int         `json:"commentCount"`
+	Liked        bool        `json:"liked,omitempty"`
+	Media        []PostMedia `json:"media"`
+	Mentions     []Mention   `json:"mentions"`
 }
 
 // canViewPost checks if viewer can see post according to visibility rules.
@@ -75,16 +80,32 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var p struct {
-		Body       string   `json:"body"`
-		ImageURL   *string  `json:"imageUrl"`
-		Visibility string   `json:"visibility"`           // "public" | "followers" | "private"
-		AllowedIDs []string `json:"allowedIds,omitempty"` // only for "private"
+		Body       string      `json:"body"`
+		ImageURL   *string     `json:"imageUrl"`             // single image (older clients)
+		Media      []PostMedia `json:"media,omitempty"`      // ordered gallery, up to maxPostMedia
+		Visibility string      `json:"visibility"`           // "public" | "followers" | "private"
+		AllowedIDs []string    `json:"allowedIds,omitempty"` // only for "private"
 	}
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.Body == "" {
 		Err(w, 400, "bad json")
 		return
 	}
 
+	if len(p.Media) == 0 && p.ImageURL != nil && *p.ImageURL != "" {
+		p.Media = []PostMedia{{URL: *p.ImageURL}}
+	}
+	if err := checkPostMedia(h.DB, u.ID, p.Media); err != nil {
+		if errors.Is(err, errPostMedia) {
+			Err(w, 400, "bad media")
+		} else {
+			Err(w, 500, "db")
+		}
+		return
+	}
+	if len(p.Media) > 0 {
+		p.ImageURL = &p.Media[0].URL
+	}
+
 	vis := p.Visibility
 	if vis == "" {
 		vis = "public"
@@ -94,16 +115,37 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := h.DB.Exec(
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	res, err := tx.Exec(
 		`INSERT INTO posts (user_id, body, image_url, visibility, created_at)
 		 VALUES (?,?,?,?,datetime('now'))`,
 		u.ID, p.Body, p.ImageURL, vis,
 	)
 	if err != nil {
+		_ = tx.Rollback()
 		Err(w, 500, "db")
 		return
 	}
 	id, _ := res.LastInsertId()
+	if err := insertPostMedia(tx, id, p.Media); err != nil {
+		_ = tx.Rollback()
+		Err(w, 500, "db")
+		return
+	}
+	mentioned, err := indexText(tx, id, nil, u.ID, p.Body)
+	if err != nil {
+		_ = tx.Rollback()
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
 
 	// If private, add allow-list entries
 	if vis == "private" && len(p.AllowedIDs) > 0 {
@@ -127,7 +169,13 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 		ImageURL:   p.ImageURL,
 		Visibility: vis,
 		CreatedAt:  time.Now().UTC().Format("2006-01-02 15:04:05"),
+		Media:      p.Media,
 	}
+	if out.Media == nil {
+		out.Media = []PostMedia{}
+	}
+	mentions, _ := loadMentions(h.DB, []int64{id}, false)
+	out.Mentions = nonNilMentions(mentions[id])
 	JSON(w, 200, out)
 
 	if h.Hub != nil {
@@ -136,6 +184,7 @@ func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 			Payload: out,
 		})
 	}
+	notifyMentions(h.Notifier, u.ID, id, nil, mentioned)
 }
 func (h *PostHandler) ListAll(w http.ResponseWriter, r *http.Request) {
 	limit := 20
@@ -156,22 +205,22 @@ func (h *PostHandler) ListAll(w http.ResponseWriter, r *http.Request) {
 		viewerID = u.ID
 	}
 
-	// Base: newest first
-	// Visibility rule:
-	// - public
-	// - OR author == viewer
-	// - OR followers & viewer follows author (accepted)
-	// - OR private & viewer in post_allowed
-	rows, err := h.DB.Query(`
-SELECT p.id, p.user_id, p.body, p.image_url, p.visibility, p.created_at,
-  IFNULL(l.cnt,0) as like_count,
-  IFNULL(c.cnt,0) as comment_count,
-  CASE WHEN ul.post_id IS NULL THEN 0 ELSE 1 END as liked
-FROM posts p
-LEFT JOIN (SELECT post_id, COUNT(*) cnt FROM post_likes GROUP BY post_id) l ON l.post_id = p.id
-LEFT JOIN (SELECT post_id, COUNT(*) cnt FROM comments GROUP BY post_id) c ON c.post_id = p.id
-LEFT JOIN (SELECT post_id FROM post_likes WHERE user_id=? ) ul ON ul.post_id = p.id
-WHERE
+	out, err := h.listPosts(viewerID, "", nil, limit, offset)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, out)
+}
+
+// visiblePostSQL is the WHERE condition for posts p the viewer may see.
+// Visibility rule:
+// - public
+// - OR author == viewer
+// - OR followers & viewer follows author (accepted)
+// - OR private & viewer in post_allowed
+// Bind it with visiblePostArgs(viewerID).
+const visiblePostSQL = `(
   p.visibility = 'public'
   OR (? <> '' AND p.user_id = ?)
   OR (? <> '' AND p.visibility = 'followers' AND EXISTS (
@@ -180,17 +229,38 @@ WHERE
   OR (? <> '' AND p.visibility = 'private' AND EXISTS (
       SELECT 1 FROM post_allowed pa WHERE pa.post_id=p.id AND pa.user_id=?
   ))
-ORDER BY p.created_at DESC
-LIMIT ? OFFSET ?`,
-		viewerID,           // ul subquery
+)`
+
+func visiblePostArgs(viewerID string) []any {
+	return []any{
 		viewerID, viewerID, // author == viewer
 		viewerID, viewerID, // followers branch
 		viewerID, viewerID, // private branch
-		limit, offset,
-	)
+	}
+}
+
+// listPosts returns the feed-shaped posts visible to viewerID, newest first.
+// filter is an extra "AND ..." condition on p, bound with filterArgs.
+func (h *PostHandler) listPosts(viewerID, filter string, filterArgs []any, limit, offset int) ([]map[string]any, error) {
+	args := []any{viewerID} // ul subquery
+	args = append(args, visiblePostArgs(viewerID)...)
+	args = append(args, filterArgs...)
+	args = append(args, limit, offset)
+
+	rows, err := h.DB.Query(`
+SELECT p.id, p.user_id, p.body, p.image_url, p.visibility, p.created_at,
+  IFNULL(l.cnt,0) as like_count,
+  IFNULL(c.cnt,0) as comment_count,
+  CASE WHEN ul.post_id IS NULL THEN 0 ELSE 1 END as liked
+FROM posts p
+LEFT JOIN (SELECT post_id, COUNT(*) cnt FROM post_likes GROUP BY post_id) l ON l.post_id = p.id
+LEFT JOIN (SELECT post_id, COUNT(*) cnt FROM comments GROUP BY post_id) c ON c.post_id = p.id
+LEFT JOIN (SELECT post_id FROM post_likes WHERE user_id=? ) ul ON ul.post_id = p.id
+WHERE `+visiblePostSQL+` `+filter+`
+ORDER BY p.created_at DESC
+LIMIT ? OFFSET ?`, args...)
 	if err != nil {
-		Err(w, 500, "db")
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -204,6 +274,7 @@ LIMIT ? OFFSET ?`,
 		Liked            int
 	}
 	out := []map[string]any{}
+	ids := []int64{}
 	for rows.Next() {
 		var r postRow
 		if err := rows.Scan(&r.ID, &r.UserID, &r.Body, &r.ImageURL, &r.Visibility, &r.CreatedAt, &r.LikeCount, &r.CommentCount, &r.Liked); err != nil {
@@ -215,9 +286,24 @@ LIMIT ? OFFSET ?`,
 			"likeCount": r.LikeCount, "commentCount": r.CommentCount,
 			"liked": r.Liked == 1,
 		})
+		id, _ := strconv.ParseInt(r.ID, 10, 64)
+		ids = append(ids, id)
 	}
-	JSON(w, 200, out)
+	media, err := loadPostMedia(h.DB, ids)
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := loadMentions(h.DB, ids, false)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range out {
+		p["media"] = nonNilMedia(media[ids[i]])
+		p["mentions"] = nonNilMentions(mentions[ids[i]])
+	}
+	return out, nil
 }
+
 func (h *PostHandler) ListMine(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
 	if err != nil {
@@ -238,6 +324,7 @@ func (h *PostHandler) ListMine(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	var list []Post
+	var ids []int64
 	for rows.Next() {
 		var x Post
 		if err := rows.Scan(
@@ -245,8 +332,23 @@ func (h *PostHandler) ListMine(w http.ResponseWriter, r *http.Request) {
 			&x.CreatedAt, &x.LikeCount, &x.CommentCount,
 		); err == nil {
 			list = append(list, x)
+			ids = append(ids, x.ID)
 		}
 	}
+	media, err := loadPostMedia(h.DB, ids)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	mentions, err := loadMentions(h.DB, ids, false)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	for i := range list {
+		list[i].Media = nonNilMedia(media[list[i].ID])
+		list[i].Mentions = nonNilMentions(mentions[list[i].ID])
+	}
 	JSON(w, 200, list)
 }
 
@@ -268,6 +370,22 @@ func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		Err(w, 400, "bad json")
 		return
 	}
+	var urls []string
+	if rows, err := h.DB.Query(`SELECT url, poster_url FROM post_media WHERE post_id=?`, payload.ID); err == nil {
+		for rows.Next() {
+			var url string
+			var poster *string
+			if rows.Scan(&url, &poster) == nil {
+				urls = append(urls, url)
+				if poster != nil {
+					urls = append(urls, *poster)
+				}
+			}
+		}
+		rows.Close()
+	}
+
+	// post_media rows go with the post (ON DELETE CASCADE)
 	res, err := h.DB.Exec(`DELETE FROM posts WHERE id = ? AND user_id = ?`, payload.ID, u.ID)
 	if err != nil {
 		Err(w, 500, "db")
@@ -280,6 +398,8 @@ func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 	JSON(w, 200, map[string]any{"ok": true, "id": payload.ID})
 
+	deleteUnusedMedia(h.DB, h.Store, urls)
+
 	if h.Hub != nil {
 		h.Hub.Broadcast("feed", ws.Message{
 			Type: "post_deleted", Room: "feed", From: u.ID, At: time.Now().Unix(),
@@ -343,6 +463,16 @@ func (h *PostHandler) ToggleLike(w http.ResponseWriter, r *http.Request) {
 		"likes": total,
 	})
 
+	var authorID string
+	if h.DB.QueryRow(`SELECT user_id FROM posts WHERE id=?`, payload.PostID).Scan(&authorID) == nil {
+		note := Note{Type: "like", UserID: authorID, ActorID: u.ID, PostID: payload.PostID}
+		if liked == 1 {
+			h.Notifier.Notify(note)
+		} else {
+			h.Notifier.Retract(note)
+		}
+	}
+
 	// Broadcast via WebSocket (in goroutine to avoid blocking HTTP response)
 	go func() {
 		defer func() {
@@ -364,6 +494,86 @@ func (h *PostHandler) ToggleLike(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
+// PUT /api/posts/{id} {body} - Edit the text of your own post
+func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPut {
+		Err(w, 405, "method")
+		return
+	}
+
+	postID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/posts/"), 10, 64)
+	if err != nil {
+		Err(w, 400, "invalid post ID")
+		return
+	}
+
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Body == "" {
+		Err(w, 400, "bad json")
+		return
+	}
+
+	var authorID, visibility string
+	if err := h.DB.QueryRow(`SELECT user_id, visibility FROM posts WHERE id=?`, postID).Scan(&authorID, &visibility); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			Err(w, 404, "post not found")
+			return
+		}
+		Err(w, 500, "db")
+		return
+	}
+	if authorID != u.ID {
+		Err(w, 403, "not your post")
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	if _, err := tx.Exec(`UPDATE posts SET body=? WHERE id=?`, req.Body, postID); err != nil {
+		_ = tx.Rollback()
+		Err(w, 500, "db")
+		return
+	}
+	mentioned, err := indexText(tx, postID, nil, u.ID, req.Body)
+	if err != nil {
+		_ = tx.Rollback()
+		Err(w, 500, "db")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+
+	mentions, _ := loadMentions(h.DB, []int64{postID}, false)
+	out := map[string]any{"ok": true, "id": postID, "body": req.Body, "mentions": nonNilMentions(mentions[postID])}
+	JSON(w, 200, out)
+
+	if h.Hub != nil {
+		// everyone is in "feed": others only hear which post changed, and
+		// refetch it if they may see it
+		payload := any(map[string]any{"id": postID})
+		if visibility == "public" {
+			payload = out
+		}
+		h.Hub.Broadcast("feed", ws.Message{
+			Type: "post_updated", Room: "feed", From: u.ID, At: time.Now().Unix(),
+			Payload: payload,
+		})
+	}
+	notifyMentions(h.Notifier, u.ID, postID, nil, mentioned)
+}
+
 // PUT /api/posts/{id}/privacy - Update privacy of a specific post
 func (h *PostHandler) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.FromRequest(h.DB, r)
@@ -470,4 +680,5 @@ func (h *PostHandler) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	JSON(w, 200, map[string]any{"ok": true, "visibility": req.Visibility})
+	recheckRoom(h.DB, h.Hub, "post:"+strconv.FormatInt(postID, 10))
 }
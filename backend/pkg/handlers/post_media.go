@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"social-network/backend/pkg/storage"
+)
+
+// maxPostMedia caps how many items one post can carry.
+const maxPostMedia = 10
+
+// PostMedia is one gallery item. MediaType, PosterURL and DurationMs come
+// from the upload record, never from the client.
+type PostMedia struct {
+	URL        string  `json:"url"`
+	MediaType  string  `json:"mediaType"` // "image" | "gif" | "video"
+	PosterURL  *string `json:"posterUrl,omitempty"`
+	DurationMs *int64  `json:"durationMs,omitempty"`
+	Caption    *string `json:"caption,omitempty"`
+	AltText    *string `json:"altText,omitempty"`
+}
+
+var errPostMedia = errors.New("bad media")
+
+// checkPostMedia validates a gallery before it is attached to a post by userID
+// and fills in each item's type, poster and duration from its upload record.
+// Every item must be a file that user uploaded: otherwise anyone could attach
+// someone else's private upload to a public post and expose it.
+func checkPostMedia(db *sql.DB, userID string, items []PostMedia) error {
+	if len(items) > maxPostMedia {
+		return errPostMedia
+	}
+	for i := range items {
+		m := &items[i]
+		name := strings.TrimPrefix(m.URL, "/uploads/")
+		if name == m.URL || !storage.ValidName(name) {
+			return errPostMedia
+		}
+		err := db.QueryRow(`SELECT media_type, poster_url, duration_ms FROM media WHERE name=? AND owner_id=?`, name, userID).
+			Scan(&m.MediaType, &m.PosterURL, &m.DurationMs)
+		if err == sql.ErrNoRows {
+			return errPostMedia
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertPostMedia(tx *sql.Tx, postID int64, items []PostMedia) error {
+	for i, m := range items {
+		if _, err := tx.Exec(`INSERT INTO post_media (post_id, position, url, media_type, poster_url, duration_ms, caption, alt_text)
+			VALUES (?,?,?,?,?,?,?,?)`,
+			postID, i, m.URL, m.MediaType, m.PosterURL, m.DurationMs, m.Caption, m.AltText); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPostMedia returns the galleries for the given posts, keyed by post id.
+// Posts without media are missing from the map.
+func loadPostMedia(db *sql.DB, postIDs []int64) (map[int64][]PostMedia, error) {
+	out := map[int64][]PostMedia{}
+	if len(postIDs) == 0 {
+		return out, nil
+	}
+	ph := make([]string, len(postIDs))
+	args := make([]any, len(postIDs))
+	for i, id := range postIDs {
+		ph[i] = "?"
+		args[i] = id
+	}
+	rows, err := db.Query(`
+SELECT post_id, url, media_type, poster_url, duration_ms, caption, alt_text FROM post_media
+WHERE post_id IN (`+strings.Join(ph, ",")+`)
+ORDER BY post_id, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pid int64
+		var m PostMedia
+		if err := rows.Scan(&pid, &m.URL, &m.MediaType, &m.PosterURL, &m.DurationMs, &m.Caption, &m.AltText); err == nil {
+			out[pid] = append(out[pid], m)
+		}
+	}
+	return out, rows.Err()
+}
+
+// deleteUnusedMedia removes stored files (and their media rows) once nothing
+// references them anymore: no post, avatar, group cover or chat message
+// (media_attachments). Called after the owning post or group is gone.
+func deleteUnusedMedia(db *sql.DB, store storage.MediaStore, urls []string) {
+	if store == nil {
+		return
+	}
+	for _, url := range urls {
+		name := strings.TrimPrefix(url, "/uploads/")
+		var n int
+		if err := db.QueryRow(`
+SELECT (SELECT COUNT(*) FROM post_media WHERE url=? OR poster_url=?)
+     + (SELECT COUNT(*) FROM posts WHERE image_url=?)
+     + (SELECT COUNT(*) FROM users WHERE avatar_url=?)
+     + (SELECT COUNT(*) FROM groups WHERE cover_url=?)
+     + (SELECT COUNT(*) FROM media_attachments WHERE name=?)`, url, url, url, url, url, name).Scan(&n); err != nil || n > 0 {
+			continue
+		}
+		if err := store.Delete(context.Background(), name); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println("media delete:", err)
+			continue
+		}
+		_, _ = db.Exec(`DELETE FROM media WHERE name=?`, name)
+	}
+}
+
+// nonNilMedia makes posts without media serialize as "media": [].
+func nonNilMedia(m []PostMedia) []PostMedia {
+	if m == nil {
+		return []PostMedia{}
+	}
+	return m
+}
@@ -85,6 +85,13 @@ func (p *Presence) touch(userID string) {
 	p.mu.Unlock()
 }
 
+// IsOnline reports whether userID has an open socket with a fresh heartbeat.
+func (p *Presence) IsOnline(userID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counts[userID] > 0 && time.Now().Unix()-p.lastSeen[userID] <= int64(p.ttl.Seconds())
+}
+
 // GET /api/presence/online -> [{id, displayName, avatarUrl}]
 type presenceUser struct {
 	ID          string  `json:"id"`
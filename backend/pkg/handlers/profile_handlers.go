@@ -6,16 +6,15 @@ import (
 	"errors"
 	"net/http"
 	"strings"
-	"time"
 
 	"social-network/backend/pkg/auth"
 	"social-network/backend/pkg/ws"
 )
 
 type ProfileHandler struct {
-	DB  *sql.DB
-	Hub *ws.Hub // <-- add this so we can push WS notifications
-
+	DB       *sql.DB
+	Hub      *ws.Hub // <-- add this so we can push WS notifications
+	Notifier *Notifier
 }
 
 type profileUser struct {
@@ -223,42 +222,10 @@ func (h *ProfileHandler) FollowRequest(w http.ResponseWriter, r *http.Request) {
 	// after the INSERT/UPSERT that sets `status`
 	if status == "pending" {
 		// notify target user (they received a follow request)
-		res, _ := h.DB.Exec(
-			`INSERT INTO notifications (user_id, type, actor_id, created_at)
-		 VALUES (?, 'follow_request', ?, datetime('now'))`,
-			body.UserID, u.ID,
-		)
-		if h.Hub != nil && res != nil {
-			id, _ := res.LastInsertId()
-			h.Hub.Broadcast("user:"+body.UserID, ws.Message{
-				Type: "notification",
-				Payload: map[string]any{
-					"id":       id,
-					"type":     "follow_request",
-					"actorId":  u.ID,
-					"createdAt": time.Now().UTC().Format("2006-01-02 15:04:05"),
-				},
-			})
-		}
+		h.Notifier.Notify(Note{Type: "follow_request", UserID: body.UserID, ActorID: u.ID})
 	} else if status == "accepted" {
 		// public target auto-accepts → optionally notify them someone followed
-		res, _ := h.DB.Exec(
-			`INSERT INTO notifications (user_id, type, actor_id, created_at)
-		 VALUES (?, 'new_follower', ?, datetime('now'))`,
-			body.UserID, u.ID,
-		)
-		if h.Hub != nil && res != nil {
-			id, _ := res.LastInsertId()
-			h.Hub.Broadcast("user:"+body.UserID, ws.Message{
-				Type: "notification",
-				Payload: map[string]any{
-					"id":       id,
-					"type":     "new_follower",
-					"actorId":  u.ID,
-					"createdAt": time.Now().UTC().Format("2006-01-02 15:04:05"),
-				},
-			})
-		}
+		h.Notifier.Notify(Note{Type: "new_follower", UserID: body.UserID, ActorID: u.ID})
 	}
 	JSON(w, 200, map[string]any{"ok": true, "status": status})
 }
@@ -319,24 +286,8 @@ func (h *ProfileHandler) Accept(w http.ResponseWriter, r *http.Request) {
 		JSON(w, 200, map[string]any{"ok": true, "status": "noop"})
 		return
 	}
-	// notify follower that they were accepted
-	res2, _ := h.DB.Exec(
-		`INSERT INTO notifications (user_id, type, actor_id, created_at)
-	 VALUES (?, 'follow_accepted', ?, datetime('now'))`,
-		body.UserID, u.ID, // recipient = follower, actor = me (the followee)
-	)
-	if h.Hub != nil && res2 != nil {
-		id, _ := res2.LastInsertId()
-		h.Hub.Broadcast("user:"+body.UserID, ws.Message{
-			Type: "notification",
-			Payload: map[string]any{
-				"id":       id,
-				"type":     "follow_accepted",
-				"actorId":  u.ID,
-				"createdAt": time.Now().UTC().Format("2006-01-02 15:04:05"),
-			},
-		})
-	}
+	// notify follower that they were accepted (recipient = follower, actor = me)
+	h.Notifier.Notify(Note{Type: "follow_accepted", UserID: body.UserID, ActorID: u.ID})
 	JSON(w, 200, map[string]any{"ok": true, "status": "accepted"})
 }
 
@@ -467,12 +418,13 @@ type EnhancedProfileUser struct {
 }
 
 type PostSummary struct {
-	ID        int64   `json:"id"`
-	Body      string  `json:"body"`
-	ImageURL  *string `json:"imageUrl,omitempty"`
-	CreatedAt string  `json:"createdAt"`
-	LikeCount int     `json:"likeCount"`
-	IsLiked   bool    `json:"isLiked"`
+	ID        int64       `json:"id"`
+	Body      string      `json:"body"`
+	ImageURL  *string     `json:"imageUrl,omitempty"`
+	CreatedAt string      `json:"createdAt"`
+	LikeCount int         `json:"likeCount"`
+	IsLiked   bool        `json:"isLiked"`
+	Media     []PostMedia `json:"media"`
 }
 
 type FollowUser struct {
@@ -581,10 +533,10 @@ func (h *ProfileHandler) GetEnhanced(w http.ResponseWriter, r *http.Request) {
 			FROM posts p
 			LEFT JOIN (
 				SELECT post_id, COUNT(*) as count 
-				FROM likes 
+				FROM post_likes 
 				GROUP BY post_id
 			) like_counts ON like_counts.post_id = p.id
-			LEFT JOIN likes user_likes ON user_likes.post_id = p.id AND user_likes.user_id = ?
+			LEFT JOIN post_likes user_likes ON user_likes.post_id = p.id AND user_likes.user_id = ?
 			WHERE p.user_id = ? ` + visibilityFilter + `
 			ORDER BY p.created_at DESC 
 			LIMIT 20`
@@ -600,13 +552,19 @@ func (h *ProfileHandler) GetEnhanced(w http.ResponseWriter, r *http.Request) {
 			posts = []PostSummary{}
 		} else {
 			defer rows.Close()
+			var ids []int64
 			for rows.Next() {
 				var post PostSummary
 				if err := rows.Scan(&post.ID, &post.Body, &post.ImageURL, &post.CreatedAt, 
 					&post.LikeCount, &post.IsLiked); err == nil {
 					posts = append(posts, post)
+					ids = append(ids, post.ID)
 				}
 			}
+			media, _ := loadPostMedia(h.DB, ids)
+			for i := range posts {
+				posts[i].Media = nonNilMedia(media[posts[i].ID])
+			}
 		}
 	}
 
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/webpush"
+)
+
+// PushHandler manages the Web Push subscriptions of the current user, one
+// per browser/device. The Notifier pushes through them while the user has
+// no open socket.
+type PushHandler struct {
+	DB    *sql.DB
+	VAPID *webpush.VAPID
+	// AllowLocal accepts http and local endpoints (WEBPUSH_ALLOW_LOCAL), for
+	// cmd/fakepush; the Sender must allow them too.
+	AllowLocal bool
+}
+
+type PushDevice struct {
+	ID         int64   `json:"id"`
+	UserAgent  *string `json:"userAgent,omitempty"`
+	CreatedAt  string  `json:"createdAt"`
+	LastUsedAt *string `json:"lastUsedAt,omitempty"`
+}
+
+// a subscription that failed this many times in a row is dropped
+const maxPushFailures = 5
+
+// pushTTL is how long a push service holds a message for an offline device.
+const pushTTL = 24 * time.Hour
+
+// LoadVAPID returns the VAPID key given as privateKey (VAPID_PRIVATE_KEY),
+// or else the one kept in app_keys, generated on first start. Browsers tie
+// subscriptions to this key, so it has to survive restarts.
+func LoadVAPID(db *sql.DB, privateKey, subject string) (*webpush.VAPID, error) {
+	if privateKey != "" {
+		return webpush.ParseVAPID(privateKey, subject)
+	}
+	err := db.QueryRow(`SELECT value FROM app_keys WHERE name='vapid_private_key'`).Scan(&privateKey)
+	if err == nil {
+		return webpush.ParseVAPID(privateKey, subject)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+	v, err := webpush.GenerateVAPID(subject)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`INSERT INTO app_keys (name, value) VALUES ('vapid_private_key', ?)`, v.PrivateKey()); err != nil {
+		return nil, err
+	}
+	log.Println("push: generated a VAPID key (set VAPID_PRIVATE_KEY to use your own)")
+	return v, nil
+}
+
+// GET /api/push/vapid-key -> {"publicKey"}: the applicationServerKey for
+// PushManager.subscribe().
+func (h *PushHandler) VAPIDKey(w http.ResponseWriter, r *http.Request) {
+	JSON(w, 200, map[string]string{"publicKey": h.VAPID.PublicKey()})
+}
+
+// POST /api/push/subscribe {endpoint, keys: {p256dh, auth}}, i.e. the JSON
+// of a browser PushSubscription. Subscribing the same endpoint again
+// updates it (and moves it to the current user).
+func (h *PushHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var sub webpush.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		Err(w, 400, "bad json")
+		return
+	}
+	if err := sub.Validate(r.Context(), h.AllowLocal); err != nil {
+		Err(w, 400, err.Error())
+		return
+	}
+
+	var id int64
+	err = h.DB.QueryRow(`
+INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (endpoint) DO UPDATE SET user_id=excluded.user_id, p256dh=excluded.p256dh, auth=excluded.auth,
+  user_agent=excluded.user_agent, failures=0
+RETURNING id`, u.ID, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth, nullIfEmpty(r.UserAgent())).Scan(&id)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, map[string]any{"ok": true, "id": id})
+}
+
+// POST /api/push/unsubscribe {endpoint} or {id}
+func (h *PushHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		Err(w, 405, "method")
+		return
+	}
+
+	var body struct {
+		Endpoint string `json:"endpoint"`
+		ID       int64  `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.Endpoint == "" && body.ID == 0) {
+		Err(w, 400, "bad json")
+		return
+	}
+	if _, err := h.DB.Exec(`DELETE FROM push_subscriptions WHERE user_id=? AND (endpoint=? OR id=?)`,
+		u.ID, body.Endpoint, body.ID); err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, map[string]any{"ok": true})
+}
+
+// GET /api/push/subscriptions -> the current user's devices
+func (h *PushHandler) List(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FromRequest(h.DB, r)
+	if err != nil {
+		Err(w, 401, "unauthenticated")
+		return
+	}
+	rows, err := h.DB.Query(`
+SELECT id, user_agent, created_at, last_used_at FROM push_subscriptions
+WHERE user_id=? ORDER BY created_at DESC`, u.ID)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	defer rows.Close()
+	out := []PushDevice{}
+	for rows.Next() {
+		var d PushDevice
+		if err := rows.Scan(&d.ID, &d.UserAgent, &d.CreatedAt, &d.LastUsedAt); err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		out = append(out, d)
+	}
+	JSON(w, 200, out)
+}
+
+// pushOffline sends payload through Web Push to every device of userID,
+// unless they are online: then their socket already got it. Callers check the
+// webPush preference first (Notifier.delivery).
+func (n *Notifier) pushOffline(userID string, payload any) {
+	if n.Push == nil || (n.Presence != nil && n.Presence.IsOnline(userID)) {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	rows, err := n.DB.Query(`SELECT id, endpoint, p256dh, auth FROM push_subscriptions WHERE user_id=?`, userID)
+	if err != nil {
+		log.Println("push:", err)
+		return
+	}
+	type device struct {
+		id  int64
+		sub webpush.Subscription
+	}
+	var devices []device
+	for rows.Next() {
+		var d device
+		if err := rows.Scan(&d.id, &d.sub.Endpoint, &d.sub.Keys.P256dh, &d.sub.Keys.Auth); err == nil {
+			devices = append(devices, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range devices {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		err := n.Push.Send(ctx, d.sub, body, pushTTL)
+		cancel()
+		switch {
+		case err == nil:
+			_, _ = n.DB.Exec(`UPDATE push_subscriptions SET failures=0, last_used_at=datetime('now') WHERE id=?`, d.id)
+		case errors.Is(err, webpush.ErrGone):
+			_, _ = n.DB.Exec(`DELETE FROM push_subscriptions WHERE id=?`, d.id)
+		default:
+			log.Printf("push to subscription %d: %v", d.id, err)
+			_, _ = n.DB.Exec(`UPDATE push_subscriptions SET failures=failures+1 WHERE id=?`, d.id)
+			_, _ = n.DB.Exec(`DELETE FROM push_subscriptions WHERE id=? AND failures>=?`, d.id, maxPushFailures)
+		}
+	}
+}
+
+// pushPayload is what the service worker receives for a notification.
+func (n *Notifier) pushPayload(note Notification) map[string]any {
+	return map[string]any{
+		"id":     note.ID,
+		"type":   note.Type,
+		"title":  "Social Network",
+		"body":   note.Text,
+		"url":    n.AppURL + notificationPath(note.Type, note.Target),
+		"tag":    note.Type + ":" + targetKey(note.Target),
+		"target": note.Target,
+	}
+}
+
+func targetKey(t *NotificationTarget) string {
+	if t == nil {
+		return ""
+	}
+	return t.Type + ":" + t.ID
+}
@@ -0,0 +1,175 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"social-network/backend/pkg/auth"
+	sqlite "social-network/backend/pkg/db"
+	"social-network/backend/pkg/webpush"
+	"social-network/backend/pkg/ws"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testUser adds a user and returns their id and a session cookie.
+func testUser(t *testing.T, db *sql.DB, name string) (string, *http.Cookie) {
+	t.Helper()
+	id := name + "-id"
+	if _, err := db.Exec(`INSERT INTO users (id, email, password_hash, first_name, last_name, dob, nickname)
+		VALUES (?, ?, 'x', ?, 'Test', '2000-01-01', ?)`, id, name+"@example.com", name, name); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	if err := auth.CreateSession(db, id, rec); err != nil {
+		t.Fatal(err)
+	}
+	return id, rec.Result().Cookies()[0]
+}
+
+// waitFor polls cond for up to two seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// TestPushEndToEnd subscribes a fake browser, then checks that notifications
+// reach it through the Notifier and Sender only while its user has no
+// presence socket, and that presence can't be claimed for someone else.
+func TestPushEndToEnd(t *testing.T) {
+	db := testDB(t)
+	annID, annCookie := testUser(t, db, "ann")
+	bobID, bobCookie := testUser(t, db, "bob")
+
+	pushSrv := httptest.NewServer(nil)
+	defer pushSrv.Close()
+	fake, err := webpush.NewFakeEndpoint(pushSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushSrv.Config.Handler = fake
+
+	vapid, err := webpush.GenerateVAPID("mailto:test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := ws.NewHub()
+	presence := NewPresence(db)
+	n := NewNotifier(db, hub)
+	n.Presence = presence
+	n.Push = webpush.NewSender(vapid)
+	n.Push.AllowLocal = true // the fake push service is on loopback
+
+	// bob's browser subscribes
+	sub, _ := json.Marshal(fake.Subscription())
+	req := httptest.NewRequest(http.MethodPost, "/api/push/subscribe", strings.NewReader(string(sub)))
+	req.AddCookie(bobCookie)
+	rec := httptest.NewRecorder()
+	(&PushHandler{DB: db, VAPID: vapid, AllowLocal: true}).Subscribe(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("subscribe: %d %s", rec.Code, rec.Body)
+	}
+
+	// offline: pushed
+	n.Notify(Note{Type: "new_follower", UserID: bobID, ActorID: annID})
+	waitFor(t, "the first push", func() bool { return len(fake.Received()) == 1 })
+	var payload map[string]any
+	if err := json.Unmarshal(fake.Received()[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["type"] != "new_follower" || !strings.Contains(payload["body"].(string), "ann") {
+		t.Errorf("payload %v", payload)
+	}
+
+	wsSrv := httptest.NewServer(&WSHandler{DB: db, Hub: hub, Presence: presence})
+	defer wsSrv.Close()
+	wsURL := "ws" + strings.TrimPrefix(wsSrv.URL, "http")
+
+	// presence needs a session, and only for its own user
+	for _, c := range []struct {
+		cookie *http.Cookie
+		status int
+	}{{nil, 401}, {annCookie, 403}} {
+		h := http.Header{}
+		if c.cookie != nil {
+			h.Set("Cookie", c.cookie.String())
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL+"?room=presence&user="+bobID, h)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("presence for bob with cookie %v accepted", c.cookie)
+		}
+		if resp == nil || resp.StatusCode != c.status {
+			t.Errorf("presence for bob with cookie %v: %v, want %d", c.cookie, resp, c.status)
+		}
+	}
+	if presence.IsOnline(bobID) {
+		t.Fatal("bob online without connecting")
+	}
+
+	// online: the socket gets it, no push
+	h := http.Header{}
+	h.Set("Cookie", bobCookie.String())
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?room=presence", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "bob to be online", func() bool { return presence.IsOnline(bobID) })
+	n.Notify(Note{Type: "follow_request", UserID: bobID, ActorID: annID})
+	time.Sleep(200 * time.Millisecond)
+	if got := len(fake.Received()); got != 1 {
+		t.Errorf("%d pushes while online, want none", got-1)
+	}
+
+	// offline again: pushed
+	conn.Close()
+	waitFor(t, "bob to be offline", func() bool { return !presence.IsOnline(bobID) })
+	n.Notify(Note{Type: "follow_accepted", UserID: bobID, ActorID: annID})
+	waitFor(t, "the second push", func() bool { return len(fake.Received()) == 2 })
+
+	// Web Push switched off for a type: stored, but not pushed
+	prefs := httptest.NewRequest(http.MethodPut, "/api/notifications/preferences", strings.NewReader(`{"types": {"new_follower": {"webPush": false}}}`))
+	prefs.AddCookie(bobCookie)
+	rec = httptest.NewRecorder()
+	(&NotificationsHandler{DB: db, Notifier: n}).Preferences(rec, prefs)
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `"new_follower":{"inApp":true,"push":true,"webPush":false`) {
+		t.Fatalf("preferences: %d %s", rec.Code, rec.Body)
+	}
+	catID, _ := testUser(t, db, "cat")
+	n.Notify(Note{Type: "new_follower", UserID: bobID, ActorID: catID})
+	n.Notify(Note{Type: "group_invite", UserID: bobID, ActorID: annID, GroupID: 1})
+	waitFor(t, "the third push", func() bool { return len(fake.Received()) == 3 })
+	time.Sleep(200 * time.Millisecond)
+	if got := fake.Received(); len(got) != 3 || !strings.Contains(string(got[2]), "group_invite") {
+		t.Errorf("pushes after turning off new_follower: %d, last %s", len(got), got[len(got)-1])
+	}
+
+	var used sql.NullString
+	_ = db.QueryRow(`SELECT last_used_at FROM push_subscriptions WHERE user_id=?`, bobID).Scan(&used)
+	if !used.Valid {
+		t.Error("subscription not marked as used")
+	}
+}
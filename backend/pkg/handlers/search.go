@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"database/sql"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"social-network/backend/pkg/auth"
+)
+
+type SearchHandler struct{ DB *sql.DB }
+
+// SearchHit is one typed search result. Snippet is HTML-escaped with the
+// matched terms wrapped in <mark>…</mark>, so it can be rendered as-is.
+type SearchHit struct {
+	Type      string  `json:"type"` // "user" | "post" | "comment" | "group"
+	ID        string  `json:"id"`
+	Title     string  `json:"title"` // user or author display name / group title
+	Snippet   string  `json:"snippet"`
+	UserID    string  `json:"userId,omitempty"` // author of a post/comment, owner of a group
+	PostID    int64   `json:"postId,omitempty"` // the post itself, or the post a comment is on
+	CreatedAt string  `json:"createdAt,omitempty"`
+	Rank      float64 `json:"rank"` // bm25; lower is better
+}
+
+// snippet()/highlight() wrap matches in these control characters; markSnippet
+// escapes the text and then turns them into <mark> tags.
+const (
+	snippetOpen  = "char(2)"
+	snippetClose = "char(3)"
+)
+
+// displayNameSQL is the name shown for users u: nickname, else full name.
+const displayNameSQL = `COALESCE(NULLIF(u.nickname, ''), u.first_name || ' ' || u.last_name)`
+
+func markSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "\x02", "<mark>")
+	return strings.ReplaceAll(s, "\x03", "</mark>")
+}
+
+// ftsQuery turns free text into an FTS5 MATCH expression: every word must
+// appear, and the last one may be a prefix (search-as-you-type). Words are
+// quoted, so FTS5 operators typed by the user are taken literally.
+// Returns "" when there is nothing to search for.
+func ftsQuery(q string) string {
+	var terms []string
+	for _, w := range strings.Fields(q) {
+		w = strings.ReplaceAll(w, `"`, "")
+		if strings.IndexFunc(w, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		terms = append(terms, `"`+w+`"`)
+		if len(terms) == 8 {
+			break
+		}
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
+
+// GET /api/search?q=<text>&type=all|users|posts|comments|groups&limit=10&offset=0
+// Returns {"users": [...], "posts": [...], "comments": [...], "groups": [...]}
+// (only the requested type when type is set), each list best match first.
+// Posts and comments are limited to posts the viewer may see.
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	viewerID := ""
+	if u, err := auth.FromRequest(h.DB, r); err == nil {
+		viewerID = u.ID
+	}
+
+	match := ftsQuery(r.URL.Query().Get("q"))
+	if match == "" {
+		Err(w, 400, "q required")
+		return
+	}
+
+	kind := r.URL.Query().Get("type")
+	if kind == "" {
+		kind = "all"
+	}
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, _ := strconv.Atoi(l); n > 0 && n <= 50 {
+			limit = n
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if n, _ := strconv.Atoi(o); n >= 0 {
+			offset = n
+		}
+	}
+
+	searches := map[string]func(string, string, int, int) ([]SearchHit, error){
+		"users":    h.searchUsers,
+		"posts":    h.searchPosts,
+		"comments": h.searchComments,
+		"groups":   h.searchGroups,
+	}
+	if _, ok := searches[kind]; !ok && kind != "all" {
+		Err(w, 400, "bad type")
+		return
+	}
+
+	out := map[string][]SearchHit{}
+	for name, search := range searches {
+		if kind != "all" && kind != name {
+			continue
+		}
+		hits, err := search(match, viewerID, limit, offset)
+		if err != nil {
+			Err(w, 500, "db")
+			return
+		}
+		out[name] = hits
+	}
+	JSON(w, 200, out)
+}
+
+func (h *SearchHandler) searchUsers(match, viewerID string, limit, offset int) ([]SearchHit, error) {
+	return scanHits(h.DB.Query(`
+SELECT 'user', u.id, `+displayNameSQL+`,
+       snippet(users_fts, -1, `+snippetOpen+`, `+snippetClose+`, '…', 8),
+       '', 0, u.created_at, bm25(users_fts, 0, 1.0, 2.0)
+FROM users_fts
+JOIN users u ON u.id = users_fts.user_id
+WHERE users_fts MATCH ? AND u.id <> ?
+ORDER BY bm25(users_fts, 0, 1.0, 2.0)
+LIMIT ? OFFSET ?`, match, viewerID, limit, offset))
+}
+
+func (h *SearchHandler) searchPosts(match, viewerID string, limit, offset int) ([]SearchHit, error) {
+	args := []any{match}
+	args = append(args, visiblePostArgs(viewerID)...)
+	args = append(args, limit, offset)
+	return scanHits(h.DB.Query(`
+SELECT 'post', CAST(p.id AS TEXT), `+displayNameSQL+`,
+       snippet(posts_fts, 0, `+snippetOpen+`, `+snippetClose+`, '…', 16),
+       p.user_id, p.id, p.created_at, bm25(posts_fts)
+FROM posts_fts
+JOIN posts p ON p.id = posts_fts.rowid
+JOIN users u ON u.id = p.user_id
+WHERE posts_fts MATCH ? AND `+visiblePostSQL+`
+ORDER BY bm25(posts_fts)
+LIMIT ? OFFSET ?`, args...))
+}
+
+// searchComments only finds comments on posts the viewer may see.
+func (h *SearchHandler) searchComments(match, viewerID string, limit, offset int) ([]SearchHit, error) {
+	args := []any{match}
+	args = append(args, visiblePostArgs(viewerID)...)
+	args = append(args, limit, offset)
+	return scanHits(h.DB.Query(`
+SELECT 'comment', CAST(c.id AS TEXT), `+displayNameSQL+`,
+       snippet(comments_fts, 0, `+snippetOpen+`, `+snippetClose+`, '…', 16),
+       c.user_id, c.post_id, c.created_at, bm25(comments_fts)
+FROM comments_fts
+JOIN comments c ON c.id = comments_fts.rowid
+JOIN posts p ON p.id = c.post_id
+JOIN users u ON u.id = c.user_id
+WHERE comments_fts MATCH ? AND `+visiblePostSQL+`
+ORDER BY bm25(comments_fts)
+LIMIT ? OFFSET ?`, args...))
+}
+
+// searchGroups covers the same groups as GroupHandler.Discover, so no
+// secret ones the viewer isn't in; a title match counts more than a
+// description match.
+func (h *SearchHandler) searchGroups(match, viewerID string, limit, offset int) ([]SearchHit, error) {
+	return scanHits(h.DB.Query(`
+SELECT 'group', CAST(g.id AS TEXT), g.title,
+       snippet(groups_fts, -1, `+snippetOpen+`, `+snippetClose+`, '…', 16),
+       g.owner_id, 0, g.created_at, bm25(groups_fts, 3.0, 1.0)
+FROM groups_fts
+JOIN groups g ON g.id = groups_fts.rowid
+WHERE groups_fts MATCH ? AND `+visibleGroupSQL+`
+ORDER BY bm25(groups_fts, 3.0, 1.0)
+LIMIT ? OFFSET ?`, match, viewerID, limit, offset))
+}
+
+func scanHits(rows *sql.Rows, err error) ([]SearchHit, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		if err := rows.Scan(&hit.Type, &hit.ID, &hit.Title, &hit.Snippet, &hit.UserID, &hit.PostID, &hit.CreatedAt, &hit.Rank); err != nil {
+			return nil, err
+		}
+		hit.Snippet = markSnippet(hit.Snippet)
+		out = append(out, hit)
+	}
+	return out, rows.Err()
+}
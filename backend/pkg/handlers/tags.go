@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"social-network/backend/pkg/auth"
+)
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// A tag or mention must not be glued to a preceding word, so "a#b",
+// "mail@example.com" and URL fragments are ignored.
+var (
+	hashtagRe = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#])#([\p{L}\p{N}_]{1,64})`)
+	mentionRe = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@/])@([A-Za-z0-9_][A-Za-z0-9_.]{0,31})`)
+)
+
+// Mention links an @handle in a body to the user it resolved to.
+type Mention struct {
+	Handle string `json:"handle"`
+	UserID string `json:"userId"`
+}
+
+// parseHashtags returns the distinct lowercased tags in body, in order.
+// Pure numbers ("#1") are not tags.
+func parseHashtags(body string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, m := range hashtagRe.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(m[1])
+		if seen[tag] || strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out
+}
+
+// parseMentions returns the distinct @handles in body, in order.
+func parseMentions(body string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, m := range mentionRe.FindAllStringSubmatch(body, -1) {
+		handle := strings.TrimRight(m[1], ".")
+		if handle == "" || seen[strings.ToLower(handle)] {
+			continue
+		}
+		seen[strings.ToLower(handle)] = true
+		out = append(out, handle)
+	}
+	return out
+}
+
+// indexText (re)builds the hashtag and mention rows for a post body
+// (commentID nil) or a comment, replacing whatever was indexed before.
+// A handle resolves to the user with that nickname (case-insensitive) when
+// exactly one user has it. Returns the users mentioned for the first time,
+// excluding the author, so edits don't notify the same people twice.
+func indexText(db dbtx, postID int64, commentID *int64, authorID, body string) ([]string, error) {
+	before := map[string]bool{}
+	rows, err := db.Query(`SELECT user_id FROM mentions WHERE post_id=? AND comment_id IS ?`, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var uid string
+		if rows.Scan(&uid) == nil {
+			before[uid] = true
+		}
+	}
+	rows.Close()
+
+	if _, err := db.Exec(`DELETE FROM hashtags WHERE post_id=? AND comment_id IS ?`, postID, commentID); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`DELETE FROM mentions WHERE post_id=? AND comment_id IS ?`, postID, commentID); err != nil {
+		return nil, err
+	}
+
+	for _, tag := range parseHashtags(body) {
+		if _, err := db.Exec(`INSERT INTO hashtags (tag, post_id, comment_id) VALUES (?,?,?)`, tag, postID, commentID); err != nil {
+			return nil, err
+		}
+	}
+
+	var fresh []string
+	for _, handle := range parseMentions(body) {
+		var ids []string
+		rows, err := db.Query(`SELECT id FROM users WHERE nickname = ? COLLATE NOCASE LIMIT 2`, handle)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if rows.Scan(&id) == nil {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+		if len(ids) != 1 {
+			continue // unknown or ambiguous handle
+		}
+		if _, err := db.Exec(`INSERT INTO mentions (user_id, actor_id, handle, post_id, comment_id) VALUES (?,?,?,?,?)`,
+			ids[0], authorID, handle, postID, commentID); err != nil {
+			return nil, err
+		}
+		if ids[0] != authorID && !before[ids[0]] {
+			fresh = append(fresh, ids[0])
+		}
+	}
+	return fresh, nil
+}
+
+// IndexBacklog indexes the posts and comments queued in text_index_backlog
+// (migration 000036: everything written before hashtags and mentions were
+// parsed) and empties it. Nobody is notified about these mentions.
+func IndexBacklog(db *sql.DB) error {
+	type item struct {
+		postID    int64
+		commentID *int64
+		authorID  string
+		body      string
+	}
+	rows, err := db.Query(`
+SELECT b.post_id, b.comment_id, COALESCE(c.user_id, p.user_id), COALESCE(c.body, p.body)
+FROM text_index_backlog b
+JOIN posts p ON p.id = b.post_id
+LEFT JOIN comments c ON c.id = b.comment_id
+WHERE b.comment_id IS NULL OR c.id IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	var items []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.postID, &it.commentID, &it.authorID, &it.body); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, it := range items {
+		if _, err := indexText(tx, it.postID, it.commentID, it.authorID, it.body); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM text_index_backlog`); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if len(items) > 0 {
+		log.Printf("indexed hashtags and mentions of %d older posts and comments", len(items))
+	}
+	return nil
+}
+
+// notifyMentions tells each mentioned user about the post/comment, but only
+// if they are allowed to see the post.
+func notifyMentions(n *Notifier, actorID string, postID int64, commentID *int64, userIDs []string) {
+	if n == nil {
+		return
+	}
+	var cid int64
+	if commentID != nil {
+		cid = *commentID
+	}
+	for _, uid := range userIDs {
+		if ok, _ := canViewPost(n.DB, strconv.FormatInt(postID, 10), uid); !ok {
+			continue
+		}
+		n.Notify(Note{Type: "mention", UserID: uid, ActorID: actorID, PostID: postID, CommentID: cid})
+	}
+}
+
+// loadMentions returns resolved mentions keyed by post id (post bodies) or,
+// with forComments, by comment id.
+func loadMentions(db *sql.DB, ids []int64, forComments bool) (map[int64][]Mention, error) {
+	out := map[int64][]Mention{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	ph := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		ph[i] = "?"
+		args[i] = id
+	}
+	q := `SELECT post_id, user_id, handle FROM mentions WHERE comment_id IS NULL AND post_id IN (` + strings.Join(ph, ",") + `)`
+	if forComments {
+		q = `SELECT comment_id, user_id, handle FROM mentions WHERE comment_id IN (` + strings.Join(ph, ",") + `)`
+	}
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var m Mention
+		if err := rows.Scan(&id, &m.UserID, &m.Handle); err == nil {
+			out[id] = append(out[id], m)
+		}
+	}
+	return out, rows.Err()
+}
+
+// nonNilMentions makes bodies without mentions serialize as "mentions": [].
+func nonNilMentions(m []Mention) []Mention {
+	if m == nil {
+		return []Mention{}
+	}
+	return m
+}
+
+// GET /api/hashtags/{tag}?limit=20&offset=0
+// Posts the viewer can see whose body, or one of whose comments, uses #tag.
+func (h *PostHandler) ByHashtag(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/hashtags/"), "#"))
+	if tag == "" || strings.Contains(tag, "/") {
+		Err(w, 400, "tag required")
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, _ := strconv.Atoi(l); n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if n, _ := strconv.Atoi(o); n >= 0 {
+			offset = n
+		}
+	}
+	viewerID := ""
+	if u, err := auth.FromRequest(h.DB, r); err == nil {
+		viewerID = u.ID
+	}
+
+	out, err := h.listPosts(viewerID, `AND p.id IN (SELECT post_id FROM hashtags WHERE tag=?)`, []any{tag}, limit, offset)
+	if err != nil {
+		Err(w, 500, "db")
+		return
+	}
+	JSON(w, 200, out)
+}
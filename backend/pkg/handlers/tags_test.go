@@ -0,0 +1,31 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import "testing"
+
+func TestIndexBacklog(t *testing.T) {
+	db := testDB(t)
+	testUser(t, db, "ann")
+	testUser(t, db, "bob")
+	for _, q := range []string{
+		`INSERT INTO posts (id, user_id, body, visibility) VALUES (1, 'ann-id', 'old #Go post for @bob', 'public')`,
+		`INSERT INTO comments (id, post_id, user_id, body) VALUES (1, 1, 'bob-id', 'a #reply')`,
+		`INSERT INTO text_index_backlog (post_id, comment_id) VALUES (1, NULL), (1, 1), (1, 99)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := IndexBacklog(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var tags, mentions, left int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM hashtags WHERE (tag='go' AND comment_id IS NULL) OR (tag='reply' AND comment_id=1)`).Scan(&tags)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM mentions WHERE user_id='bob-id' AND post_id=1`).Scan(&mentions)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM text_index_backlog`).Scan(&left)
+	if tags != 2 || mentions != 1 || left != 0 {
+		t.Errorf("tags %d, mentions %d, left in backlog %d; want 2, 1, 0", tags, mentions, left)
+	}
+}
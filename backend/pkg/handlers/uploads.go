@@ -1,29 +1,52 @@
 package handlers
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
 	"time"
+
+	"social-network/backend/pkg/auth"
+	"social-network/backend/pkg/storage"
 )
 
-// UploadImage handles POST /api/upload with form-data field "file".
-// Saves JPEG/PNG/GIF to uploadDir and returns {"url": "/uploads/<name>"}.
-func UploadImage(uploadDir string) http.Handler {
-	// ensure dir exists
-	_ = os.MkdirAll(uploadDir, 0755)
+// upload describes one accepted content type.
+type upload struct {
+	mediaType string // "image" | "gif" | "video"
+	ext       string
+	maxBytes  int64
+}
+
+// Accepted uploads, keyed by the sniffed content type (the client's file
+// name and Content-Type are not trusted).
+var uploadTypes = map[string]upload{
+	"image/jpeg": {"image", ".jpg", maxImageBytes},
+	"image/png":  {"image", ".png", maxImageBytes},
+	"image/gif":  {"gif", ".gif", maxImageBytes},
+	"video/mp4":  {"video", ".mp4", maxVideoBytes},
+	"video/webm": {"video", ".webm", maxVideoBytes},
+}
 
+// UploadMedia handles POST /api/upload with form-data field "file".
+// Accepts JPEG/PNG images, GIFs and short MP4/WebM clips, checking the real
+// container type, size and play time. GIFs also get a PNG poster frame.
+// Returns {"url", "mediaType", "contentType", "posterUrl"?, "durationMs"?}.
+// The uploader (if logged in) is recorded in the media table so the file
+// stays readable by them before it is attached to a post or profile.
+func UploadMedia(db *sql.DB, store storage.MediaStore) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			Err(w, http.StatusMethodNotAllowed, "method")
 			return
 		}
 
-		// Limit request body size (e.g. 10MB)
-		r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+		// Limit request body size (largest allowed file + form overhead)
+		r.Body = http.MaxBytesReader(w, r.Body, maxVideoBytes+1<<20)
 
 		file, header, err := r.FormFile("file")
 		if err != nil {
@@ -32,30 +55,134 @@ func UploadImage(uploadDir string) http.Handler {
 		}
 		defer file.Close()
 
-		ext := strings.ToLower(filepath.Ext(header.Filename))
-		switch ext {
-		case ".jpg", ".jpeg", ".png", ".gif":
-		default:
+		var sniff [512]byte
+		n, _ := io.ReadFull(file, sniff[:])
+		contentType := http.DetectContentType(sniff[:n])
+		kind, ok := uploadTypes[contentType]
+		if !ok {
 			Err(w, http.StatusBadRequest, "unsupported type")
 			return
 		}
+		if header.Size > kind.maxBytes {
+			Err(w, http.StatusRequestEntityTooLarge, "file too large")
+			return
+		}
 
-		// generate unique filename
-		name := fmt.Sprintf("%d_%d%s", time.Now().UnixNano(), os.Getpid(), ext)
-		path := filepath.Join(uploadDir, name)
-
-		out, err := os.Create(path)
+		dur, poster, err := probeUpload(file, contentType)
 		if err != nil {
+			if errors.Is(err, errClipTooLong) {
+				Err(w, http.StatusBadRequest, fmt.Sprintf("clip longer than %ds", int(maxClipDuration.Seconds())))
+			} else {
+				Err(w, http.StatusBadRequest, "invalid "+kind.mediaType)
+			}
+			return
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
 			Err(w, http.StatusInternalServerError, "save error")
 			return
 		}
-		defer out.Close()
 
-		if _, err := io.Copy(out, file); err != nil {
+		// generate unique filename
+		base := fmt.Sprintf("%d_%d", time.Now().UnixNano(), os.Getpid())
+		name := base + kind.ext
+
+		if err := store.Put(r.Context(), name, file, header.Size, contentType); err != nil {
 			Err(w, http.StatusInternalServerError, "save error")
 			return
 		}
+		posterName := ""
+		if poster != nil {
+			posterName = base + "_poster.png"
+			if err := store.Put(r.Context(), posterName, bytes.NewReader(poster), int64(len(poster)), "image/png"); err != nil {
+				_ = store.Delete(r.Context(), name)
+				Err(w, http.StatusInternalServerError, "save error")
+				return
+			}
+		}
+		var durationMs *int64
+		if kind.mediaType != "image" {
+			ms := dur.Milliseconds()
+			durationMs = &ms
+		}
+
+		var ownerID *string
+		if u, err := auth.FromRequest(db, r); err == nil {
+			ownerID = &u.ID
+		}
+		if err := recordUpload(db, name, posterName, ownerID, kind.mediaType, contentType, durationMs); err != nil {
+			_ = store.Delete(r.Context(), name)
+			if posterName != "" {
+				_ = store.Delete(r.Context(), posterName)
+			}
+			Err(w, http.StatusInternalServerError, "db")
+			return
+		}
 
-		JSON(w, http.StatusOK, map[string]string{"url": "/uploads/" + name})
+		out := map[string]any{
+			"url":         "/uploads/" + name,
+			"mediaType":   kind.mediaType,
+			"contentType": contentType,
+		}
+		if posterName != "" {
+			out["posterUrl"] = "/uploads/" + posterName
+		}
+		if durationMs != nil {
+			out["durationMs"] = *durationMs
+		}
+		JSON(w, http.StatusOK, out)
 	})
-}
\ No newline at end of file
+}
+
+// probeUpload checks GIF/video play time against maxClipDuration and returns
+// a poster frame for GIFs. Still images need no probing.
+func probeUpload(f multipart.File, contentType string) (time.Duration, []byte, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	var dur time.Duration
+	var poster []byte
+	var err error
+	switch contentType {
+	case "image/gif":
+		dur, poster, err = probeGIF(f)
+	case "video/mp4":
+		dur, err = mp4Duration(f)
+	case "video/webm":
+		dur, err = webmDuration(f)
+	default:
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if dur > maxClipDuration {
+		return 0, nil, errClipTooLong
+	}
+	return dur, poster, nil
+}
+
+// recordUpload stores the media rows for a file and its poster (if any) in one go.
+func recordUpload(db *sql.DB, name, posterName string, ownerID *string, mediaType, contentType string, durationMs *int64) error {
+	var posterURL *string
+	if posterName != "" {
+		u := "/uploads/" + posterName
+		posterURL = &u
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO media (name, owner_id, media_type, content_type, duration_ms, poster_url)
+		VALUES (?,?,?,?,?,?)`, name, ownerID, mediaType, contentType, durationMs, posterURL); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if posterName != "" {
+		if _, err := tx.Exec(`INSERT INTO media (name, owner_id, media_type, content_type) VALUES (?,?, 'image', 'image/png')`,
+			posterName, ownerID); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -49,21 +49,28 @@ LEFT JOIN follows f
 		params[0] = me.ID
 	}
 
+	// Names and nicknames go through the full-text index (best match first);
+	// an email address only matches exactly.
+	orderLimit := `ORDER BY u.created_at DESC LIMIT ?`
+	if match := ftsQuery(q); match != "" {
+		base += `JOIN (
+  SELECT user_id, MIN(rank) AS rank FROM (
+    SELECT user_id, bm25(users_fts, 0, 1.0, 2.0) AS rank FROM users_fts WHERE users_fts MATCH ?
+    UNION ALL
+    SELECT id, -1e9 FROM users WHERE email = ? COLLATE NOCASE
+  ) GROUP BY user_id
+) s ON s.user_id = u.id
+`
+		params = append(params, match, q)
+		orderLimit = `ORDER BY s.rank, u.created_at DESC LIMIT ?`
+	}
+
 	where := `WHERE 1=1 `
 	if me != nil {
 		where += `AND u.id <> ? `
 		params = append(params, me.ID) // exclude self
 	}
 
-	if q == "" {
-		where += ``
-	} else {
-		where += `AND (u.email LIKE ? OR u.first_name LIKE ? OR u.last_name LIKE ? OR u.nickname LIKE ?) `
-		like := "%" + q + "%"
-		params = append(params, like, like, like, like)
-	}
-
-	orderLimit := `ORDER BY u.created_at DESC LIMIT ?`
 	params = append(params, limit)
 
 	sqlStr := base + where + orderLimit
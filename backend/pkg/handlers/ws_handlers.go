@@ -1,16 +1,22 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
+	"strings"
 	"time"
 
+	"social-network/backend/pkg/auth"
 	"social-network/backend/pkg/ws"
 
 	"github.com/gorilla/websocket"
 )
 
-// NEW: add Presence field
+// WSHandler joins a socket to a room, if the session may read what is sent
+// there (see wsRoomDenied). In the "presence" room it marks the session's
+// user online, which also holds back their Web Push notifications.
 type WSHandler struct {
+	DB       *sql.DB
 	Hub      *ws.Hub
 	Presence *Presence
 }
@@ -19,7 +25,12 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-type wsClient struct{ *websocket.Conn }
+// wsClient is one socket, with the user its session belonged to when it
+// joined ("" for none), so access can be checked again later (recheckRoom).
+type wsClient struct {
+	*websocket.Conn
+	userID string
+}
 
 func (c wsClient) Send(b []byte) error { return c.WriteMessage(websocket.TextMessage, b) }
 func (c wsClient) Close() error        { return c.Conn.Close() }
@@ -31,53 +42,69 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	viewerID := ""
+	if u, err := auth.FromRequest(h.DB, r); err == nil {
+		viewerID = u.ID
+	}
+	if code, msg := wsRoomDenied(h.DB, room, viewerID); code != 0 {
+		http.Error(w, msg, code)
+		return
+	}
+
+	// only the session's own user can be made to look online
+	userID := ""
+	if h.Presence != nil && room == "presence" {
+		if q := r.URL.Query().Get("user"); q != "" && q != viewerID {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		userID = viewerID
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
 	defer conn.Close()
 
-	client := wsClient{conn}
+	client := wsClient{conn, viewerID}
 
 	// presence tracking
-	if h.Presence != nil && room == "presence" {
-		userID := r.URL.Query().Get("user")
-		if userID != "" {
-			if h.Presence.inc(userID) {
-				// only broadcast "online" when first connection appears
+	if userID != "" {
+		if h.Presence.inc(userID) {
+			// only broadcast "online" when first connection appears
+			h.Hub.Broadcast("presence", ws.Message{
+				Type: "online", Room: "presence", At: time.Now().Unix(),
+				Payload: map[string]any{"userId": userID},
+			})
+		}
+		// mark offline when this socket closes; only broadcast if last connection
+		defer func(uid string) {
+			if h.Presence.dec(uid) {
 				h.Hub.Broadcast("presence", ws.Message{
-					Type: "online", Room: "presence", At: time.Now().Unix(),
-					Payload: map[string]any{"userId": userID},
+					Type: "offline", Room: "presence", At: time.Now().Unix(),
+					Payload: map[string]any{"userId": uid},
 				})
 			}
-			// mark offline when this socket closes; only broadcast if last connection
-			defer func(uid string) {
-				if h.Presence.dec(uid) {
-					h.Hub.Broadcast("presence", ws.Message{
-						Type: "offline", Room: "presence", At: time.Now().Unix(),
-						Payload: map[string]any{"userId": uid},
-					})
-				}
-			}(userID)
-			
-			// single pong handler for both presence and keepalive
-			conn.SetPongHandler(func(string) error {
-				h.Presence.touch(userID)
-				_ = conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-				return nil
-			})
-			
-			// send periodic pings
-			go func(c *websocket.Conn, uid string) {
-				ticker := time.NewTicker(25 * time.Second)
-				defer ticker.Stop()
-				for range ticker.C {
-					if err := c.WriteMessage(websocket.PingMessage, []byte("p")); err != nil {
-						return
-					}
+		}(userID)
+		
+		// single pong handler for both presence and keepalive
+		conn.SetPongHandler(func(string) error {
+			h.Presence.touch(userID)
+			_ = conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			return nil
+		})
+		
+		// send periodic pings
+		go func(c *websocket.Conn, uid string) {
+			ticker := time.NewTicker(25 * time.Second)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := c.WriteMessage(websocket.PingMessage, []byte("p")); err != nil {
+					return
 				}
-			}(conn, userID)
-		}
+			}
+		}(conn, userID)
 	} else {
 		// regular keepalive for non-presence rooms
 		conn.SetPongHandler(func(string) error {
@@ -108,3 +135,60 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// recheckRoom closes the sockets in room whose user may no longer read it
+// (see wsRoomDenied), after a change to who may: a member leaving or being
+// removed, a group changing visibility or being deleted, a post being made
+// less visible. Their clients reconnect and are turned away.
+func recheckRoom(db *sql.DB, hub *ws.Hub, room string) {
+	if hub == nil {
+		return
+	}
+	hub.Revoke(room, func(c ws.Client) bool {
+		wc, ok := c.(wsClient)
+		if !ok {
+			return false
+		}
+		code, _ := wsRoomDenied(db, room, wc.userID)
+		return code != 0
+	})
+}
+
+// wsRoomDenied says why viewerID ("" without a session) can't join room, as
+// an HTTP status and message, or 0 if they can:
+//   - "feed" is open to everyone, "post:<id>" to whoever can see the post
+//   - "user:<id>" (notifications) only to that user
+//   - "dm:<a>:<b>" only to the two users in it
+//   - "group:<id>" (chat, events) to whoever may read the group
+//   - "presence" to anyone signed in
+func wsRoomDenied(db *sql.DB, room, viewerID string) (int, string) {
+	kind, id, _ := strings.Cut(room, ":")
+	switch {
+	case room == "feed":
+		return 0, ""
+	case kind == "post":
+		if ok, _ := canViewPost(db, id, viewerID); !ok {
+			return 404, "post not found"
+		}
+		return 0, ""
+	case viewerID == "":
+		return 401, "unauthenticated"
+	case room == "presence":
+		return 0, ""
+	}
+	switch kind {
+	case "user":
+		if id != viewerID {
+			return 403, "forbidden"
+		}
+		return 0, ""
+	case "dm":
+		if a, b, _ := strings.Cut(id, ":"); a != viewerID && b != viewerID {
+			return 403, "forbidden"
+		}
+		return 0, ""
+	case "group":
+		return groupReadDenied(db, id, viewerID)
+	}
+	return 404, "unknown room"
+}
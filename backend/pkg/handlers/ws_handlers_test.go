@@ -0,0 +1,116 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"social-network/backend/pkg/ws"
+)
+
+func TestWSRooms(t *testing.T) {
+	db := testDB(t)
+	annID, annCookie := testUser(t, db, "ann")
+	bobID, bobCookie := testUser(t, db, "bob")
+	for _, q := range []string{
+		`INSERT INTO groups (id, owner_id, title, description, visibility) VALUES (1, 'ann-id', 'secret', '', 'secret')`,
+		`INSERT INTO groups (id, owner_id, title, description, visibility) VALUES (2, 'ann-id', 'public', '', 'public')`,
+		`INSERT INTO group_members (group_id, user_id, role, status) VALUES (1, 'ann-id', 'owner', 'accepted')`,
+		`INSERT INTO posts (id, user_id, body, visibility, created_at) VALUES (1, 'ann-id', 'hi', 'public', datetime('now'))`,
+		`INSERT INTO posts (id, user_id, body, visibility, created_at) VALUES (2, 'ann-id', 'hi', 'private', datetime('now'))`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := httptest.NewServer(&WSHandler{DB: db, Hub: ws.NewHub(), Presence: NewPresence(db)})
+	defer srv.Close()
+	dial := func(room string, cookie *http.Cookie) int {
+		h := http.Header{}
+		if cookie != nil {
+			h.Set("Cookie", cookie.String())
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?room="+url.QueryEscape(room), h)
+		if err == nil {
+			conn.Close()
+			return http.StatusSwitchingProtocols
+		}
+		if resp == nil {
+			t.Fatalf("%s: %v", room, err)
+		}
+		return resp.StatusCode
+	}
+
+	dm := "dm:" + annID + ":" + bobID
+	for _, c := range []struct {
+		room   string
+		cookie *http.Cookie
+		want   int
+	}{
+		{"feed", nil, 101},
+		{"post:1", nil, 101},
+		{"post:2", nil, 404},
+		{"post:2", bobCookie, 404},
+		{"post:2", annCookie, 101},
+		{"user:" + annID, nil, 401},
+		{"user:" + annID, bobCookie, 403},
+		{"user:" + annID, annCookie, 101},
+		{dm, nil, 401},
+		{dm, bobCookie, 101},
+		{"dm:" + annID + ":someone", bobCookie, 403},
+		{"group:1", nil, 401},
+		{"group:1", bobCookie, 404}, // secret: not even there
+		{"group:1", annCookie, 101},
+		{"group:2", bobCookie, 101},
+		{"group:3", annCookie, 404},
+		{"presence", nil, 401},
+		{"presence", bobCookie, 101},
+		{"whatever", annCookie, 404},
+	} {
+		if got := dial(c.room, c.cookie); got != c.want {
+			t.Errorf("%s with cookie %v: %d, want %d", c.room, c.cookie, got, c.want)
+		}
+	}
+}
+
+func TestWSRecheckRoom(t *testing.T) {
+	db := testDB(t)
+	testUser(t, db, "ann")
+	_, bobCookie := testUser(t, db, "bob")
+	if _, err := db.Exec(`INSERT INTO groups (id, owner_id, title, description, visibility) VALUES (1, 'ann-id', 'g', '', 'public')`); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := ws.NewHub()
+	srv := httptest.NewServer(&WSHandler{DB: db, Hub: hub, Presence: NewPresence(db)})
+	defer srv.Close()
+	h := http.Header{}
+	h.Set("Cookie", bobCookie.String())
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?room=group:1", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	recheckRoom(db, hub, "group:1") // nothing changed: stays
+	hub.Broadcast("group:1", ws.Message{Type: "hello"})
+	if _, data, err := conn.ReadMessage(); err != nil || !strings.Contains(string(data), "hello") {
+		t.Fatalf("before: %q %v", data, err)
+	}
+
+	if _, err := db.Exec(`UPDATE groups SET visibility='private' WHERE id=1`); err != nil {
+		t.Fatal(err)
+	}
+	recheckRoom(db, hub, "group:1")
+	hub.Broadcast("group:1", ws.Message{Type: "secret"})
+	if _, data, err := conn.ReadMessage(); err == nil {
+		t.Errorf("still subscribed after losing access: %q", data)
+	}
+}
@@ -0,0 +1,168 @@
+// Package ical writes iCalendar (RFC 5545) files: a VCALENDAR of VEVENTs,
+// with recurrence rules, exceptions and per-occurrence overrides, and a
+// VTIMEZONE for each time zone they use.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar is a VCALENDAR.
+type Calendar struct {
+	ProdID string // e.g. "-//Social Network//Events//EN"
+	Name   string // shown by clients as the calendar's name; optional
+	Events []Event
+}
+
+// Event is a VEVENT. Times in UTC are written as such; others with the
+// TZID of their location (an IANA name), so recurring events follow its DST
+// changes.
+type Event struct {
+	UID          string
+	Start        time.Time
+	RecurrenceID time.Time // set on an override of one occurrence of UID
+	RRule        string    // without the "RRULE:" prefix
+	ExDates      []time.Time
+	Summary      string
+	Description  string
+	URL          string
+	Status       string // TENTATIVE | CONFIRMED | CANCELLED
+	Created      time.Time
+	LastModified time.Time
+	Attendees    []Attendee
+}
+
+type Attendee struct {
+	Name     string
+	Email    string
+	PartStat string // NEEDS-ACTION | ACCEPTED | DECLINED | TENTATIVE
+}
+
+// ContentType is the media type of an iCalendar file.
+const ContentType = "text/calendar; charset=utf-8"
+
+// WriteTo writes c as an iCalendar file.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &writer{w: bufio.NewWriter(w)}
+	stamp := time.Now().UTC()
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:" + c.ProdID)
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		cw.line("X-WR-CALNAME:" + Escape(c.Name))
+	}
+	for _, u := range zonesUsed(c.Events) {
+		cw.timezone(u, stamp)
+	}
+	for _, e := range c.Events {
+		cw.line("BEGIN:VEVENT")
+		cw.line("UID:" + Escape(e.UID))
+		cw.line("DTSTAMP:" + stamp.Format(utcLayout))
+		cw.time("DTSTART", e.Start)
+		if !e.RecurrenceID.IsZero() {
+			cw.time("RECURRENCE-ID", e.RecurrenceID)
+		}
+		if e.RRule != "" {
+			cw.line("RRULE:" + e.RRule)
+		}
+		for _, t := range e.ExDates {
+			cw.time("EXDATE", t)
+		}
+		cw.line("SUMMARY:" + Escape(e.Summary))
+		if e.Description != "" {
+			cw.line("DESCRIPTION:" + Escape(e.Description))
+		}
+		if e.URL != "" {
+			cw.line("URL:" + e.URL)
+		}
+		if e.Status != "" {
+			cw.line("STATUS:" + e.Status)
+		}
+		if !e.Created.IsZero() {
+			cw.line("CREATED:" + e.Created.UTC().Format(utcLayout))
+		}
+		if !e.LastModified.IsZero() {
+			cw.line("LAST-MODIFIED:" + e.LastModified.UTC().Format(utcLayout))
+		}
+		for _, a := range e.Attendees {
+			cw.line("ATTENDEE;CN=" + paramValue(a.Name) + ";PARTSTAT=" + a.PartStat + ":mailto:" + a.Email)
+		}
+		cw.line("END:VEVENT")
+	}
+	cw.line("END:VCALENDAR")
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+const (
+	utcLayout   = "20060102T150405Z"
+	localLayout = "20060102T150405"
+)
+
+type writer struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *writer) time(name string, t time.Time) {
+	if t.Location() == time.UTC {
+		cw.line(name + ":" + t.Format(utcLayout))
+		return
+	}
+	cw.line(name + ";TZID=" + t.Location().String() + ":" + t.Format(localLayout))
+}
+
+// line writes a content line, folded to 75 octets as RFC 5545 asks,
+// without splitting a UTF-8 sequence.
+func (cw *writer) line(s string) {
+	if cw.err != nil {
+		return
+	}
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		cw.write(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74 // the leading space counts
+	}
+	cw.write(s + "\r\n")
+}
+
+func (cw *writer) write(s string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.WriteString(s)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// Escape escapes s for a TEXT value.
+func Escape(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// paramValue quotes a parameter value; DQUOTE can't appear in one at all.
+func paramValue(s string) string {
+	s = strings.NewReplacer(`"`, "'", "\r", " ", "\n", " ").Replace(s)
+	if strings.ContainsAny(s, ";:,") {
+		return `"` + s + `"`
+	}
+	return s
+}
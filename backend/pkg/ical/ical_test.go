@@ -0,0 +1,101 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustZone(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// timezones splits a calendar into its VTIMEZONEs by TZID.
+func timezones(t *testing.T, cal string) map[string]string {
+	t.Helper()
+	out := map[string]string{}
+	for _, part := range strings.Split(cal, "BEGIN:VTIMEZONE\r\n")[1:] {
+		body, _, ok := strings.Cut(part, "END:VTIMEZONE\r\n")
+		if !ok {
+			t.Fatalf("unterminated VTIMEZONE: %q", part)
+		}
+		tzid, _, _ := strings.Cut(strings.TrimPrefix(body, "TZID:"), "\r\n")
+		if _, dup := out[tzid]; dup {
+			t.Errorf("VTIMEZONE %s written twice", tzid)
+		}
+		out[tzid] = body
+	}
+	return out
+}
+
+func TestTimezones(t *testing.T) {
+	ny, london, kolkata := mustZone(t, "America/New_York"), mustZone(t, "Europe/London"), mustZone(t, "Asia/Kolkata")
+	start := time.Date(2026, 1, 6, 18, 30, 0, 0, ny)
+	cal := Calendar{ProdID: "-//Test//EN", Events: []Event{
+		{UID: "1", Start: start, RRule: "FREQ=WEEKLY", ExDates: []time.Time{start.AddDate(0, 0, 7)}, Summary: "weekly"},
+		{UID: "1", Start: start.AddDate(0, 0, 14), RecurrenceID: start.AddDate(0, 0, 14), Summary: "moved"},
+		{UID: "2", Start: time.Date(2026, 7, 1, 9, 0, 0, 0, london), Summary: "london"},
+		{UID: "3", Start: time.Date(2026, 7, 1, 9, 0, 0, 0, kolkata), Summary: "kolkata"},
+		{UID: "4", Start: time.Date(2026, 7, 1, 9, 0, 0, 0, time.UTC), Summary: "utc"},
+	}}
+	var b strings.Builder
+	if _, err := cal.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	zones := timezones(t, out)
+	if len(zones) != 3 {
+		t.Fatalf("got VTIMEZONEs for %v, want New York, London and Kolkata", zones)
+	}
+	for _, tzid := range []string{"America/New_York", "Europe/London", "Asia/Kolkata"} {
+		if !strings.Contains(out, ";TZID="+tzid+":") {
+			t.Errorf("no time written with TZID=%s", tzid)
+		}
+		if _, ok := zones[tzid]; !ok {
+			t.Errorf("TZID=%s used without a VTIMEZONE", tzid)
+		}
+	}
+	if i, j := strings.Index(out, "BEGIN:VTIMEZONE"), strings.Index(out, "BEGIN:VEVENT"); i > j {
+		t.Error("VTIMEZONE after the events")
+	}
+
+	for tzid, want := range map[string][]string{
+		"America/New_York": {
+			"BEGIN:DAYLIGHT\r\nDTSTART:", "RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT",
+			"BEGIN:STANDARD\r\nDTSTART:", "RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\nTZNAME:EST",
+			// the first change covered: spring 2025, at 2am standard time
+			"DTSTART:20250309T020000\r\nTZOFFSETFROM:-0500",
+		},
+		"Europe/London": {
+			"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\nTZOFFSETFROM:+0000\r\nTZOFFSETTO:+0100",
+			"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0000",
+		},
+		"Asia/Kolkata": {
+			"BEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0530\r\nTZOFFSETTO:+0530\r\nTZNAME:IST\r\nEND:STANDARD",
+		},
+	} {
+		for _, w := range want {
+			if !strings.Contains(zones[tzid], w) {
+				t.Errorf("VTIMEZONE %s lacks %q:\n%s", tzid, w, zones[tzid])
+			}
+		}
+	}
+	if strings.Contains(zones["Asia/Kolkata"], "DAYLIGHT") {
+		t.Error("Kolkata has no DST")
+	}
+}
+
+func TestUTCOffset(t *testing.T) {
+	for secs, want := range map[int]string{0: "+0000", 19800: "+0530", -18000: "-0500", -2670: "-004430"} {
+		if got := utcOffset(secs); got != want {
+			t.Errorf("utcOffset(%d) = %s, want %s", secs, got, want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RFC 5545 wants a VTIMEZONE for every TZID a file uses. Go doesn't expose a
+// zone's rules, so they are recovered from its offsets: every change from a
+// little before the first time written until a year from now (or the last
+// time written) is listed. The final year's changes are given as a yearly
+// RRULE when they follow one ("2nd Sunday of March"), so recurring events
+// keep their DST changes past the end of that window; otherwise the
+// changes are listed for ten more years.
+
+// transition is a change of a zone's offset.
+type transition struct {
+	at       time.Time // in UTC
+	from, to int       // offsets east of UTC, in seconds
+	name     string    // abbreviation from then on, e.g. CEST
+	dst      bool
+}
+
+// zoneUse is how far a zone's times reach in one file.
+type zoneUse struct {
+	loc        *time.Location
+	first, end time.Time
+}
+
+// transitions lists loc's offset changes in [from, to).
+func transitions(loc *time.Location, from, to time.Time) []transition {
+	var out []transition
+	_, off := from.In(loc).Zone()
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if _, o := next.In(loc).Zone(); o == off {
+			t = next
+			continue
+		}
+		// the change is in (t, next]: narrow it down to the second
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == off {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		name, o := hi.In(loc).Zone()
+		out = append(out, transition{at: hi.UTC(), from: off, to: o, name: name, dst: hi.In(loc).IsDST()})
+		off = o
+		t = hi
+	}
+	return out
+}
+
+// yearlyRule finds the RRULE tr repeats by, e.g. "FREQ=YEARLY;BYMONTH=3;BYDAY=2SU",
+// checking it against loc's next few years.
+func yearlyRule(loc *time.Location, tr transition) (string, bool) {
+	local := tr.at.Add(time.Duration(tr.from) * time.Second) // wall clock before the change, as if in UTC
+	nth := (local.Day()-1)/7 + 1
+	if local.Day()+7 > daysIn(local.Year(), local.Month()) {
+		nth = -1
+	}
+	for year := local.Year() + 1; year <= local.Year()+3; year++ {
+		day := nthWeekday(year, local.Month(), local.Weekday(), nth)
+		at := time.Date(year, local.Month(), day, local.Hour(), local.Minute(), local.Second(), 0, time.UTC).
+			Add(-time.Duration(tr.from) * time.Second)
+		if _, before := at.Add(-time.Second).In(loc).Zone(); before != tr.from {
+			return "", false
+		}
+		if _, after := at.In(loc).Zone(); after != tr.to {
+			return "", false
+		}
+	}
+	return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", local.Month(), nth, weekdayCodes[local.Weekday()]), true
+}
+
+var weekdayCodes = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func daysIn(year int, m time.Month) int {
+	return time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// nthWeekday is the day of the month of its nth wd, or the last for n = -1.
+func nthWeekday(year int, m time.Month, wd time.Weekday, n int) int {
+	if n < 0 {
+		last := daysIn(year, m)
+		return last - (int(time.Date(year, m, last, 0, 0, 0, 0, time.UTC).Weekday())-int(wd)+7)%7
+	}
+	first := 1 + (int(wd)-int(time.Date(year, m, 1, 0, 0, 0, 0, time.UTC).Weekday())+7)%7
+	return first + (n-1)*7
+}
+
+// timezone writes the VTIMEZONE for a zone used from u.first to u.end.
+func (cw *writer) timezone(u zoneUse, now time.Time) {
+	from := u.first.AddDate(-1, 0, 0)
+	to := now.AddDate(1, 0, 0)
+	if u.end.After(to) {
+		to = u.end
+	}
+	trs := transitions(u.loc, from, to)
+
+	// the last two changes (into and out of DST) become yearly rules if they follow one
+	var rules []string
+	if n := len(trs); n >= 2 && trs[n-1].dst != trs[n-2].dst {
+		r1, ok1 := yearlyRule(u.loc, trs[n-2])
+		r2, ok2 := yearlyRule(u.loc, trs[n-1])
+		if ok1 && ok2 {
+			rules = []string{r1, r2}
+		}
+	}
+	if rules == nil && len(trs) > 0 {
+		trs = append(trs, transitions(u.loc, to, to.AddDate(10, 0, 0))...)
+	}
+
+	cw.line("BEGIN:VTIMEZONE")
+	cw.line("TZID:" + u.loc.String())
+	if len(trs) == 0 {
+		name, off := from.In(u.loc).Zone()
+		epoch := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).Add(-time.Duration(off) * time.Second)
+		cw.observance(transition{at: epoch, from: off, to: off, name: name}, "")
+	}
+	for i, tr := range trs {
+		rule := ""
+		if rules != nil && i >= len(trs)-2 {
+			rule = rules[i-(len(trs)-2)]
+		}
+		cw.observance(tr, rule)
+	}
+	cw.line("END:VTIMEZONE")
+}
+
+func (cw *writer) observance(tr transition, rule string) {
+	kind := "STANDARD"
+	if tr.dst {
+		kind = "DAYLIGHT"
+	}
+	cw.line("BEGIN:" + kind)
+	// the onset in the wall-clock time in force until then
+	cw.line("DTSTART:" + tr.at.Add(time.Duration(tr.from)*time.Second).Format(localLayout))
+	if rule != "" {
+		cw.line("RRULE:" + rule)
+	}
+	cw.line("TZOFFSETFROM:" + utcOffset(tr.from))
+	cw.line("TZOFFSETTO:" + utcOffset(tr.to))
+	if tr.name != "" {
+		cw.line("TZNAME:" + Escape(tr.name))
+	}
+	cw.line("END:" + kind)
+}
+
+// utcOffset formats an offset in seconds as RFC 5545 wants, e.g. -0500.
+func utcOffset(secs int) string {
+	sign := "+"
+	if secs < 0 {
+		sign, secs = "-", -secs
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, secs/3600, secs/60%60)
+	if secs%60 != 0 {
+		s += fmt.Sprintf("%02d", secs%60)
+	}
+	return s
+}
+
+// zonesUsed lists the zones other than UTC that events' times are in, by
+// TZID, with the earliest and latest time written in each.
+func zonesUsed(events []Event) []zoneUse {
+	byName := map[string]*zoneUse{}
+	add := func(t time.Time) {
+		if t.IsZero() || t.Location() == time.UTC {
+			return
+		}
+		u := byName[t.Location().String()]
+		if u == nil {
+			u = &zoneUse{loc: t.Location(), first: t, end: t}
+			byName[t.Location().String()] = u
+		}
+		if t.Before(u.first) {
+			u.first = t
+		}
+		if t.After(u.end) {
+			u.end = t
+		}
+	}
+	for _, e := range events {
+		add(e.Start)
+		add(e.RecurrenceID)
+		for _, t := range e.ExDates {
+			add(t)
+		}
+	}
+	out := make([]zoneUse, 0, len(byName))
+	for _, u := range byName {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].loc.String() < out[j].loc.String() })
+	return out
+}
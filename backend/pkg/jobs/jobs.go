@@ -0,0 +1,72 @@
+// Package jobs runs periodic background work (email digests, cleanups)
+// inside the server process.
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Func is one run of a job. Errors are logged; the job runs again on its
+// next tick either way.
+type Func func(ctx context.Context) error
+
+type job struct {
+	name     string
+	interval time.Duration
+	fn       Func
+}
+
+// Scheduler runs each job on its own interval. A job never overlaps with
+// itself: a slow run just delays the next one.
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs []job
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every registers fn to run every interval, the first time right after Start.
+func (s *Scheduler) Every(name string, interval time.Duration, fn Func) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job{name: name, interval: interval, fn: fn})
+}
+
+// Start runs the jobs in the background until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		go j.loop(ctx)
+	}
+}
+
+func (j job) loop(ctx context.Context) {
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		j.run(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (j job) run(ctx context.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %s: panic: %v", j.name, r)
+		}
+	}()
+	start := time.Now()
+	if err := j.fn(ctx); err != nil {
+		log.Printf("job %s: %v (after %s)", j.name, err, time.Since(start).Round(time.Millisecond))
+	}
+}
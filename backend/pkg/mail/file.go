@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File writes every message as an .eml file into Dir instead of sending it.
+// Handy in development: open the files with any mail client.
+type File struct {
+	Dir  string
+	From string
+}
+
+func NewFile(dir, from string) (*File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &File{Dir: dir, From: from}, nil
+}
+
+func (f *File) Send(ctx context.Context, m Message) error {
+	b, err := m.Bytes(f.From)
+	if err != nil {
+		return err
+	}
+	to := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '<' || r == '>' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, m.To)
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), to)
+	return os.WriteFile(filepath.Join(f.Dir, name), b, 0644)
+}
+
+// Log only logs who would have been mailed what. It is the default, so a
+// fresh checkout never sends real email.
+type Log struct{}
+
+func (Log) Send(ctx context.Context, m Message) error {
+	log.Printf("mail: to=%s subject=%q (%d bytes, not sent: MAILER=log)", m.To, m.Subject, len(m.Text))
+	return nil
+}
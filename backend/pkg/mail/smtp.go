@@ -0,0 +1,105 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type SMTPConfig struct {
+	Host     string // e.g. "smtp.example.com" or "localhost" for a local test server
+	Port     int    // 587 (STARTTLS), 465 (implicit TLS) or 25
+	Username string // empty = no AUTH
+	Password string
+	From     string // e.g. "Social Network <no-reply@example.com>"
+	// ImplicitTLS connects with TLS straight away (port 465). Otherwise
+	// STARTTLS is used whenever the server offers it.
+	ImplicitTLS bool
+}
+
+// SMTP delivers through an SMTP relay, one connection per message.
+type SMTP struct {
+	cfg SMTPConfig
+}
+
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("mail: smtp host is required")
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("mail: bad from address %q", cfg.From)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &SMTP{cfg: cfg}, nil
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	body, err := m.Bytes(s.cfg.From)
+	if err != nil {
+		return err
+	}
+	from, _ := mail.ParseAddress(s.cfg.From)
+	to, _ := mail.ParseAddress(m.To)
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if s.cfg.ImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.cfg.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if !s.cfg.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+				return err
+			}
+		}
+	}
+	if s.cfg.Username != "" {
+		// PlainAuth refuses to send the password unencrypted, except to localhost
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,221 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is a minimal in-process SMTP server: enough of RFC 5321 for
+// net/smtp, with AUTH PLAIN, no STARTTLS, and recipients it can refuse.
+type fakeSMTP struct {
+	ln       net.Listener
+	user     string // AUTH PLAIN credentials it accepts
+	password string
+	refuse   string // RCPT address answered with 550
+
+	mu       sync.Mutex
+	authed   []string
+	messages []fakeMessage
+}
+
+type fakeMessage struct {
+	from, to string
+	data     string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, user: "app", password: "secret"}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) port() int { return s.ln.Addr().(*net.TCPAddr).Port }
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		for _, l := range lines {
+			io.WriteString(conn, l+"\r\n")
+		}
+	}
+
+	reply("220 fake ESMTP")
+	var msg fakeMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-fake", "250-AUTH PLAIN", "250 8BITMIME")
+		case "AUTH":
+			parts := strings.Fields(line)
+			raw, _ := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+			creds := strings.Split(string(raw), "\x00")
+			if len(creds) != 3 || creds[1] != s.user || creds[2] != s.password {
+				reply("535 authentication failed")
+				continue
+			}
+			s.mu.Lock()
+			s.authed = append(s.authed, creds[1])
+			s.mu.Unlock()
+			reply("235 ok")
+		case "MAIL":
+			msg = fakeMessage{from: addrParam(line)}
+			reply("250 ok")
+		case "RCPT":
+			if to := addrParam(line); to == s.refuse {
+				reply("550 no such user")
+			} else {
+				msg.to = to
+				reply("250 ok")
+			}
+		case "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = b.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// addrParam pulls the address out of "MAIL FROM:<a@b>" or "RCPT TO:<a@b>".
+func addrParam(line string) string {
+	i, j := strings.IndexByte(line, '<'), strings.IndexByte(line, '>')
+	if i < 0 || j < i {
+		return ""
+	}
+	return line[i+1 : j]
+}
+
+func TestSMTPSend(t *testing.T) {
+	srv := newFakeSMTP(t)
+	m, err := NewSMTP(SMTPConfig{
+		Host: "127.0.0.1", Port: srv.port(),
+		Username: "app", Password: "secret",
+		From: "Social Network <no-reply@example.com>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send(context.Background(), Message{
+		To:      "Ann <ann@example.com>",
+		Subject: "Grüße from the group",
+		Text:    "Hi Ann,\n\nBob invited you to a group.\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.authed) != 1 || srv.authed[0] != "app" {
+		t.Errorf("authenticated as %v, want [app]", srv.authed)
+	}
+	if len(srv.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(srv.messages))
+	}
+	got := srv.messages[0]
+	if got.from != "no-reply@example.com" || got.to != "ann@example.com" {
+		t.Errorf("envelope %s -> %s", got.from, got.to)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(got.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subj, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subj != "Grüße from the group" {
+		t.Errorf("subject %q", subj)
+	}
+	if !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("message id %q", parsed.Header.Get("Message-ID"))
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hi Ann,\r\n\r\nBob invited you to a group.\r\n"; string(body) != want {
+		t.Errorf("body %q, want %q", body, want)
+	}
+}
+
+func TestSMTPErrors(t *testing.T) {
+	srv := newFakeSMTP(t)
+	srv.refuse = "nobody@example.com"
+	cfg := SMTPConfig{Host: "127.0.0.1", Port: srv.port(), Username: "app", Password: "secret", From: "no-reply@example.com"}
+
+	m, _ := NewSMTP(cfg)
+	if err := m.Send(context.Background(), Message{To: "nobody@example.com", Subject: "x", Text: "x"}); err == nil ||
+		!strings.Contains(err.Error(), "550") {
+		t.Errorf("refused recipient: err = %v, want a 550", err)
+	}
+
+	cfg.Password = "wrong"
+	m, _ = NewSMTP(cfg)
+	if err := m.Send(context.Background(), Message{To: "ann@example.com", Subject: "x", Text: "x"}); err == nil {
+		t.Error("bad password: no error")
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.messages) != 0 {
+		t.Errorf("%d messages delivered, want none", len(srv.messages))
+	}
+
+	if _, err := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: srv.port(), From: "not an address"}); err == nil {
+		t.Error("bad from address accepted")
+	}
+	if _, err := NewSMTP(SMTPConfig{From: "no-reply@example.com"}); err == nil {
+		t.Error("missing host accepted")
+	}
+}
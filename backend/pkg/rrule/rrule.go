@@ -0,0 +1,382 @@
+// Package rrule implements the subset of RFC 5545 recurrence rules that
+// group events use: FREQ=DAILY|WEEKLY|MONTHLY|YEARLY with INTERVAL, COUNT,
+// UNTIL, BYDAY and BYMONTHDAY. Weeks start on Monday.
+//
+// Occurrences keep the wall-clock time of the first one in its location, so
+// a weekly 18:00 event stays at 18:00 across DST changes.
+package rrule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Freq int
+
+const (
+	Daily Freq = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+var freqNames = []string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+
+func (f Freq) String() string { return freqNames[f] }
+
+// Weekday is a BYDAY entry. N picks the Nth such day of the month (1 is
+// the first, -1 the last) and is only allowed with FREQ=MONTHLY; 0 means
+// every one.
+type Weekday struct {
+	Day time.Weekday
+	N   int
+}
+
+var dayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func (d Weekday) String() string {
+	if d.N == 0 {
+		return dayNames[d.Day]
+	}
+	return strconv.Itoa(d.N) + dayNames[d.Day]
+}
+
+// Rule is a parsed RRULE.
+type Rule struct {
+	Freq       Freq
+	Interval   int       // >= 1
+	Count      int       // 0 = no limit
+	Until      time.Time // zero = no limit; inclusive
+	ByDay      []Weekday
+	ByMonthDay []int // 1..31, or -1..-31 counting from the end of the month
+
+	// UNTIL without a "Z" is in the local time of the first occurrence
+	untilFloating bool
+}
+
+// MaxPeriods bounds how far a rule is expanded: that many days, weeks,
+// months or years after the first occurrence.
+const MaxPeriods = 10000
+
+// Parse reads a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10".
+// A leading "RRULE:" is allowed.
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1}
+	seenFreq := false
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return r, fmt.Errorf("rrule: empty rule")
+	}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return r, fmt.Errorf("rrule: bad part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			seenFreq = false
+			for i, f := range freqNames {
+				if strings.EqualFold(value, f) {
+					r.Freq, seenFreq = Freq(i), true
+				}
+			}
+			if !seenFreq {
+				return r, fmt.Errorf("rrule: unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "UNTIL":
+			r.Until, r.untilFloating, err = parseUntil(value)
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, err := parseWeekday(d)
+				if err != nil {
+					return r, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return r, fmt.Errorf("rrule: bad BYMONTHDAY %q", d)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "WKST":
+			if !strings.EqualFold(value, "MO") {
+				return r, fmt.Errorf("rrule: only WKST=MO is supported")
+			}
+		default:
+			return r, fmt.Errorf("rrule: unsupported part %s", name)
+		}
+		if err != nil {
+			return r, fmt.Errorf("rrule: bad %s: %v", name, err)
+		}
+	}
+	if !seenFreq {
+		return r, fmt.Errorf("rrule: FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return r, fmt.Errorf("rrule: COUNT and UNTIL can't both be set")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != Monthly {
+		return r, fmt.Errorf("rrule: BYMONTHDAY needs FREQ=MONTHLY")
+	}
+	if len(r.ByDay) > 0 && r.Freq == Yearly {
+		return r, fmt.Errorf("rrule: BYDAY isn't supported with FREQ=YEARLY")
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly {
+			return r, fmt.Errorf("rrule: BYDAY=%s needs FREQ=MONTHLY", d)
+		}
+	}
+	return r, nil
+}
+
+func parseUntil(v string) (t time.Time, floating bool, err error) {
+	switch {
+	case strings.HasSuffix(v, "Z"):
+		t, err = time.Parse("20060102T150405Z", v)
+	case strings.Contains(v, "T"):
+		t, err = time.Parse("20060102T150405", v)
+		floating = true
+	default:
+		// a date: the whole day is included
+		t, err = time.Parse("20060102", v)
+		t = t.Add(24*time.Hour - time.Second)
+		floating = true
+	}
+	return t, floating, err
+}
+
+func parseWeekday(s string) (Weekday, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return Weekday{}, fmt.Errorf("rrule: bad BYDAY %q", s)
+	}
+	var wd Weekday
+	if n := s[:len(s)-2]; n != "" {
+		var err error
+		wd.N, err = strconv.Atoi(n)
+		if err != nil || wd.N == 0 || wd.N < -5 || wd.N > 5 {
+			return wd, fmt.Errorf("rrule: bad BYDAY %q", s)
+		}
+	}
+	for i, name := range dayNames {
+		if s[len(s)-2:] == name {
+			wd.Day = time.Weekday(i)
+			return wd, nil
+		}
+	}
+	return wd, fmt.Errorf("rrule: bad BYDAY %q", s)
+}
+
+// String is the canonical form of r, without the "RRULE:" prefix.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq.String()}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.untilFloating {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405Z"))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of a series starting at start (its first
+// occurrence, the DTSTART) that fall in [from, to), at most limit of them.
+func (r Rule) Between(start, from, to time.Time, limit int) []time.Time {
+	var out []time.Time
+	r.each(start, func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+		if !t.Before(from) {
+			out = append(out, t)
+		}
+		return len(out) < limit
+	})
+	return out
+}
+
+// Includes reports whether t is an occurrence of the series.
+func (r Rule) Includes(start, t time.Time) bool {
+	found := false
+	r.each(start, func(o time.Time) bool {
+		found = o.Equal(t)
+		return o.Before(t)
+	})
+	return found
+}
+
+// each calls fn with every occurrence in order until fn returns false or the
+// series ends. The first occurrence is always start, even if the rule
+// wouldn't produce it (as RFC 5545 says).
+func (r Rule) each(start time.Time, fn func(time.Time) bool) {
+	until := r.Until
+	if r.untilFloating {
+		until = time.Date(until.Year(), until.Month(), until.Day(), until.Hour(), until.Minute(), until.Second(), 0, start.Location())
+	}
+	n := 0
+	emit := func(t time.Time) bool {
+		if !until.IsZero() && t.After(until) {
+			return false
+		}
+		n++
+		return fn(t) && (r.Count == 0 || n < r.Count)
+	}
+
+	if !emit(start) {
+		return
+	}
+	for k := 0; k < MaxPeriods; k++ {
+		for _, t := range r.period(start, k) {
+			if !t.After(start) {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// period lists the candidates of the k-th period (day, week, month, year)
+// after start, in order.
+func (r Rule) period(start time.Time, k int) []time.Time {
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, start.Location())
+	}
+	step := k * r.Interval
+
+	switch r.Freq {
+	case Daily:
+		t := at(y, m, d+step)
+		if len(r.ByDay) > 0 && !r.hasDay(t.Weekday()) {
+			return nil
+		}
+		return []time.Time{t}
+
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return []time.Time{at(y, m, d+7*step)}
+		}
+		monday := d - (int(start.Weekday())+6)%7 + 7*step
+		var out []time.Time
+		for i := 0; i < 7; i++ {
+			t := at(y, m, monday+i)
+			if r.hasDay(t.Weekday()) {
+				out = append(out, t)
+			}
+		}
+		return out
+
+	case Monthly:
+		first := at(y, m+time.Month(step), 1)
+		return r.monthDays(first, d, at)
+
+	default: // Yearly
+		t := at(y+step, m, d)
+		if t.Day() != d { // Feb 29 in a common year
+			return nil
+		}
+		return []time.Time{t}
+	}
+}
+
+// monthDays lists the occurrences in the month starting at first; day is
+// the day of month of the series start, used when there is no BY* part.
+func (r Rule) monthDays(first time.Time, day int, at func(int, time.Month, int) time.Time) []time.Time {
+	y, m := first.Year(), first.Month()
+	days := at(y, m+1, 0).Day() // days in this month
+	var out []time.Time
+	add := func(d int) {
+		if d >= 1 && d <= days {
+			out = append(out, at(y, m, d))
+		}
+	}
+
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = days + d + 1
+			}
+			if d >= 1 && d <= days && (len(r.ByDay) == 0 || r.hasDay(at(y, m, d).Weekday())) {
+				add(d)
+			}
+		}
+	case len(r.ByDay) > 0:
+		for _, wd := range r.ByDay {
+			firstMatch := 1 + (int(wd.Day)-int(first.Weekday())+7)%7
+			switch {
+			case wd.N > 0:
+				add(firstMatch + 7*(wd.N-1))
+			case wd.N < 0:
+				last := firstMatch + 7*((days-firstMatch)/7)
+				add(last + 7*(wd.N+1))
+			default:
+				for d := firstMatch; d <= days; d += 7 {
+					add(d)
+				}
+			}
+		}
+	default:
+		add(day) // months without that day are skipped
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	// BYDAY=MO,1MO could name a day twice
+	uniq := out[:0]
+	for i, t := range out {
+		if i == 0 || !t.Equal(out[i-1]) {
+			uniq = append(uniq, t)
+		}
+	}
+	return uniq
+}
+
+func (r Rule) hasDay(d time.Weekday) bool {
+	for _, wd := range r.ByDay {
+		if wd.Day == d {
+			return true
+		}
+	}
+	return false
+}
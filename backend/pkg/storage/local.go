@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local stores media as files in a directory on the app server (UPLOAD_DIR).
+type Local struct {
+	Dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir}, nil
+}
+
+func (l *Local) path(name string) (string, error) {
+	if !ValidName(name) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(l.Dir, name), nil
+}
+
+// Put writes to a temp file first so readers never see a partial upload.
+func (l *Local) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	p, err := l.path(name)
+	if err != nil {
+		return fmt.Errorf("storage: bad name %q", name)
+	}
+	tmp, err := os.CreateTemp(l.Dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (l *Local) Get(ctx context.Context, name string) (io.ReadCloser, *Info, error) {
+	p, err := l.path(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, ErrNotFound
+	}
+	return f, localInfo(name, fi), nil
+}
+
+func (l *Local) Delete(ctx context.Context, name string) error {
+	p, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Stat(ctx context.Context, name string) (*Info, error) {
+	p, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, ErrNotFound
+	}
+	return localInfo(name, fi), nil
+}
+
+func localInfo(name string, fi os.FileInfo) *Info {
+	return &Info{
+		Name:        name,
+		Size:        fi.Size(),
+		ContentType: contentTypeFor(name),
+		ModTime:     fi.ModTime(),
+		ETag:        fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()),
+	}
+}
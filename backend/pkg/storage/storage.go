@@ -0,0 +1,49 @@
+// Package storage keeps uploaded media files outside of the database.
+// Handlers talk to a MediaStore; server.go picks the implementation
+// (local directory or S3-compatible bucket) from configuration.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get, Stat and Delete for unknown names.
+var ErrNotFound = errors.New("storage: not found")
+
+// MediaStore stores media under flat names like "1755978318552730000_14080.png".
+type MediaStore interface {
+	Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error
+	// Get returns the file contents; callers must Close it. The reader also
+	// implements io.Seeker when the backend supports it (local files).
+	Get(ctx context.Context, name string) (io.ReadCloser, *Info, error)
+	Delete(ctx context.Context, name string) error
+	Stat(ctx context.Context, name string) (*Info, error)
+}
+
+// Info describes a stored file.
+type Info struct {
+	Name        string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	ETag        string // quoted, ready for the ETag header
+}
+
+// ValidName rejects anything that is not a plain file name
+// (sub-paths, hidden files, empty names).
+func ValidName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
+
+func contentTypeFor(name string) string {
+	if ct := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,191 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeEndpoint is a stand-in push service plus browser for local testing:
+// it hands out subscriptions, checks the VAPID header of every push it
+// receives and decrypts the payload. See cmd/fakepush.
+type FakeEndpoint struct {
+	BaseURL string // where it is served, e.g. "http://localhost:8099"
+	// Gone makes it answer 410, as for an expired subscription.
+	Gone bool
+	// OnPush, if set, is called with every decrypted payload.
+	OnPush func(payload []byte)
+
+	mu       sync.Mutex
+	key      *ecdh.PrivateKey
+	auth     []byte
+	received [][]byte
+}
+
+func NewFakeEndpoint(baseURL string) (*FakeEndpoint, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		return nil, err
+	}
+	return &FakeEndpoint{BaseURL: strings.TrimRight(baseURL, "/"), key: key, auth: auth}, nil
+}
+
+// Subscription is what a browser would send to POST /api/push/subscribe.
+func (f *FakeEndpoint) Subscription() Subscription {
+	var s Subscription
+	s.Endpoint = f.BaseURL + "/push/fake"
+	s.Keys.P256dh = b64.EncodeToString(f.key.PublicKey().Bytes())
+	s.Keys.Auth = b64.EncodeToString(f.auth)
+	return s
+}
+
+// Received returns the decrypted payloads so far, oldest first.
+func (f *FakeEndpoint) Received() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]byte(nil), f.received...)
+}
+
+func (f *FakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method", 405)
+		return
+	}
+	if f.Gone {
+		http.Error(w, "subscription expired", 410)
+		return
+	}
+	if err := verifyVAPID(r.Header.Get("Authorization"), f.BaseURL); err != nil {
+		http.Error(w, err.Error(), 401)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" {
+		http.Error(w, "content encoding must be aes128gcm", 415)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, recordSize+1))
+	if err != nil || len(body) > recordSize {
+		http.Error(w, "payload too large", 413)
+		return
+	}
+	plain, err := Decrypt(body, f.key, f.auth)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	f.mu.Lock()
+	f.received = append(f.received, plain)
+	f.mu.Unlock()
+	if f.OnPush != nil {
+		f.OnPush(plain)
+	}
+	w.WriteHeader(201)
+}
+
+// Decrypt reverses Encrypt for the user agent holding key and auth.
+func Decrypt(body []byte, key *ecdh.PrivateKey, auth []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("webpush: short body")
+	}
+	salt, idLen := body[:16], int(body[20])
+	if binary.BigEndian.Uint32(body[16:20]) < 18 || len(body) < 21+idLen {
+		return nil, errors.New("webpush: bad header")
+	}
+	asPublic, ciphertext := body[21:21+idLen], body[21+idLen:]
+	as, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		return nil, errors.New("webpush: bad sender key")
+	}
+	secret, err := key.ECDH(as)
+	if err != nil {
+		return nil, err
+	}
+	gcm, nonce, err := contentKey(secret, auth, salt, key.PublicKey().Bytes(), asPublic)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("webpush: decryption failed")
+	}
+	// strip padding up to the delimiter
+	for i := len(plain) - 1; i >= 0; i-- {
+		switch plain[i] {
+		case 0:
+			continue
+		case 2:
+			return plain[:i], nil
+		}
+		break
+	}
+	return nil, errors.New("webpush: bad padding")
+}
+
+// verifyVAPID checks a "vapid t=<jwt>, k=<key>" header the way a push
+// service does: ES256 signature by k, audience and expiry.
+func verifyVAPID(header, audience string) error {
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			token = v
+		case "k":
+			key = v
+		}
+	}
+	parts := strings.Split(token, ".")
+	if !strings.HasPrefix(header, "vapid ") || len(parts) != 3 || key == "" {
+		return errors.New("missing vapid authorization")
+	}
+	pub, err := b64.DecodeString(key)
+	if err != nil || len(pub) != 65 {
+		return errors.New("bad vapid key")
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return errors.New("bad vapid signature")
+	}
+	pk := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(pub[1:33]), Y: new(big.Int).SetBytes(pub[33:])}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(pk, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return errors.New("vapid signature does not verify")
+	}
+	raw, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return errors.New("bad vapid claims")
+	}
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return errors.New("bad vapid claims")
+	}
+	if claims.Aud != audience {
+		return errors.New("vapid aud is " + claims.Aud + ", want " + audience)
+	}
+	if claims.Exp < time.Now().Unix() || claims.Exp > time.Now().Add(24*time.Hour).Unix() {
+		return errors.New("vapid exp must be within 24h")
+	}
+	if claims.Sub == "" {
+		return errors.New("vapid sub missing")
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+// Package webpush sends Web Push messages: VAPID authentication (RFC 8292)
+// and aes128gcm payload encryption (RFC 8291, RFC 8188).
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrGone means the push service no longer knows the subscription
+// (404/410); it should be deleted.
+var ErrGone = errors.New("webpush: subscription gone")
+
+// recordSize is the aes128gcm record size; payloads must fit in one record.
+const recordSize = 4096
+
+// MaxPayload is the largest plaintext Encrypt accepts.
+const MaxPayload = recordSize - 16 - 1 - 86 // tag, delimiter, header
+
+var b64 = base64.RawURLEncoding
+
+// Subscription is what PushManager.subscribe() returns in the browser.
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"` // user agent public key, uncompressed point
+		Auth   string `json:"auth"`   // 16-byte auth secret
+	} `json:"keys"`
+}
+
+// VAPID identifies this server to push services.
+type VAPID struct {
+	key     *ecdsa.PrivateKey
+	Subject string // "mailto:admin@example.com" or an https URL
+}
+
+// GenerateVAPID creates a new key pair.
+func GenerateVAPID(subject string) (*VAPID, error) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &VAPID{key: k, Subject: subject}, nil
+}
+
+// ParseVAPID loads a private key saved with PrivateKey.
+func ParseVAPID(privateKey, subject string) (*VAPID, error) {
+	d, err := b64.DecodeString(privateKey)
+	if err != nil || len(d) != 32 {
+		return nil, errors.New("webpush: VAPID private key must be 32 bytes, base64url")
+	}
+	ek, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: bad VAPID private key: %w", err)
+	}
+	pub := ek.PublicKey().Bytes()
+	return &VAPID{
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(pub[1:33]),
+				Y:     new(big.Int).SetBytes(pub[33:]),
+			},
+			D: new(big.Int).SetBytes(d),
+		},
+		Subject: subject,
+	}, nil
+}
+
+// PrivateKey is the base64url private scalar, for ParseVAPID.
+func (v *VAPID) PrivateKey() string {
+	return b64.EncodeToString(v.key.D.FillBytes(make([]byte, 32)))
+}
+
+// PublicKey is the base64url uncompressed public key; browsers pass it to
+// PushManager.subscribe() as applicationServerKey.
+func (v *VAPID) PublicKey() string {
+	k, _ := v.key.ECDH()
+	return b64.EncodeToString(k.PublicKey().Bytes())
+}
+
+// authorization builds the "vapid t=<jwt>, k=<key>" header for endpoint.
+func (v *VAPID) authorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("webpush: bad endpoint %q", endpoint)
+	}
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": v.Subject,
+	})
+	signing := header + "." + b64.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signing))
+	r, s, err := ecdsa.Sign(rand.Reader, v.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return "vapid t=" + signing + "." + b64.EncodeToString(sig) + ", k=" + v.PublicKey(), nil
+}
+
+// Encrypt encrypts plaintext for sub as a single aes128gcm record.
+func Encrypt(sub Subscription, plaintext []byte) ([]byte, error) {
+	if len(plaintext) > MaxPayload {
+		return nil, fmt.Errorf("webpush: payload of %d bytes is too large", len(plaintext))
+	}
+	uaPublic, err := decodeKey(sub.Keys.P256dh)
+	if err != nil {
+		return nil, errors.New("webpush: bad p256dh key")
+	}
+	ua, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, errors.New("webpush: bad p256dh key")
+	}
+	authSecret, err := decodeKey(sub.Keys.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, errors.New("webpush: bad auth secret")
+	}
+
+	as, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	secret, err := as.ECDH(ua)
+	if err != nil {
+		return nil, err
+	}
+	gcm, nonce, err := contentKey(secret, authSecret, salt, uaPublic, as.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(salt)
+	_ = binary.Write(&out, binary.BigEndian, uint32(recordSize))
+	out.WriteByte(65)
+	out.Write(as.PublicKey().Bytes())
+	// 0x02 marks the last (and only) record; no padding
+	return gcm.Seal(out.Bytes(), nonce, append(append([]byte{}, plaintext...), 2), nil), nil
+}
+
+// contentKey derives the AEAD and nonce (RFC 8291 section 3.4).
+func contentKey(ecdhSecret, authSecret, salt, uaPublic, asPublic []byte) (cipher.AEAD, []byte, error) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ecdhSecret, authSecret, keyInfo), ikm); err != nil {
+		return nil, nil, err
+	}
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	return gcm, nonce, err
+}
+
+// sharedAddressSpace is carrier-grade NAT (RFC 6598), not covered by IsPrivate.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is routable on the internet: not loopback,
+// private, link-local (which includes cloud metadata services), multicast
+// or unspecified.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// decodeKey accepts base64url with or without padding, as browsers differ.
+func decodeKey(s string) ([]byte, error) {
+	if b, err := b64.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+// Sender delivers encrypted messages to push services.
+type Sender struct {
+	VAPID  *VAPID
+	Client *http.Client
+	// AllowLocal lets pushes go to loopback and private addresses, for
+	// testing against cmd/fakepush. Otherwise the client refuses to connect
+	// to them, whatever the endpoint's host resolved to when it was checked.
+	AllowLocal bool
+}
+
+func NewSender(v *VAPID) *Sender {
+	s := &Sender{VAPID: v}
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); !s.AllowLocal && (ip == nil || !publicIP(ip)) {
+				return fmt.Errorf("webpush: refusing to connect to %s", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // the dialer has to see the push service's own address
+	transport.DialContext = dialer.DialContext
+	s.Client = &http.Client{Timeout: 15 * time.Second, Transport: transport}
+	return s
+}
+
+// Send pushes payload to sub. ttl is how long the push service keeps it for
+// a device that is offline. Returns ErrGone when sub should be dropped.
+func (s *Sender) Send(ctx context.Context, sub Subscription, payload []byte, ttl time.Duration) error {
+	body, err := Encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+	auth, err := s.VAPID.authorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "normal")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("webpush: push service said %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Validate checks that sub has usable keys and an endpoint we are willing to
+// POST to: https, on a host that only resolves to public addresses, so a
+// subscription can't point the server at its own network. allowLocal (see
+// Sender.AllowLocal) also accepts http and local hosts, for cmd/fakepush.
+func (sub Subscription) Validate(ctx context.Context, allowLocal bool) error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Host == "" {
+		return errors.New("webpush: bad endpoint")
+	}
+	if u.Scheme != "https" && !(allowLocal && u.Scheme == "http") {
+		return errors.New("webpush: endpoint must be https")
+	}
+	if !allowLocal {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+		if err != nil || len(addrs) == 0 {
+			return errors.New("webpush: endpoint host does not resolve")
+		}
+		for _, a := range addrs {
+			if !publicIP(a.IP) {
+				return errors.New("webpush: endpoint must be a public address")
+			}
+		}
+	}
+	if p, err := decodeKey(sub.Keys.P256dh); err != nil {
+		return errors.New("webpush: bad p256dh key")
+	} else if _, err := ecdh.P256().NewPublicKey(p); err != nil {
+		return errors.New("webpush: bad p256dh key")
+	}
+	if a, err := decodeKey(sub.Keys.Auth); err != nil || len(a) != 16 {
+		return errors.New("webpush: bad auth secret")
+	}
+	return nil
+}
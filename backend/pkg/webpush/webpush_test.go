@@ -0,0 +1,78 @@
+package webpush
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateEndpoint(t *testing.T) {
+	fake, err := NewFakeEndpoint("https://push.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for endpoint, allowLocal := range map[string]bool{
+		"http://push.example/x":             false, // not https
+		"https://127.0.0.1/x":               false,
+		"https://localhost:8099/x":          false,
+		"https://10.0.0.5/x":                false,
+		"https://192.168.1.1/x":             false,
+		"https://169.254.169.254/latest":    false, // cloud metadata
+		"https://[::1]/x":                   false,
+		"https://[fe80::1]/x":               false,
+		"https://100.64.0.1/x":              false,
+		"https://0.0.0.0/x":                 false,
+		"ftp://localhost/x":                 true,
+		"https://no-such-host.invalid/push": false,
+	} {
+		sub := fake.Subscription()
+		sub.Endpoint = endpoint
+		if err := sub.Validate(ctx, allowLocal); err == nil {
+			t.Errorf("Validate(%s, allowLocal=%v) accepted", endpoint, allowLocal)
+		}
+	}
+
+	for _, endpoint := range []string{"http://localhost:8099/push/fake", "https://10.0.0.5/x"} {
+		sub := fake.Subscription()
+		sub.Endpoint = endpoint
+		if err := sub.Validate(ctx, true); err != nil {
+			t.Errorf("Validate(%s) with allowLocal: %v", endpoint, err)
+		}
+	}
+	sub := fake.Subscription()
+	sub.Endpoint = "https://8.8.8.8/push"
+	if err := sub.Validate(ctx, false); err != nil {
+		t.Errorf("public address refused: %v", err)
+	}
+}
+
+func TestSenderRefusesLocalAddresses(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+	fake, err := NewFakeEndpoint(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Config.Handler = fake
+	v, err := GenerateVAPID("mailto:test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSender(v)
+	err = s.Send(context.Background(), fake.Subscription(), []byte(`{"n":1}`), time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "refusing to connect") {
+		t.Fatalf("push to %s: err = %v, want a refusal", srv.URL, err)
+	}
+
+	s.AllowLocal = true
+	if err := s.Send(context.Background(), fake.Subscription(), []byte(`{"n":2}`), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.Received(); len(got) != 1 || string(got[0]) != `{"n":2}` {
+		t.Errorf("received %q", got)
+	}
+}
@@ -55,4 +55,23 @@ func (h *Hub) Broadcast(room string, msg Message) {
 			log.Println("ws send:", err)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// Revoke removes from room, and closes, every client denied says may no
+// longer be there: for when who may read a room changes after its sockets
+// joined. denied is called without the hub locked, so it may be slow.
+func (h *Hub) Revoke(room string, denied func(Client) bool) {
+	h.mu.RLock()
+	var clients []Client
+	for c := range h.rooms[room] {
+		clients = append(clients, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range clients {
+		if denied(c) {
+			h.Leave(room, c)
+			_ = c.Close()
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	sqlite "social-network/backend/pkg/db"
 	"social-network/backend/pkg/handlers"
+	"social-network/backend/pkg/jobs"
+	"social-network/backend/pkg/mail"
+	"social-network/backend/pkg/storage"
+	"social-network/backend/pkg/webpush"
 	"social-network/backend/pkg/ws"
 )
 
@@ -19,6 +25,44 @@ func env(k, def string) string {
 	return def
 }
 
+// mediaStore picks where uploads live: MEDIA_STORE=local (UPLOAD_DIR, default)
+// or MEDIA_STORE=s3 (any S3-compatible endpoint, configured via S3_*).
+func mediaStore() (storage.MediaStore, error) {
+	if env("MEDIA_STORE", "local") == "s3" {
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  env("S3_ENDPOINT", ""),
+			Region:    env("S3_REGION", "us-east-1"),
+			Bucket:    env("S3_BUCKET", ""),
+			AccessKey: env("S3_ACCESS_KEY", ""),
+			SecretKey: env("S3_SECRET_KEY", ""),
+			Prefix:    env("S3_PREFIX", ""),
+			PathStyle: env("S3_PATH_STYLE", "true") == "true",
+		})
+	}
+	return storage.NewLocal(env("UPLOAD_DIR", "./uploads"))
+}
+
+// mailer picks how email goes out: MAILER=log (default, nothing is sent),
+// MAILER=file (.eml files in MAIL_DIR) or MAILER=smtp (configured via SMTP_*).
+func mailer() (mail.Mailer, error) {
+	from := env("MAIL_FROM", "Social Network <no-reply@localhost>")
+	switch env("MAILER", "log") {
+	case "smtp":
+		port, _ := strconv.Atoi(env("SMTP_PORT", "587"))
+		return mail.NewSMTP(mail.SMTPConfig{
+			Host:        env("SMTP_HOST", ""),
+			Port:        port,
+			Username:    env("SMTP_USERNAME", ""),
+			Password:    env("SMTP_PASSWORD", ""),
+			From:        from,
+			ImplicitTLS: env("SMTP_TLS", "") == "implicit",
+		})
+	case "file":
+		return mail.NewFile(env("MAIL_DIR", "./mail"), from)
+	}
+	return mail.Log{}, nil
+}
+
 func main() {
 	port := env("PORT", "8080")
 	dbPath := env("SQLITE_PATH", "./socialnet.db")
@@ -29,24 +73,69 @@ func main() {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	if err := handlers.IndexBacklog(db); err != nil {
+		log.Fatal("index backlog: ", err)
+	}
+
+	store, err := mediaStore()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	mux := http.NewServeMux()
 
 	hub := ws.NewHub()
 	presence := handlers.NewPresence(db)
-	wsh := &handlers.WSHandler{Hub: hub, Presence: presence}
+	wsh := &handlers.WSHandler{DB: db, Hub: hub, Presence: presence}
 
 	mux.Handle("/ws", wsh)
 	mux.HandleFunc("/api/presence/online", presence.Online)
 
-	dm := &handlers.DMHandler{DB: db, Hub: hub}
-	gh := &handlers.GroupHandler{DB: db, Hub: hub}
-	eh := &handlers.EventsHandler{DB: db, Hub: hub}
+	notifier := handlers.NewNotifier(db, hub)
+	if notifier.Mailer, err = mailer(); err != nil {
+		log.Fatal(err)
+	}
+	notifier.AppURL = env("APP_URL", frontend)
+	notifier.Presence = presence
+	vapid, err := handlers.LoadVAPID(db, env("VAPID_PRIVATE_KEY", ""), env("VAPID_SUBJECT", "mailto:admin@localhost"))
+	if err != nil {
+		log.Fatal("vapid: ", err)
+	}
+	notifier.Push = webpush.NewSender(vapid)
+	// only for testing with cmd/fakepush: push to http and local addresses
+	allowLocalPush := env("WEBPUSH_ALLOW_LOCAL", "") == "true"
+	notifier.Push.AllowLocal = allowLocalPush
+
+	// background jobs
+	digestEvery, err := time.ParseDuration(env("DIGEST_EVERY", "15m"))
+	if err != nil {
+		log.Fatal("DIGEST_EVERY: ", err)
+	}
+	scheduler := jobs.NewScheduler()
+	scheduler.Every("digests", digestEvery, notifier.SendDigests)
+	scheduler.Every("held-mail", 5*time.Minute, notifier.SendHeldMail)
+	retentionDays, _ := strconv.Atoi(env("NOTIFICATION_RETENTION_DAYS", "90"))
+	if retentionDays > 0 {
+		retention := time.Duration(retentionDays) * 24 * time.Hour
+		scheduler.Every("notification-retention", time.Hour, func(ctx context.Context) error {
+			return notifier.PruneNotifications(ctx, retention)
+		})
+	}
+
+	dm := &handlers.DMHandler{DB: db, Hub: hub, Notifier: notifier}
+	gh := &handlers.GroupHandler{DB: db, Hub: hub, Notifier: notifier, Store: store}
+	eh := &handlers.EventsHandler{DB: db, Hub: hub, Notifier: notifier}
+	scheduler.Every("event-reminders", time.Minute, eh.SendReminders)
+	scheduler.Start(context.Background())
 
 	mux.HandleFunc("/api/dm/history", dm.History) // GET
 	mux.HandleFunc("/api/dm/send", dm.Send)       // POST
 	mux.HandleFunc("/api/dm/partners", dm.Partners) // GET
 
+	cs := &handlers.ChatSearchHandler{DB: db}
+	mux.HandleFunc("/api/chat/search", cs.Search)   // GET ?q=&userId=|groupId=&senderId=&from=&to=
+	mux.HandleFunc("/api/chat/context", cs.Context) // GET ?kind=dm|group&id=&before=&after=
+
 	mux.HandleFunc("/api/groups/create", gh.Create)                     // POST
 	mux.HandleFunc("/api/groups/my", gh.MyGroups)                       // GET
 	mux.HandleFunc("/api/groups/invitations", gh.PendingInvitations)    // GET
@@ -62,34 +151,72 @@ func main() {
 	mux.HandleFunc("/api/groups/invite", gh.Invite)                     // POST
 	mux.HandleFunc("/api/groups/join", gh.Join)                         // POST
 	mux.HandleFunc("/api/groups/leave", gh.Leave)                       // POST
-	mux.HandleFunc("/api/groups/promote", gh.Promote)                   // POST
+	mux.HandleFunc("/api/groups/promote", gh.Promote)                   // POST {groupId, userId, role?}
+	mux.HandleFunc("/api/groups/demote", gh.Demote)                     // POST {groupId, userId, role?}
+	mux.HandleFunc("/api/groups/transfer", gh.TransferOwnership)        // POST {groupId, userId}
+	mux.HandleFunc("/api/groups/delete", gh.Delete)                     // DELETE ?groupId=
+	mux.HandleFunc("/api/groups/visibility", gh.SetVisibility)          // POST {groupId, visibility}
+	mux.HandleFunc("/api/groups/permissions", gh.Permissions)           // GET ?groupId=, PUT {groupId, roles}
+	mux.HandleFunc("/api/groups/settings", gh.Settings)                 // GET ?groupId=, PUT {groupId, title?, description?, coverUrl?, rules?}
+	mux.HandleFunc("/api/groups/audit", gh.Audit)                       // GET ?groupId=&before=
+	mux.HandleFunc("/api/groups/invite-links", gh.InviteLinks)          // GET ?groupId=, POST {groupId, hours?, maxUses?}, DELETE ?id=
+	mux.HandleFunc("/api/groups/invite-links/uses", gh.InviteLinkUses)  // GET ?id=
+	mux.HandleFunc("/api/groups/join-link", gh.JoinLink)                // GET ?token=, POST {token}
+	mux.HandleFunc("/api/groups/ban", gh.Ban)                           // POST {groupId, userId, reason?, hours?}
+	mux.HandleFunc("/api/groups/unban", gh.Unban)                       // POST {groupId, userId}
+	mux.HandleFunc("/api/groups/bans", gh.Bans)                         // GET ?groupId=
+
+	mux.HandleFunc("/api/events/create", eh.Create)         // POST
+	mux.HandleFunc("/api/events/group", eh.GetGroupEvents)  // GET ?groupId=&from=&to=
+	mux.HandleFunc("/api/events/mine", eh.Mine)             // GET ?from=&to=&status=going,maybe,not_going,waitlisted,none
+	mux.HandleFunc("/api/events/respond", eh.Respond)       // POST
+	mux.HandleFunc("/api/events/attendees", eh.Attendees)   // GET ?eventId=
+	mux.HandleFunc("/api/events/update", eh.Update)         // PUT {eventId, title?, description?, eventDate?, timezone?, recurrence?, capacity?}
+	mux.HandleFunc("/api/events/cancel", eh.Cancel)         // POST {eventId, reason?}
+	mux.HandleFunc("/api/events/exceptions", eh.Exceptions) // GET, POST {eventId, occurrence}, DELETE ?eventId=&occurrence=
+	mux.HandleFunc("/api/events/delete", eh.Delete)         // DELETE
 
-	mux.HandleFunc("/api/events/create", eh.Create)        // POST
-	mux.HandleFunc("/api/events/group", eh.GetGroupEvents) // GET
-	mux.HandleFunc("/api/events/respond", eh.Respond)      // POST
-	mux.HandleFunc("/api/events/delete", eh.Delete)        // DELETE
+	calh := &handlers.CalendarHandler{DB: db, AppURL: notifier.AppURL, APIURL: env("API_URL", "")}
+	mux.HandleFunc("/api/events/ics", calh.Event)     // GET ?eventId= -> .ics
+	mux.HandleFunc("/api/calendar/token", calh.Token) // GET, POST (new feed URL), DELETE (revoke)
+	mux.HandleFunc("/api/calendar/feed/", calh.Feed)  // GET /api/calendar/feed/<token>.ics, no session
 
 	// presence HTTP already added earlier:
 	// mux.HandleFunc("/api/presence/online", presence.Online)
-	ph := &handlers.PostHandler{DB: db, Hub: hub}
-	ch := &handlers.CommentHandler{DB: db, Hub: hub}
+	ph := &handlers.PostHandler{DB: db, Hub: hub, Store: store, Notifier: notifier}
+	ch := &handlers.CommentHandler{DB: db, Hub: hub, Notifier: notifier}
 	// phProf := &handlers.ProfileHandler{DB: db}
 	uh := &handlers.UsersHandler{DB: db}
-	nh := &handlers.NotificationsHandler{DB: db}
-	phProf := &handlers.ProfileHandler{DB: db, Hub: hub}
+	nh := &handlers.NotificationsHandler{DB: db, Notifier: notifier}
+	phProf := &handlers.ProfileHandler{DB: db, Hub: hub, Notifier: notifier}
 
 	// mux.HandleFunc("/api/presence/online", presence.Online)
-	mux.HandleFunc("/api/notifications", nh.List)               // GET
-	mux.HandleFunc("/api/notifications/mark_read", nh.MarkRead) // POST
+	mux.HandleFunc("/api/notifications", nh.List)                      // GET
+	mux.HandleFunc("/api/notifications/mark_read", nh.MarkRead)        // POST
+	mux.HandleFunc("/api/notifications/mark_all_read", nh.MarkAllRead) // POST {before?}
+	mux.HandleFunc("/api/notifications/delete", nh.Delete)             // POST {ids} | {allRead}
+	mux.HandleFunc("/api/notifications/unread_count", nh.UnreadCount)  // GET
+	mux.HandleFunc("/api/notifications/preferences", nh.Preferences)   // GET, PUT
+	mux.HandleFunc("/api/notifications/mute", nh.Mute)                 // POST {targetType, targetId, hours?}
+	mux.HandleFunc("/api/notifications/unmute", nh.Unmute)             // POST {targetType, targetId}
+
+	pu := &handlers.PushHandler{DB: db, VAPID: vapid, AllowLocal: allowLocalPush}
+	mux.HandleFunc("/api/push/vapid-key", pu.VAPIDKey)      // GET
+	mux.HandleFunc("/api/push/subscribe", pu.Subscribe)     // POST PushSubscription JSON
+	mux.HandleFunc("/api/push/unsubscribe", pu.Unsubscribe) // POST {endpoint} | {id}
+	mux.HandleFunc("/api/push/subscriptions", pu.List)      // GET
 
 	mux.HandleFunc("/api/users/search", uh.Search) // GET ?q=
 	mux.HandleFunc("/api/users/brief", uh.Brief)   // GET ?id=
+	sh := &handlers.SearchHandler{DB: db}
+	mux.HandleFunc("/api/search", sh.Search) // GET ?q=&type=all|users|posts|comments|groups
 	// profile & follow routes
 	mux.HandleFunc("/api/profile", phProf.Get)                    // GET ?id=<userId>
 	mux.HandleFunc("/api/profile/enhanced", phProf.GetEnhanced)   // GET ?id=<userId> (with posts, detailed info)
 	mux.HandleFunc("/api/profile/followers", phProf.GetFollowers) // GET ?id=<userId>
 	mux.HandleFunc("/api/profile/following", phProf.GetFollowing) // GET ?id=<userId>
 	mux.HandleFunc("/api/profile/privacy", phProf.SetPrivacy)     // POST {isPublic}
+	mux.HandleFunc("/api/profile/timezone", phProf.Timezone)      // GET, PUT {timezone}
 	mux.HandleFunc("/api/follow/request", phProf.FollowRequest)   // POST {userId}
 	mux.HandleFunc("/api/follow/unfollow", phProf.Unfollow)       // POST {userId}
 
@@ -101,11 +228,12 @@ func main() {
 	mux.HandleFunc("/api/profile/make_posts_public", phProf.MakePostsPublic)
 
 	// uploads
-	uploadDir := env("UPLOAD_DIR", "./uploads")
-	mux.Handle("/api/upload", handlers.UploadImage(uploadDir))
-	mux.Handle("/api/upload/", handlers.UploadImage(uploadDir)) // handle trailing slash too
-	// serve uploaded files
-	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadDir))))
+	mux.Handle("/api/upload", handlers.UploadMedia(db, store))
+	mux.Handle("/api/upload/", handlers.UploadMedia(db, store)) // handle trailing slash too
+	// serve uploaded files (access-checked against the post/message/avatar using them)
+	media := handlers.NewMediaHandler(db, store, env("MEDIA_SIGNING_KEY", ""))
+	mux.Handle("/uploads/", media)
+	mux.HandleFunc("/api/media/sign", media.Sign) // POST {url, ttl}
 
 	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
 
@@ -120,13 +248,14 @@ func main() {
 	mux.HandleFunc("/api/my/posts", ph.ListMine)
 	mux.HandleFunc("/api/posts/delete", ph.Delete)
 	mux.HandleFunc("/api/posts/like", ph.ToggleLike)
+	mux.HandleFunc("/api/hashtags/", ph.ByHashtag) // GET /api/hashtags/{tag}
 	mux.HandleFunc("/api/posts/", func(w http.ResponseWriter, r *http.Request) {
 		// Handle /api/posts/{id}/privacy
 		if strings.HasSuffix(r.URL.Path, "/privacy") {
 			ph.UpdatePrivacy(w, r)
 			return
 		}
-		http.NotFound(w, r)
+		ph.Update(w, r) // PUT /api/posts/{id} {body}
 	})
 
 	// comments
@@ -135,6 +264,10 @@ func main() {
 			ch.Create(w, r)
 			return
 		}
+		if r.Method == http.MethodPut {
+			ch.Update(w, r) // {id, body}
+			return
+		}
 		ch.ListByPost(w, r) // GET ?postId=
 	})
 
@@ -58,9 +58,10 @@ export default function NotificationBell() {
           console.log("🔔 New notification:", msg);
           
           if (msg.type === "notification" || msg.Type === "notification") {
-            // Add new notification to the list
-            setItems(prev => [msg.payload, ...prev]);
-            setUnread(prev => prev + 1);
+            // Add new notification to the list (an aggregated one moves to the top)
+            setItems(prev => [msg.payload, ...prev.filter(n => n.id !== msg.payload?.id)]);
+          } else if (msg.type === "notification_count") {
+            setUnread(msg.payload?.count ?? 0);
           }
         } catch (error) {
           console.error("Failed to parse notification message:", error);
@@ -92,11 +93,11 @@ export default function NotificationBell() {
       const unreadIds = items.filter(n => !n.readAt).map(n => n.id);
       if (unreadIds.length === 0) return;
 
-      const res = await fetch(`${API}/api/notifications/mark_read`, {
+      const res = await fetch(`${API}/api/notifications/mark_all_read`, {
         method: "POST",
         credentials: "include",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ ids: unreadIds })
+        body: JSON.stringify({ before: Math.max(...items.map(n => n.id)) })
       });
       if (!res.ok) return;
       
@@ -145,7 +146,7 @@ export default function NotificationBell() {
       case 'event_created':
         return {
           icon: '🎉',
-          text: `${notification.actorId} created a new event: ${notification.title}`,
+          text: `${notification.actorId} created a new event: ${notification.metadata?.title}`,
           time
         };
       case 'group_join_request':
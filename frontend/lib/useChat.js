@@ -145,10 +145,11 @@ export function useChatList() {
     })();
   }, [me]);
 
-  const createGroup = async (title, description) => {
+  // visibility: "public" | "private" (default) | "secret"
+  const createGroup = async (title, description, visibility) => {
     const result = await api("/api/groups/create", {
       method: "POST",
-      body: JSON.stringify({ title, description }),
+      body: JSON.stringify({ title, description, visibility }),
     });
     const [groupsData, invitationsData] = await Promise.all([
       api("/api/groups/my"),
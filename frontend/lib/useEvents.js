@@ -32,7 +32,9 @@ export function useEvents(groupId) {
         groupId: parseInt(groupId),
         title,
         description,
-        eventDate
+        eventDate,
+        // the form's date and time are in the browser's zone
+        timezone: Intl.DateTimeFormat().resolvedOptions().timeZone
       };
       console.log("Sending API request with payload:", payload);
       
@@ -54,13 +56,15 @@ export function useEvents(groupId) {
 
   const respondToEvent = async (eventId, response) => {
     try {
-      await api("/api/events/respond", {
+      const res = await api("/api/events/respond", {
         method: "POST",
         body: JSON.stringify({
           eventId: parseInt(eventId),
           response
         })
       });
+      // a full event puts "going" on the waitlist
+      response = res?.response || response;
 
       // Update event in local state
       setEvents(prev => prev.map(event => {
@@ -72,6 +76,10 @@ export function useEvents(groupId) {
             updatedEvent.responses.going--;
           } else if (event.userResponse === "not_going") {
             updatedEvent.responses.notGoing--;
+          } else if (event.userResponse === "maybe") {
+            updatedEvent.responses.maybe--;
+          } else if (event.userResponse === "waitlisted") {
+            updatedEvent.responses.waitlisted--;
           }
           
           // Add new response
@@ -79,6 +87,10 @@ export function useEvents(groupId) {
             updatedEvent.responses.going++;
           } else if (response === "not_going") {
             updatedEvent.responses.notGoing++;
+          } else if (response === "maybe") {
+            updatedEvent.responses.maybe++;
+          } else if (response === "waitlisted") {
+            updatedEvent.responses.waitlisted++;
           }
           
           updatedEvent.userResponse = response;